@@ -18,6 +18,27 @@ package v1beta2
 
 const ImageFinalizer = "finalizers.fluxcd.io"
 
+const (
+	// DowngradePreventedCondition indicates that the latest image of an
+	// ImagePolicy was kept because the newly computed latest image orders
+	// below it.
+	DowngradePreventedCondition string = "DowngradePrevented"
+
+	// AwaitingApprovalCondition indicates that the newly computed latest
+	// image of an ImagePolicy is pending until it's approved.
+	AwaitingApprovalCondition string = "AwaitingApproval"
+
+	// PromotionWindowClosedCondition indicates that the newly computed latest
+	// image of an ImagePolicy is pending until the next promotion window
+	// opens.
+	PromotionWindowClosedCondition string = "PromotionWindowClosed"
+
+	// AwaitingUpstreamPromotionCondition indicates that the newly computed
+	// latest image of an ImagePolicy is pending until it's eligible for
+	// promotion from the upstream ImagePolicy.
+	AwaitingUpstreamPromotionCondition string = "AwaitingUpstreamPromotion"
+)
+
 const (
 	// ImageURLInvalidReason represents the fact that a given repository has an invalid image URL.
 	ImageURLInvalidReason string = "ImageURLInvalid"
@@ -32,4 +53,21 @@ const (
 
 	// ReadOperationFailedReason signals a failure caused by a read operation.
 	ReadOperationFailedReason string = "ReadOperationFailed"
+
+	// LowerLatestImageReason signals that the newly computed latest image
+	// orders below the current latest image.
+	LowerLatestImageReason string = "LowerLatestImage"
+
+	// ApprovalRequiredReason signals that the newly computed latest image
+	// requires an approval to be promoted.
+	ApprovalRequiredReason string = "ApprovalRequired"
+
+	// OutsidePromotionWindowReason signals that the newly computed latest
+	// image was computed outside the promotion windows.
+	OutsidePromotionWindowReason string = "OutsidePromotionWindow"
+
+	// UpstreamNotPromotedReason signals that the newly computed latest image
+	// hasn't been the latest image of the upstream ImagePolicy for long
+	// enough.
+	UpstreamNotPromotedReason string = "UpstreamNotPromoted"
 )
@@ -17,12 +17,19 @@ limitations under the License.
 package v1beta2
 
 import (
+	"github.com/fluxcd/pkg/apis/acl"
 	"github.com/fluxcd/pkg/apis/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const ImagePolicyKind = "ImagePolicy"
 
+// ApprovedImageAnnotation is the annotation used to approve the pending image
+// of an ImagePolicy that requires approval. Its value is the tag, the full
+// reference, or the digest of the approved image, e.g. `sha256:<hex>`,
+// `@sha256:<hex>` or `<image>@sha256:<hex>`.
+const ApprovedImageAnnotation = "image.toolkit.fluxcd.io/approved"
+
 // Deprecated: Use ImageFinalizer.
 const ImagePolicyFinalizer = "finalizers.fluxcd.io"
 
@@ -33,6 +40,15 @@ type ImagePolicySpec struct {
 	// being scanned
 	// +required
 	ImageRepositoryRef meta.NamespacedObjectReference `json:"imageRepositoryRef"`
+	// ImageRepositoryRefs points at additional objects specifying images
+	// being scanned. The latest image is computed across the combined tags of
+	// all the referenced image repositories.
+	// +optional
+	ImageRepositoryRefs []meta.NamespacedObjectReference `json:"imageRepositoryRefs,omitempty"`
+	// ImageRepositorySelector selects additional objects specifying images
+	// being scanned by their labels, in the namespace of the ImagePolicy.
+	// +optional
+	ImageRepositorySelector *metav1.LabelSelector `json:"imageRepositorySelector,omitempty"`
 	// Policy gives the particulars of the policy to be followed in
 	// selecting the most recent image
 	// +required
@@ -42,8 +58,113 @@ type ImagePolicySpec struct {
 	// ordered and compared.
 	// +optional
 	FilterTags *TagFilter `json:"filterTags,omitempty"`
+	// CandidatesLimit is the number of top ranked images reported in
+	// `.status.candidates`, e.g. to find the previous versions to roll back
+	// to. No candidates are reported when not set.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	CandidatesLimit int `json:"candidatesLimit,omitempty"`
+	// Explain reports in `.status.explanation` a summary of the verdicts of
+	// the policy on the tags, e.g. the number of tags removed by the filter or
+	// that failed to parse.
+	// +optional
+	Explain bool `json:"explain,omitempty"`
+	// AllowDowngrade allows the latest image to be updated to a tag that
+	// orders below the current latest image, e.g. when a tag is deleted from
+	// the registry or excluded by the tag filter. When false, the current
+	// latest image is kept until a tag ordering above it is found, and the
+	// DowngradePrevented condition is set. Defaults to true.
+	// +optional
+	AllowDowngrade *bool `json:"allowDowngrade,omitempty"`
+	// RequireApproval holds a newly computed latest image back as
+	// PendingImage until it's approved by setting the
+	// `image.toolkit.fluxcd.io/approved` annotation to its tag or its full
+	// reference. LatestImage is updated only with approved images.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// PromotionWindows restricts the updates of LatestImage to the given
+	// time windows. Outside the windows, a newly computed latest image is
+	// held back as PendingImage until the next window opens.
+	// +optional
+	PromotionWindows []PromotionWindow `json:"promotionWindows,omitempty"`
+	// Stabilization requires a newly computed latest image to persist for a
+	// number of consecutive ImageRepository scans, or for a duration, before
+	// it's promoted to LatestImage. Until then, it's held back as
+	// PendingImage.
+	// +optional
+	Stabilization *Stabilization `json:"stabilization,omitempty"`
+	// PromotedFrom makes a newly computed latest image eligible for
+	// promotion only once the referenced upstream ImagePolicy has had an
+	// image with the same tag as LatestImage for a minimum duration. Until
+	// then, it's held back as PendingImage.
+	// +optional
+	PromotedFrom *PromotedFrom `json:"promotedFrom,omitempty"`
+	// AccessFrom defines an ACL for allowing cross-namespace references
+	// to the ImagePolicy object based on the caller's namespace labels,
+	// e.g. from the PromotedFrom field of another ImagePolicy.
+	// +optional
+	AccessFrom *acl.AccessFrom `json:"accessFrom,omitempty"`
+}
+
+// PromotedFrom specifies the upstream ImagePolicy the images are promoted
+// from.
+type PromotedFrom struct {
+	// PolicyRef is a reference to the upstream ImagePolicy.
+	// +required
+	PolicyRef meta.NamespacedObjectReference `json:"policyRef"`
+	// MinDuration is the minimum time the upstream ImagePolicy must have had
+	// the image as LatestImage for. Defaults to zero, making the image
+	// eligible as soon as it's the upstream latest image.
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	MinDuration *metav1.Duration `json:"minDuration,omitempty"`
+}
+
+// Stabilization specifies how long a newly computed latest image must persist
+// before it's promoted. When both Scans and Duration are set, both must be
+// satisfied.
+type Stabilization struct {
+	// Scans is the number of consecutive ImageRepository scans the image must
+	// be computed as latest image for.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Scans int `json:"scans,omitempty"`
+	// Duration is the minimum time the image must be computed as latest
+	// image for.
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// PromotionWindow is a recurring time window, opening at the same time on a
+// set of days of the week.
+type PromotionWindow struct {
+	// Days are the days of the week the window opens on. Defaults to every
+	// day.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+	// Start is the opening time of the window in the HH:MM format.
+	// +kubebuilder:validation:Pattern="^([01][0-9]|2[0-3]):[0-5][0-9]$"
+	// +required
+	Start string `json:"start"`
+	// End is the closing time of the window in the HH:MM format. When it's
+	// not after Start, the window spans midnight and closes on the next day.
+	// +kubebuilder:validation:Pattern="^([01][0-9]|2[0-3]):[0-5][0-9]$"
+	// +required
+	End string `json:"end"`
+	// TimeZone is the IANA time zone name of the Start and End times, e.g.
+	// `Europe/Berlin`. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
 // ImagePolicyChoice is a union of all the types of policy that can be
 // supplied.
 type ImagePolicyChoice struct {
@@ -57,14 +178,110 @@ type ImagePolicyChoice struct {
 	// Numerical set of rules to use for numerical ordering of the tags.
 	// +optional
 	Numerical *NumericalPolicy `json:"numerical,omitempty"`
+	// Composite set of rules to use for ordering the tags by multiple keys
+	// extracted from the named capture groups of the FilterTags pattern.
+	// +optional
+	Composite *CompositePolicy `json:"composite,omitempty"`
+	// Fallback is an ordered list of policies to evaluate when this policy
+	// can't determine a latest image, e.g. when no tag fits the SemVer range.
+	// The first fallback policy that determines a latest image yields the
+	// result.
+	// +optional
+	Fallback []ImagePolicyFallback `json:"fallback,omitempty"`
+}
+
+// ImagePolicyFallback is a policy evaluated when none of the previous policies
+// in the ImagePolicyChoice determined a latest image.
+type ImagePolicyFallback struct {
+	// SemVer gives a semantic version range to check against the tags
+	// available.
+	// +optional
+	SemVer *SemVerPolicy `json:"semver,omitempty"`
+	// Alphabetical set of rules to use for alphabetical ordering of the tags.
+	// +optional
+	Alphabetical *AlphabeticalPolicy `json:"alphabetical,omitempty"`
+	// Numerical set of rules to use for numerical ordering of the tags.
+	// +optional
+	Numerical *NumericalPolicy `json:"numerical,omitempty"`
+	// Composite set of rules to use for ordering the tags by multiple keys
+	// extracted from the named capture groups of the FilterTags pattern.
+	// +optional
+	Composite *CompositePolicy `json:"composite,omitempty"`
+	// FilterTags filters the tags before evaluating this fallback policy, in
+	// place of the FilterTags of the ImagePolicy, e.g. to extract the
+	// version of another tag scheme.
+	// +optional
+	FilterTags *TagFilter `json:"filterTags,omitempty"`
 }
 
 // SemVerPolicy specifies a semantic version policy.
 type SemVerPolicy struct {
 	// Range gives a semver range for the image tag; the highest
 	// version within the range that's a tag yields the latest image.
+	// Required unless Relative pins a Baseline.
+	// +optional
+	Range string `json:"range,omitempty"`
+	// Relative derives a range relative to a baseline version on each
+	// reconciliation, e.g. to allow patch updates only. The derived range
+	// applies in addition to Range.
+	// +optional
+	Relative *SemVerRelative `json:"relative,omitempty"`
+	// Prerelease restricts the prerelease versions considered by the policy
+	// to specific channels, e.g. `rc` or `beta`.
+	// +optional
+	Prerelease *SemVerPrerelease `json:"prerelease,omitempty"`
+	// GroupBy additionally computes the latest version of each group of
+	// versions, e.g. of each major version, into `.status.latestImages`.
+	// +optional
+	GroupBy *GroupBy `json:"groupBy,omitempty"`
+}
+
+// GroupBy specifies how the tags are grouped when computing the latest image
+// of each group. Exactly one of Version and CaptureGroup must be set.
+type GroupBy struct {
+	// Version groups the versions by their major version, e.g. `1`, or by
+	// their major and minor versions, e.g. `1.4`. Only valid for SemVer
+	// policies.
+	// +kubebuilder:validation:Enum=major;minor
+	// +optional
+	Version string `json:"version,omitempty"`
+	// CaptureGroup groups the tags by the value of the named capture group of
+	// the FilterTags pattern, e.g. `train` for the pattern
+	// `^(?P<train>[a-z]+)-(?P<ts>\d+)$`.
+	// +optional
+	CaptureGroup string `json:"captureGroup,omitempty"`
+}
+
+// SemVerRelative specifies a semver range relative to a baseline version.
+type SemVerRelative struct {
+	// Updates is the kind of updates allowed relative to the baseline
+	// version: `patch` allows `>=1.4.2 <1.5.0` for the baseline `1.4.2`,
+	// `minor` allows `>=1.4.2 <2.0.0` and `major` allows `>=1.4.2`.
+	// +kubebuilder:validation:Enum=patch;minor;major
 	// +required
-	Range string `json:"range"`
+	Updates string `json:"updates"`
+	// Baseline pins the version the range is relative to. When not set, the
+	// range is relative to the tag of the previously selected latest image.
+	// +optional
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// SemVerPrerelease specifies the prerelease channels of a SemVer policy.
+type SemVerPrerelease struct {
+	// Channels is the list of allowed prerelease channels. A prerelease
+	// version belongs to a channel when its first prerelease identifier is the
+	// channel name, e.g. `1.2.0-rc.1` belongs to the `rc` channel. The range
+	// is checked against the release version of the prereleases, e.g.
+	// `1.2.0` for `1.2.0-rc.1`.
+	// +kubebuilder:validation:MinItems:=1
+	// +required
+	Channels []string `json:"channels"`
+	// IncludeStable makes the stable versions candidates along with the
+	// prerelease versions of the channels, selecting the latest stable
+	// version or a newer prerelease. When false, only the prerelease versions
+	// of the channels are selected.
+	// +optional
+	IncludeStable bool `json:"includeStable,omitempty"`
 }
 
 // AlphabeticalPolicy specifies a alphabetical ordering policy.
@@ -87,6 +304,50 @@ type NumericalPolicy struct {
 	// +kubebuilder:validation:Enum=asc;desc
 	// +optional
 	Order string `json:"order,omitempty"`
+	// SkipUnparsable skips the tags that can't be parsed as numbers, instead
+	// of failing the policy evaluation. The number of skipped tags is reported
+	// in the status.
+	// +optional
+	SkipUnparsable bool `json:"skipUnparsable,omitempty"`
+	// GroupBy additionally computes the latest value of each group of tags
+	// into `.status.latestImages`. Only CaptureGroup is valid for Numerical
+	// policies.
+	// +optional
+	GroupBy *GroupBy `json:"groupBy,omitempty"`
+}
+
+// CompositePolicy specifies an ordering policy over multiple sort keys. The
+// key values are read from the named capture groups of the FilterTags pattern,
+// e.g. `release-(?P<major>\d+)-build-(?P<build>\d+)`.
+type CompositePolicy struct {
+	// Keys is the ordered list of sort keys. Tags are compared on the first
+	// key, and on the following keys only when the previous ones are equal.
+	// +kubebuilder:validation:MinItems:=1
+	// +required
+	Keys []SortKey `json:"keys"`
+}
+
+// SortKey specifies a single key of a CompositePolicy.
+type SortKey struct {
+	// Group is the name of the capture group in the FilterTags pattern that
+	// holds the value of the key.
+	// +required
+	Group string `json:"group"`
+	// Type specifies how the values of the key are compared.
+	// +kubebuilder:default:="numerical"
+	// +kubebuilder:validation:Enum=numerical;semver;alphabetical;timestamp
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Order specifies the sorting order of the key values. Ascending order
+	// selects the highest value, and descending order the lowest value.
+	// +kubebuilder:default:="asc"
+	// +kubebuilder:validation:Enum=asc;desc
+	// +optional
+	Order string `json:"order,omitempty"`
+	// Layout is the Go time layout used to parse the values of a timestamp
+	// key. Defaults to RFC3339.
+	// +optional
+	Layout string `json:"layout,omitempty"`
 }
 
 // TagFilter enables filtering tags based on a set of defined rules
@@ -107,16 +368,123 @@ type ImagePolicyStatus struct {
 	// the image repository, when filtered and ordered according to
 	// the policy.
 	LatestImage string `json:"latestImage,omitempty"`
+	// LatestImageRepositoryRef points at the image repository LatestImage
+	// was selected from.
+	// +optional
+	LatestImageRepositoryRef *meta.NamespacedObjectReference `json:"latestImageRepositoryRef,omitempty"`
+	// LatestImages maps each group of tags to its latest image, when the
+	// policy groups the tags. Unlike LatestImage, the images aren't subject
+	// to the downgrade, stabilization, approval and promotion gates.
+	// +optional
+	LatestImages map[string]string `json:"latestImages,omitempty"`
+	// Candidates is the list of the top ranked images in policy order, the
+	// latest first, limited to CandidatesLimit entries. Unlike LatestImage,
+	// the images aren't subject to the downgrade, stabilization, approval and
+	// promotion gates.
+	// +optional
+	Candidates []Candidate `json:"candidates,omitempty"`
+	// Explanation summarizes the verdicts of the policy on the tags, when
+	// Explain is set.
+	// +optional
+	Explanation *Explanation `json:"explanation,omitempty"`
 	// ObservedPreviousImage is the observed previous LatestImage. It is used
 	// to keep track of the previous and current images.
 	// +optional
 	ObservedPreviousImage string `json:"observedPreviousImage,omitempty"`
+	// PendingImage is the newly computed latest image awaiting to be
+	// promoted to LatestImage, e.g. when approval is required.
+	// +optional
+	PendingImage string `json:"pendingImage,omitempty"`
+	// LastPromotion is the last update of LatestImage. It's kept when
+	// LatestImage is reset by a failure.
+	// +optional
+	LastPromotion *Promotion `json:"lastPromotion,omitempty"`
+	// PromotionHistory is the list of the last updates of LatestImage, the
+	// most recent first. Each image was held as LatestImage until the next
+	// promotion.
+	// +optional
+	PromotionHistory []Promotion `json:"promotionHistory,omitempty"`
+	// Stabilization is the state of the stabilization of a newly computed
+	// latest image, when Stabilization is set in the spec.
+	// +optional
+	Stabilization *StabilizationStatus `json:"stabilization,omitempty"`
+	// ResolvedPolicy is the policy that determined LatestImage, either
+	// `spec.policy` or one of its fallbacks, e.g. `spec.policy.fallback[0]`.
+	// +optional
+	ResolvedPolicy string `json:"resolvedPolicy,omitempty"`
+	// SkippedTagCount is the number of tags skipped by the policy that
+	// determined LatestImage because they couldn't be parsed.
+	// +optional
+	SkippedTagCount int `json:"skippedTagCount,omitempty"`
+	// SemVerBaseline is the version the relative SemVer range is anchored
+	// to. It's kept when the latest image is reset by a failure, so that the
+	// range stays anchored on recovery.
+	// +optional
+	SemVerBaseline string `json:"semVerBaseline,omitempty"`
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// Promotion is an update of the latest image of an ImagePolicy.
+type Promotion struct {
+	// Image is the promoted image.
+	Image string `json:"image"`
+	// Time is the time the image was promoted.
+	Time metav1.Time `json:"time"`
+}
+
+// Candidate is an image ranked by the policy of an ImagePolicy.
+type Candidate struct {
+	// Image is the candidate image.
+	Image string `json:"image"`
+	// Digest is the digest of the image, when resolved by a scan of its
+	// ImageRepository.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// Explanation is the number of tags of each verdict of the policy.
+type Explanation struct {
+	// Tags is the number of evaluated tags.
+	Tags int `json:"tags"`
+	// Selected is the number of selected tags, 1 if the policy determined a
+	// latest tag.
+	// +optional
+	Selected int `json:"selected,omitempty"`
+	// Outranked is the number of candidate tags that lost on ordering to the
+	// selected tag.
+	// +optional
+	Outranked int `json:"outranked,omitempty"`
+	// OutOfRange is the number of tags that were parsed but aren't accepted
+	// by the policy, e.g. outside of the SemVer range.
+	// +optional
+	OutOfRange int `json:"outOfRange,omitempty"`
+	// Unparsable is the number of tags the policy failed to parse.
+	// +optional
+	Unparsable int `json:"unparsable,omitempty"`
+	// Filtered is the number of tags removed by the tag filter.
+	// +optional
+	Filtered int `json:"filtered,omitempty"`
+}
+
+// StabilizationStatus is the state of the stabilization of a newly computed
+// latest image.
+type StabilizationStatus struct {
+	// Candidate is the image being stabilized.
+	Candidate string `json:"candidate"`
+	// FirstObservedTime is the time the candidate was first computed as
+	// latest image.
+	FirstObservedTime metav1.Time `json:"firstObservedTime"`
+	// Scans is the number of consecutive ImageRepository scans the candidate
+	// was computed as latest image for.
+	Scans int `json:"scans"`
+	// LastScanTime is the time of the last ImageRepository scan counted.
+	// +optional
+	LastScanTime metav1.Time `json:"lastScanTime,omitempty"`
+}
+
 // GetConditions returns the status conditions of the object.
 func (p ImagePolicy) GetConditions() []metav1.Condition {
 	return p.Status.Conditions
@@ -30,6 +30,23 @@ const ImageRepositoryKind = "ImageRepository"
 // Deprecated: Use ImageFinalizer.
 const ImageRepositoryFinalizer = "finalizers.fluxcd.io"
 
+const (
+	// LatestTagsOrderAlphabetical orders the latest tags alphabetically.
+	LatestTagsOrderAlphabetical = "alphabetical"
+	// LatestTagsOrderSemVer orders the latest tags by SemVer precedence.
+	LatestTagsOrderSemVer = "semver"
+	// LatestTagsOrderNumerical orders the latest tags numerically.
+	LatestTagsOrderNumerical = "numerical"
+	// LatestTagsOrderNatural orders the latest tags in natural order.
+	LatestTagsOrderNatural = "natural"
+	// LatestTagsOrderFirstSeen orders the latest tags by the time they were
+	// first seen by the controller.
+	LatestTagsOrderFirstSeen = "first-seen"
+)
+
+// defaultLatestTagsCount is the default number of latest tags.
+const defaultLatestTagsCount = 10
+
 // ImageRepositorySpec defines the parameters for scanning an image
 // repository, e.g., `fluxcd/flux`.
 type ImageRepositorySpec struct {
@@ -104,6 +121,24 @@ type ImageRepositorySpec struct {
 	// +kubebuilder:default:=generic
 	// +optional
 	Provider string `json:"provider,omitempty"`
+
+	// LatestTagsOrder is the order of the latest tags reported in
+	// `.status.lastScanResult.latestTags`: `alphabetical`, `semver`,
+	// `numerical`, `natural` or `first-seen`. The tags that can't be ordered
+	// by SemVer or numerically follow in alphabetical order.
+	// When not specified, defaults to 'alphabetical'.
+	// +kubebuilder:validation:Enum=alphabetical;semver;numerical;natural;first-seen
+	// +kubebuilder:default:=alphabetical
+	// +optional
+	LatestTagsOrder string `json:"latestTagsOrder,omitempty"`
+
+	// LatestTagsCount is the number of latest tags reported in
+	// `.status.lastScanResult.latestTags`.
+	// When not specified, defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	LatestTagsCount int `json:"latestTagsCount,omitempty"`
 }
 
 type ScanResult struct {
@@ -136,6 +171,16 @@ type ImageRepositoryStatus struct {
 	// spec.lastScanResult.
 	ObservedExclusionList []string `json:"observedExclusionList,omitempty"`
 
+	// ObservedLatestTagsOrder is the order of the latest tags of the observed
+	// scan result in status.lastScanResult.
+	// +optional
+	ObservedLatestTagsOrder string `json:"observedLatestTagsOrder,omitempty"`
+
+	// ObservedLatestTagsCount is the number of latest tags of the observed
+	// scan result in status.lastScanResult.
+	// +optional
+	ObservedLatestTagsCount int `json:"observedLatestTagsCount,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
@@ -169,6 +214,24 @@ func (in ImageRepository) GetProvider() string {
 	return p
 }
 
+// GetLatestTagsOrder returns the order of the latest tags with default.
+func (in ImageRepository) GetLatestTagsOrder() string {
+	o := LatestTagsOrderAlphabetical
+	if in.Spec.LatestTagsOrder != "" {
+		o = in.Spec.LatestTagsOrder
+	}
+	return o
+}
+
+// GetLatestTagsCount returns the number of latest tags with default.
+func (in ImageRepository) GetLatestTagsCount() int {
+	c := defaultLatestTagsCount
+	if in.Spec.LatestTagsCount > 0 {
+		c = in.Spec.LatestTagsCount
+	}
+	return c
+}
+
 // GetConditions returns the status conditions of the object.
 func (in ImageRepository) GetConditions() []metav1.Condition {
 	return in.Status.Conditions
@@ -43,6 +43,71 @@ func (in *AlphabeticalPolicy) DeepCopy() *AlphabeticalPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Candidate) DeepCopyInto(out *Candidate) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Candidate.
+func (in *Candidate) DeepCopy() *Candidate {
+	if in == nil {
+		return nil
+	}
+	out := new(Candidate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompositePolicy) DeepCopyInto(out *CompositePolicy) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]SortKey, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompositePolicy.
+func (in *CompositePolicy) DeepCopy() *CompositePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CompositePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Explanation) DeepCopyInto(out *Explanation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Explanation.
+func (in *Explanation) DeepCopy() *Explanation {
+	if in == nil {
+		return nil
+	}
+	out := new(Explanation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupBy) DeepCopyInto(out *GroupBy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupBy.
+func (in *GroupBy) DeepCopy() *GroupBy {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupBy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImagePolicy) DeepCopyInto(out *ImagePolicy) {
 	*out = *in
@@ -76,7 +141,7 @@ func (in *ImagePolicyChoice) DeepCopyInto(out *ImagePolicyChoice) {
 	if in.SemVer != nil {
 		in, out := &in.SemVer, &out.SemVer
 		*out = new(SemVerPolicy)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Alphabetical != nil {
 		in, out := &in.Alphabetical, &out.Alphabetical
@@ -86,7 +151,19 @@ func (in *ImagePolicyChoice) DeepCopyInto(out *ImagePolicyChoice) {
 	if in.Numerical != nil {
 		in, out := &in.Numerical, &out.Numerical
 		*out = new(NumericalPolicy)
-		**out = **in
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(CompositePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Fallback != nil {
+		in, out := &in.Fallback, &out.Fallback
+		*out = make([]ImagePolicyFallback, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -100,6 +177,46 @@ func (in *ImagePolicyChoice) DeepCopy() *ImagePolicyChoice {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePolicyFallback) DeepCopyInto(out *ImagePolicyFallback) {
+	*out = *in
+	if in.SemVer != nil {
+		in, out := &in.SemVer, &out.SemVer
+		*out = new(SemVerPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Alphabetical != nil {
+		in, out := &in.Alphabetical, &out.Alphabetical
+		*out = new(AlphabeticalPolicy)
+		**out = **in
+	}
+	if in.Numerical != nil {
+		in, out := &in.Numerical, &out.Numerical
+		*out = new(NumericalPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(CompositePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FilterTags != nil {
+		in, out := &in.FilterTags, &out.FilterTags
+		*out = new(TagFilter)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicyFallback.
+func (in *ImagePolicyFallback) DeepCopy() *ImagePolicyFallback {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePolicyFallback)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImagePolicyList) DeepCopyInto(out *ImagePolicyList) {
 	*out = *in
@@ -136,12 +253,49 @@ func (in *ImagePolicyList) DeepCopyObject() runtime.Object {
 func (in *ImagePolicySpec) DeepCopyInto(out *ImagePolicySpec) {
 	*out = *in
 	out.ImageRepositoryRef = in.ImageRepositoryRef
+	if in.ImageRepositoryRefs != nil {
+		in, out := &in.ImageRepositoryRefs, &out.ImageRepositoryRefs
+		*out = make([]meta.NamespacedObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImageRepositorySelector != nil {
+		in, out := &in.ImageRepositorySelector, &out.ImageRepositorySelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Policy.DeepCopyInto(&out.Policy)
 	if in.FilterTags != nil {
 		in, out := &in.FilterTags, &out.FilterTags
 		*out = new(TagFilter)
 		**out = **in
 	}
+	if in.AllowDowngrade != nil {
+		in, out := &in.AllowDowngrade, &out.AllowDowngrade
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PromotionWindows != nil {
+		in, out := &in.PromotionWindows, &out.PromotionWindows
+		*out = make([]PromotionWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Stabilization != nil {
+		in, out := &in.Stabilization, &out.Stabilization
+		*out = new(Stabilization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PromotedFrom != nil {
+		in, out := &in.PromotedFrom, &out.PromotedFrom
+		*out = new(PromotedFrom)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AccessFrom != nil {
+		in, out := &in.AccessFrom, &out.AccessFrom
+		*out = new(acl.AccessFrom)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicySpec.
@@ -157,6 +311,45 @@ func (in *ImagePolicySpec) DeepCopy() *ImagePolicySpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImagePolicyStatus) DeepCopyInto(out *ImagePolicyStatus) {
 	*out = *in
+	if in.LatestImageRepositoryRef != nil {
+		in, out := &in.LatestImageRepositoryRef, &out.LatestImageRepositoryRef
+		*out = new(meta.NamespacedObjectReference)
+		**out = **in
+	}
+	if in.LatestImages != nil {
+		in, out := &in.LatestImages, &out.LatestImages
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Candidates != nil {
+		in, out := &in.Candidates, &out.Candidates
+		*out = make([]Candidate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Explanation != nil {
+		in, out := &in.Explanation, &out.Explanation
+		*out = new(Explanation)
+		**out = **in
+	}
+	if in.LastPromotion != nil {
+		in, out := &in.LastPromotion, &out.LastPromotion
+		*out = new(Promotion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PromotionHistory != nil {
+		in, out := &in.PromotionHistory, &out.PromotionHistory
+		*out = make([]Promotion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Stabilization != nil {
+		in, out := &in.Stabilization, &out.Stabilization
+		*out = new(StabilizationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -312,6 +505,11 @@ func (in *ImageRepositoryStatus) DeepCopy() *ImageRepositoryStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NumericalPolicy) DeepCopyInto(out *NumericalPolicy) {
 	*out = *in
+	if in.GroupBy != nil {
+		in, out := &in.GroupBy, &out.GroupBy
+		*out = new(GroupBy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NumericalPolicy.
@@ -324,6 +522,63 @@ func (in *NumericalPolicy) DeepCopy() *NumericalPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotedFrom) DeepCopyInto(out *PromotedFrom) {
+	*out = *in
+	out.PolicyRef = in.PolicyRef
+	if in.MinDuration != nil {
+		in, out := &in.MinDuration, &out.MinDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotedFrom.
+func (in *PromotedFrom) DeepCopy() *PromotedFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotedFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Promotion) DeepCopyInto(out *Promotion) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Promotion.
+func (in *Promotion) DeepCopy() *Promotion {
+	if in == nil {
+		return nil
+	}
+	out := new(Promotion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionWindow) DeepCopyInto(out *PromotionWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionWindow.
+func (in *PromotionWindow) DeepCopy() *PromotionWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScanResult) DeepCopyInto(out *ScanResult) {
 	*out = *in
@@ -348,6 +603,21 @@ func (in *ScanResult) DeepCopy() *ScanResult {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SemVerPolicy) DeepCopyInto(out *SemVerPolicy) {
 	*out = *in
+	if in.Relative != nil {
+		in, out := &in.Relative, &out.Relative
+		*out = new(SemVerRelative)
+		**out = **in
+	}
+	if in.Prerelease != nil {
+		in, out := &in.Prerelease, &out.Prerelease
+		*out = new(SemVerPrerelease)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GroupBy != nil {
+		in, out := &in.GroupBy, &out.GroupBy
+		*out = new(GroupBy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SemVerPolicy.
@@ -360,6 +630,93 @@ func (in *SemVerPolicy) DeepCopy() *SemVerPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SemVerPrerelease) DeepCopyInto(out *SemVerPrerelease) {
+	*out = *in
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SemVerPrerelease.
+func (in *SemVerPrerelease) DeepCopy() *SemVerPrerelease {
+	if in == nil {
+		return nil
+	}
+	out := new(SemVerPrerelease)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SemVerRelative) DeepCopyInto(out *SemVerRelative) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SemVerRelative.
+func (in *SemVerRelative) DeepCopy() *SemVerRelative {
+	if in == nil {
+		return nil
+	}
+	out := new(SemVerRelative)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SortKey) DeepCopyInto(out *SortKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SortKey.
+func (in *SortKey) DeepCopy() *SortKey {
+	if in == nil {
+		return nil
+	}
+	out := new(SortKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Stabilization) DeepCopyInto(out *Stabilization) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Stabilization.
+func (in *Stabilization) DeepCopy() *Stabilization {
+	if in == nil {
+		return nil
+	}
+	out := new(Stabilization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StabilizationStatus) DeepCopyInto(out *StabilizationStatus) {
+	*out = *in
+	in.FirstObservedTime.DeepCopyInto(&out.FirstObservedTime)
+	in.LastScanTime.DeepCopyInto(&out.LastScanTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StabilizationStatus.
+func (in *StabilizationStatus) DeepCopy() *StabilizationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StabilizationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TagFilter) DeepCopyInto(out *TagFilter) {
 	*out = *in
@@ -16,9 +16,22 @@ limitations under the License.
 
 package controller
 
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/image-reflector-controller/internal/database"
+)
+
 // DatabaseWriter implementations record the tags for an image repository.
+//
+// Deleting the tags of a repository that has none recorded should not be an
+// error.
 type DatabaseWriter interface {
 	SetTags(repo string, tags []string) error
+	DeleteTags(repo string) error
 }
 
 // DatabaseReader implementations get the stored set of tags for an image
@@ -29,3 +42,80 @@ type DatabaseWriter interface {
 type DatabaseReader interface {
 	Tags(repo string) ([]string, error)
 }
+
+// DigestReader implementations get the digests recorded for the tags of an
+// image repository. A DatabaseReader may optionally implement it, so that the
+// ImagePolicy candidates report the digests of the images.
+type DigestReader interface {
+	Digests(repo string) (map[string]string, error)
+}
+
+// DigestWriter implementations record the digests resolved for the tags of an
+// image repository. A DatabaseWriter may optionally implement it, so that the
+// digests resolved on scans are recorded.
+type DigestWriter interface {
+	SetDigests(repo string, digests map[string]string) error
+}
+
+// HistoryReader implementations get the history of the tags of an image
+// repository. A Database may optionally implement it, so that the recently
+// recorded tags aren't swept as orphaned.
+type HistoryReader interface {
+	History(repo string) ([]database.TagRecord, error)
+}
+
+// RepositoryLister implementations list the image repositories for which tags
+// are recorded. A Database may optionally implement it, so that the tags of
+// deleted ImageRepositories are swept on startup.
+type RepositoryLister interface {
+	Repositories() ([]string, error)
+}
+
+// tagsKey returns the key of the tags of the given ImageRepository in the
+// database, scoped to the ImageRepository object unless shared.
+func tagsKey(repo *imagev1.ImageRepository, shared bool) string {
+	return database.RepositoryKey(repo.Namespace, repo.Name, repo.Status.CanonicalImageName, shared)
+}
+
+// waitForDatabase blocks until the ready channel of the database is closed, or
+// the context is done. It returns immediately if the channel is nil.
+func waitForDatabase(ctx context.Context, ready <-chan struct{}) error {
+	if ready == nil {
+		return nil
+	}
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RepositoryObjects lists the ImageRepositories matching the given options
+// with the given reader, e.g. from the API server regardless of the label
+// selector of the cache, for migrating the keys of their tags.
+func RepositoryObjects(ctx context.Context, reader client.Reader, opts ...client.ListOption) ([]database.RepositoryObject, error) {
+	var list imagev1.ImageRepositoryList
+	if err := reader.List(ctx, &list, opts...); err != nil {
+		return nil, err
+	}
+	objects := make([]database.RepositoryObject, 0, len(list.Items))
+	for _, repo := range list.Items {
+		// The ImageRepositories never scanned, e.g. in a new cluster, are
+		// keyed by the canonical name of their image once scanned.
+		canonicalName := repo.Status.CanonicalImageName
+		if canonicalName == "" {
+			ref, err := parseImageReference(repo.Spec.Image)
+			if err != nil {
+				continue
+			}
+			canonicalName = ref.Context().String()
+		}
+		objects = append(objects, database.RepositoryObject{
+			Namespace:     repo.Namespace,
+			Name:          repo.Name,
+			CanonicalName: canonicalName,
+		})
+	}
+	return objects, nil
+}
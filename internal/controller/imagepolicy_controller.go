@@ -20,11 +20,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	kuberecorder "k8s.io/client-go/tools/record"
@@ -45,9 +48,11 @@ import (
 	helper "github.com/fluxcd/pkg/runtime/controller"
 	"github.com/fluxcd/pkg/runtime/patch"
 	pkgreconcile "github.com/fluxcd/pkg/runtime/reconcile"
+	"github.com/fluxcd/pkg/version"
 
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
 	"github.com/fluxcd/image-reflector-controller/internal/policy"
+	"github.com/fluxcd/image-reflector-controller/internal/schedule"
 )
 
 // errAccessDenied is returned when an ImageRepository reference in ImagePolicy
@@ -79,6 +84,10 @@ var imagePolicyOwnedConditions = []string{
 	meta.ReadyCondition,
 	meta.ReconcilingCondition,
 	meta.StalledCondition,
+	imagev1.DowngradePreventedCondition,
+	imagev1.AwaitingApprovalCondition,
+	imagev1.PromotionWindowClosedCondition,
+	imagev1.AwaitingUpstreamPromotionCondition,
 }
 
 // imagePolicyNegativeConditions is a list of negative polarity conditions
@@ -87,6 +96,10 @@ var imagePolicyOwnedConditions = []string{
 var imagePolicyNegativeConditions = []string{
 	meta.StalledCondition,
 	meta.ReconcilingCondition,
+	imagev1.DowngradePreventedCondition,
+	imagev1.AwaitingApprovalCondition,
+	imagev1.PromotionWindowClosedCondition,
+	imagev1.AwaitingUpstreamPromotionCondition,
 }
 
 // this is used as the key for the index of policy->repository; the
@@ -94,6 +107,14 @@ var imagePolicyNegativeConditions = []string{
 // from.
 const imageRepoKey = ".spec.imageRepository"
 
+// imageRepoSelectorKey is the key for the index of the policies selecting
+// image repos by labels; the value is the namespace of the selected image
+// repos.
+const imageRepoSelectorKey = ".spec.imageRepositorySelector"
+
+// promotedFromKey is the key for the index of policy->upstream policy.
+const promotedFromKey = ".spec.promotedFrom"
+
 // +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imagepolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imagepolicies/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imagerepositories,verbs=get;list;watch
@@ -109,6 +130,12 @@ type ImagePolicyReconciler struct {
 	ControllerName string
 	Database       DatabaseReader
 	ACLOptions     acl.Options
+	// SharedTagsDatabase reads the tags keyed by canonical image name rather
+	// than scoped to the ImageRepository objects.
+	SharedTagsDatabase bool
+	// DatabaseReady is closed once the Database is ready to be used, e.g. its
+	// keys migrated. The reconciliations wait for it when not nil.
+	DatabaseReady <-chan struct{}
 
 	patchOptions []patch.Option
 }
@@ -120,17 +147,47 @@ type ImagePolicyReconcilerOptions struct {
 func (r *ImagePolicyReconciler) SetupWithManager(mgr ctrl.Manager, opts ImagePolicyReconcilerOptions) error {
 	r.patchOptions = getPatchOptions(imagePolicyOwnedConditions, r.ControllerName)
 
-	// index the policies by which image repo they point at, so that
+	// index the policies by which image repos they point at, so that
 	// it's easy to list those out when an image repo changes.
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &imagev1.ImagePolicy{}, imageRepoKey, func(obj client.Object) []string {
 		pol := obj.(*imagev1.ImagePolicy)
 
-		namespace := pol.Spec.ImageRepositoryRef.Namespace
+		refs := append([]meta.NamespacedObjectReference{pol.Spec.ImageRepositoryRef}, pol.Spec.ImageRepositoryRefs...)
+		keys := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			keys = append(keys, imageRepositoryNamespacedName(pol, ref).String())
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+
+	// index the policies selecting image repos by labels by the namespace
+	// of the selected image repos.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &imagev1.ImagePolicy{}, imageRepoSelectorKey, func(obj client.Object) []string {
+		pol := obj.(*imagev1.ImagePolicy)
+		if pol.Spec.ImageRepositorySelector == nil {
+			return nil
+		}
+		return []string{obj.GetNamespace()}
+	}); err != nil {
+		return err
+	}
+
+	// index the policies by which upstream policy they're promoted from, so
+	// that it's easy to list those out when an upstream policy changes.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &imagev1.ImagePolicy{}, promotedFromKey, func(obj client.Object) []string {
+		pol := obj.(*imagev1.ImagePolicy)
+		if pol.Spec.PromotedFrom == nil {
+			return nil
+		}
+
+		namespace := pol.Spec.PromotedFrom.PolicyRef.Namespace
 		if namespace == "" {
 			namespace = obj.GetNamespace()
 		}
 		namespacedName := types.NamespacedName{
-			Name:      pol.Spec.ImageRepositoryRef.Name,
+			Name:      pol.Spec.PromotedFrom.PolicyRef.Name,
 			Namespace: namespace,
 		}
 		return []string{namespacedName.String()}
@@ -139,11 +196,18 @@ func (r *ImagePolicyReconciler) SetupWithManager(mgr ctrl.Manager, opts ImagePol
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&imagev1.ImagePolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		For(&imagev1.ImagePolicy{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))).
 		Watches(
 			&imagev1.ImageRepository{},
 			handler.EnqueueRequestsFromMapFunc(r.imagePoliciesForRepository),
 		).
+		Watches(
+			&imagev1.ImagePolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.imagePoliciesPromotedFrom),
+		).
 		WithOptions(controller.Options{
 			RateLimiter: opts.RateLimiter,
 		}).
@@ -151,6 +215,9 @@ func (r *ImagePolicyReconciler) SetupWithManager(mgr ctrl.Manager, opts ImagePol
 }
 
 func (r *ImagePolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, retErr error) {
+	if err := waitForDatabase(ctx, r.DatabaseReady); err != nil {
+		return ctrl.Result{}, err
+	}
 	start := time.Now()
 
 	// Fetch the ImagePolicy.
@@ -211,11 +278,13 @@ func composeImagePolicyReadyMessage(previousTag, latestTag, image string) string
 func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialPatcher, obj *imagev1.ImagePolicy) (result ctrl.Result, retErr error) {
 	oldObj := obj.DeepCopy()
 
-	var resultImage, resultTag, previousTag string
+	var resultImage, resultTag, previousTag, pendingTag string
+	var requeueAfter time.Duration
 
 	// If there's no error and no requeue is requested, it's a success. Unlike
-	// other reconcilers, this reconciler doesn't requeue on its own with a
-	// RequeueAfter value.
+	// other reconcilers, this reconciler requeues on its own with a
+	// RequeueAfter value only to promote a pending image when the next
+	// promotion window opens.
 	isSuccess := func(res ctrl.Result, err error) bool {
 		if err != nil || res.Requeue {
 			return false
@@ -225,6 +294,9 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 
 	defer func() {
 		readyMsg := composeImagePolicyReadyMessage(previousTag, resultTag, resultImage)
+		if resultTag == "" && pendingTag != "" {
+			readyMsg = fmt.Sprintf("Latest image tag for '%s' is pending promotion of %s", resultImage, pendingTag)
+		}
 
 		rs := pkgreconcile.NewResultFinalizer(isSuccess, readyMsg)
 		retErr = rs.Finalize(obj, result, retErr)
@@ -256,9 +328,19 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 
 	// Cleanup the last result.
 	obj.Status.LatestImage = ""
-
-	// Get ImageRepository from reference.
-	repo, err := r.getImageRepository(ctx, obj)
+	obj.Status.LatestImageRepositoryRef = nil
+	obj.Status.LatestImages = nil
+	obj.Status.Candidates = nil
+	obj.Status.Explanation = nil
+	obj.Status.ResolvedPolicy = ""
+	obj.Status.SkippedTagCount = 0
+	obj.Status.PendingImage = ""
+
+	// Anchor the relative SemVer ranges, if any, before the evaluation.
+	obj.Status.SemVerBaseline = semverBaseline(oldObj)
+
+	// Get the ImageRepositories from references and selector.
+	repos, err := r.getImageRepositories(ctx, obj)
 	if err != nil {
 		reason := metav1.StatusFailure
 		if _, ok := err.(errAccessDenied); ok {
@@ -279,12 +361,47 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 		return
 	}
 
-	// Proceed only if the ImageRepository has scan result.
-	if repo.Status.LastScanResult == nil {
-		// Mark not ready but don't requeue. When the repository becomes ready,
-		// it'll trigger a policy reconciliation. No runtime error to prevent
-		// requeue.
-		conditions.MarkFalse(obj, meta.ReadyCondition, imagev1.DependencyNotReadyReason, "referenced ImageRepository has not been scanned yet")
+	// Proceed only if the ImageRepositories have scan result.
+	for _, repo := range repos {
+		if repo.Status.LastScanResult == nil {
+			// Mark not ready but don't requeue. When the repository becomes
+			// ready, it'll trigger a policy reconciliation. No runtime error to
+			// prevent requeue.
+			msg := "referenced ImageRepository has not been scanned yet"
+			if len(repos) > 1 {
+				msg = fmt.Sprintf("referenced ImageRepository '%s/%s' has not been scanned yet", repo.Namespace, repo.Name)
+			}
+			conditions.MarkFalse(obj, meta.ReadyCondition, imagev1.DependencyNotReadyReason, msg)
+			result, retErr = ctrl.Result{}, nil
+			return
+		}
+	}
+
+	// Get the upstream ImagePolicy the images are promoted from, if any.
+	var upstream *imagev1.ImagePolicy
+	if obj.Spec.PromotedFrom != nil {
+		upstream, err = r.getUpstreamImagePolicy(ctx, obj)
+		if err != nil {
+			reason := metav1.StatusFailure
+			if _, ok := err.(errAccessDenied); ok {
+				reason = aclapi.AccessDeniedReason
+			}
+
+			if apierrors.IsNotFound(err) {
+				reason = imagev1.DependencyNotReadyReason
+			}
+
+			e := fmt.Errorf("failed to get the upstream ImagePolicy: %w", err)
+			conditions.MarkFalse(obj, meta.ReadyCondition, reason, e.Error())
+			result, retErr = ctrl.Result{}, e
+			return
+		}
+	}
+
+	// Stall if the promotion windows are invalid.
+	windows, err := schedule.WindowsFromSpec(obj.Spec.PromotionWindows)
+	if err != nil {
+		conditions.MarkStalled(obj, "InvalidPolicy", err.Error())
 		result, retErr = ctrl.Result{}, nil
 		return
 	}
@@ -292,7 +409,16 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 	// Construct a policer from the spec.policy.
 	// Read the tags from database and use the policy to obtain a result for the
 	// latest tag.
-	latest, err := r.applyPolicy(ctx, obj, repo)
+	res, err := r.applyPolicy(ctx, obj, repos)
+
+	// Summarize the verdicts of the policy on the tags, also when the policy
+	// failed to determine a latest tag.
+	if obj.Spec.Explain {
+		if e, err := r.explainPolicy(obj, repos, 1); err == nil {
+			obj.Status.Explanation = explanationSummary(e)
+		}
+	}
+
 	if err != nil {
 		// Stall if it's an invalid policy.
 		if _, ok := err.(errInvalidPolicy); ok {
@@ -314,7 +440,111 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 	}
 
 	// Write the observations on status.
-	obj.Status.LatestImage = repo.Spec.Image + ":" + latest
+	repo := repos[res.repository]
+	obj.Status.LatestImage = repo.Spec.Image + ":" + res.latest
+	obj.Status.LatestImageRepositoryRef = &meta.NamespacedObjectReference{
+		Name:      repo.Name,
+		Namespace: repo.Namespace,
+	}
+	obj.Status.LatestImages = res.latestImages
+	obj.Status.Candidates = res.candidates
+	obj.Status.ResolvedPolicy = resolvedPolicyPath(res.policyIndex)
+	obj.Status.SkippedTagCount = res.skipped
+
+	// Keep the current latest image if the result orders below it and
+	// downgrades aren't allowed.
+	images := make([]string, len(repos))
+	for i, repo := range repos {
+		images[i] = repo.Spec.Image
+	}
+	if prevTag, ok := downgradeFrom(oldObj, images, res.latest); ok {
+		conditions.MarkTrue(obj, imagev1.DowngradePreventedCondition, imagev1.LowerLatestImageReason,
+			"latest image tag for '%s' resolved to %s which orders below the current tag %s", repo.Spec.Image, res.latest, prevTag)
+		keepLatestImage(obj, oldObj, repos)
+	} else {
+		conditions.Delete(obj, imagev1.DowngradePreventedCondition)
+	}
+
+	// Hold the new latest image back as pending until it's eligible for
+	// promotion from the upstream ImagePolicy, if any.
+	now := time.Now()
+	conditions.Delete(obj, imagev1.AwaitingUpstreamPromotionCondition)
+	if upstream != nil && obj.Status.LatestImage != promotedImage(oldObj) {
+		if eligible, wait := promotionEligible(upstream, obj.Spec.PromotedFrom.MinDuration, obj.Status.LatestImage, now); !eligible {
+			obj.Status.PendingImage = obj.Status.LatestImage
+			conditions.MarkTrue(obj, imagev1.AwaitingUpstreamPromotionCondition, imagev1.UpstreamNotPromotedReason,
+				"image %s is pending until it's eligible for promotion from %s '%s/%s'",
+				obj.Status.PendingImage, imagev1.ImagePolicyKind, upstream.Namespace, upstream.Name)
+			keepLatestImage(obj, oldObj, repos)
+			requeueAfter = soonest(requeueAfter, wait)
+
+			// Promote the best image the upstream ImagePolicy held long
+			// enough instead, e.g. when it moves faster than the minimum
+			// duration.
+			if c, ok := eligibleImage(oldObj, upstream, images, res.ranked, now); ok {
+				obj.Status.LatestImage = c.image
+				obj.Status.LatestImageRepositoryRef = &meta.NamespacedObjectReference{
+					Name:      repos[c.repository].Name,
+					Namespace: repos[c.repository].Namespace,
+				}
+			}
+		}
+	}
+
+	// Hold the new latest image back as pending until it's stable, if
+	// stabilization is required.
+	if obj.Spec.Stabilization != nil {
+		var stable bool
+		var wait time.Duration
+		obj.Status.Stabilization, stable, wait = stabilize(oldObj, obj.Status.LatestImage, lastScanTime(repos), now)
+		if !stable {
+			obj.Status.PendingImage = obj.Status.LatestImage
+			keepLatestImage(obj, oldObj, repos)
+			requeueAfter = soonest(requeueAfter, wait)
+		}
+	} else {
+		obj.Status.Stabilization = nil
+	}
+
+	// Hold the new latest image back as pending until it's approved, if
+	// approval is required.
+	var digest string
+	if obj.Spec.RequireApproval {
+		if digest, err = r.imageDigest(obj.Status.LatestImage, repos); err != nil {
+			conditions.MarkFalse(obj, meta.ReadyCondition, metav1.StatusFailure, err.Error())
+			result, retErr = ctrl.Result{}, err
+			return
+		}
+	}
+	if awaitingApproval(oldObj, obj.Status.LatestImage, digest) {
+		obj.Status.PendingImage = obj.Status.LatestImage
+		conditions.MarkTrue(obj, imagev1.AwaitingApprovalCondition, imagev1.ApprovalRequiredReason,
+			"image %s is awaiting approval, annotate the object with %s set to the image tag or digest to promote it",
+			obj.Status.PendingImage, imagev1.ApprovedImageAnnotation)
+		keepLatestImage(obj, oldObj, repos)
+	} else {
+		conditions.Delete(obj, imagev1.AwaitingApprovalCondition)
+	}
+
+	// Hold the new latest image back as pending until the next promotion
+	// window opens, if outside the promotion windows.
+	conditions.Delete(obj, imagev1.PromotionWindowClosedCondition)
+	if obj.Status.LatestImage != promotedImage(oldObj) && len(windows) > 0 {
+		if open, next := schedule.Open(windows, now); !open {
+			obj.Status.PendingImage = obj.Status.LatestImage
+			conditions.MarkTrue(obj, imagev1.PromotionWindowClosedCondition, imagev1.OutsidePromotionWindowReason,
+				"image %s is pending until the next promotion window opens at %s",
+				obj.Status.PendingImage, next.Format(time.RFC3339))
+			keepLatestImage(obj, oldObj, repos)
+			requeueAfter = soonest(requeueAfter, next.Sub(now))
+		}
+	}
+
+	// Drop the stabilization state once the stable candidate is promoted.
+	if st := obj.Status.Stabilization; st != nil && st.Candidate == obj.Status.LatestImage {
+		obj.Status.Stabilization = nil
+	}
+
 	// If the old latest image and new latest image don't match, set the old
 	// image as the observed previous image.
 	// NOTE: The following allows the previous image to be set empty when
@@ -336,27 +566,83 @@ func (r *ImagePolicyReconciler) reconcile(ctx context.Context, sp *patch.SerialP
 		previousTag = prevRef.TagStr()
 	}
 
+	// Record the promotion of a new latest image.
+	if obj.Status.LatestImage != "" &&
+		(obj.Status.LastPromotion == nil || obj.Status.LastPromotion.Image != obj.Status.LatestImage) {
+		promotion := imagev1.Promotion{
+			Image: obj.Status.LatestImage,
+			Time:  metav1.NewTime(now),
+		}
+		obj.Status.LastPromotion = &promotion
+		obj.Status.PromotionHistory = append([]imagev1.Promotion{promotion}, promotionHistory(oldObj)...)
+		if len(obj.Status.PromotionHistory) > maxPromotionHistory {
+			obj.Status.PromotionHistory = obj.Status.PromotionHistory[:maxPromotionHistory]
+		}
+	}
+
 	resultImage = repo.Spec.Image
-	resultTag = latest
+	if obj.Status.LatestImage != "" {
+		resultImage = imageName(obj.Status.LatestImage)
+	}
+	resultTag = imageTag(obj.Status.LatestImage)
+	pendingTag = imageTag(obj.Status.PendingImage)
 
 	conditions.Delete(obj, meta.ReadyCondition)
 
-	result, retErr = ctrl.Result{}, nil
+	result, retErr = ctrl.Result{RequeueAfter: requeueAfter}, nil
 	return
 }
 
-// getImageRepository tries to fetch an ImageRepository referenced by the given
-// ImagePolicy if it's accessible.
-func (r *ImagePolicyReconciler) getImageRepository(ctx context.Context, obj *imagev1.ImagePolicy) (*imagev1.ImageRepository, error) {
-	repo := &imagev1.ImageRepository{}
-	repoNamespacedName := types.NamespacedName{
-		Namespace: obj.Namespace,
-		Name:      obj.Spec.ImageRepositoryRef.Name,
+// getImageRepositories tries to fetch all the ImageRepositories referenced or
+// selected by the given ImagePolicy if they're accessible. The ImageRepository
+// referenced by ImageRepositoryRef comes first, followed by the ones referenced
+// by ImageRepositoryRefs in order, and the selected ones ordered by name.
+func (r *ImagePolicyReconciler) getImageRepositories(ctx context.Context, obj *imagev1.ImagePolicy) ([]*imagev1.ImageRepository, error) {
+	var repos []*imagev1.ImageRepository
+	seen := map[types.NamespacedName]bool{}
+	add := func(repo *imagev1.ImageRepository) {
+		key := types.NamespacedName{Namespace: repo.Namespace, Name: repo.Name}
+		if !seen[key] {
+			seen[key] = true
+			repos = append(repos, repo)
+		}
+	}
+
+	refs := append([]meta.NamespacedObjectReference{obj.Spec.ImageRepositoryRef}, obj.Spec.ImageRepositoryRefs...)
+	for _, ref := range refs {
+		repo, err := r.getImageRepositoryFromRef(ctx, obj, ref)
+		if err != nil {
+			return nil, err
+		}
+		add(repo)
 	}
-	if obj.Spec.ImageRepositoryRef.Namespace != "" {
-		repoNamespacedName.Namespace = obj.Spec.ImageRepositoryRef.Namespace
+
+	if obj.Spec.ImageRepositorySelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(obj.Spec.ImageRepositorySelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ImageRepository selector: %w", err)
+		}
+		var list imagev1.ImageRepositoryList
+		if err := r.List(ctx, &list, client.InNamespace(obj.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("failed to list the selected ImageRepositories: %w", err)
+		}
+		sort.Slice(list.Items, func(i, j int) bool {
+			return list.Items[i].Name < list.Items[j].Name
+		})
+		for i := range list.Items {
+			add(&list.Items[i])
+		}
 	}
 
+	return repos, nil
+}
+
+// getImageRepositoryFromRef tries to fetch the ImageRepository referenced by
+// the given reference of the given ImagePolicy if it's accessible.
+func (r *ImagePolicyReconciler) getImageRepositoryFromRef(ctx context.Context, obj *imagev1.ImagePolicy, ref meta.NamespacedObjectReference) (*imagev1.ImageRepository, error) {
+	repo := &imagev1.ImageRepository{}
+	repoNamespacedName := imageRepositoryNamespacedName(obj, ref)
+
 	// If NoCrossNamespaceRefs is true and ImageRepository and ImagePolicy are
 	// in different namespaces, the ImageRepository can't be accessed.
 	if r.ACLOptions.NoCrossNamespaceRefs && repoNamespacedName.Namespace != obj.GetNamespace() {
@@ -381,41 +667,665 @@ func (r *ImagePolicyReconciler) getImageRepository(ctx context.Context, obj *ima
 	return repo, nil
 }
 
-// applyPolicy reads the tags of the given repository from the internal database
-// and applies the tag filters and constraints to return the latest image.
-func (r *ImagePolicyReconciler) applyPolicy(ctx context.Context, obj *imagev1.ImagePolicy, repo *imagev1.ImageRepository) (string, error) {
-	policer, err := policy.PolicerFromSpec(obj.Spec.Policy)
+// imageRepositoryNamespacedName returns the namespaced name of the
+// ImageRepository referenced by the given reference of the given ImagePolicy.
+func imageRepositoryNamespacedName(obj *imagev1.ImagePolicy, ref meta.NamespacedObjectReference) types.NamespacedName {
+	namespacedName := types.NamespacedName{
+		Namespace: obj.GetNamespace(),
+		Name:      ref.Name,
+	}
+	if ref.Namespace != "" {
+		namespacedName.Namespace = ref.Namespace
+	}
+	return namespacedName
+}
+
+// lastScanTime returns the time of the last scan of the given
+// ImageRepositories.
+func lastScanTime(repos []*imagev1.ImageRepository) metav1.Time {
+	var t metav1.Time
+	for _, repo := range repos {
+		if s := repo.Status.LastScanResult; s != nil && t.Before(&s.ScanTime) {
+			t = s.ScanTime
+		}
+	}
+	return t
+}
+
+// getUpstreamImagePolicy tries to fetch the upstream ImagePolicy referenced by
+// the promotedFrom field of the given ImagePolicy if it's accessible.
+func (r *ImagePolicyReconciler) getUpstreamImagePolicy(ctx context.Context, obj *imagev1.ImagePolicy) (*imagev1.ImagePolicy, error) {
+	upstream := &imagev1.ImagePolicy{}
+	ref := obj.Spec.PromotedFrom.PolicyRef
+	upstreamNamespacedName := types.NamespacedName{
+		Namespace: obj.Namespace,
+		Name:      ref.Name,
+	}
+	if ref.Namespace != "" {
+		upstreamNamespacedName.Namespace = ref.Namespace
+	}
+
+	// If NoCrossNamespaceRefs is true and the ImagePolicies are in different
+	// namespaces, the upstream ImagePolicy can't be accessed.
+	if r.ACLOptions.NoCrossNamespaceRefs && upstreamNamespacedName.Namespace != obj.GetNamespace() {
+		return nil, errAccessDenied{
+			err: fmt.Errorf("cannot access '%s/%s', cross-namespace references have been blocked", imagev1.ImagePolicyKind, upstreamNamespacedName),
+		}
+	}
+
+	// Get the upstream ImagePolicy.
+	if err := r.Get(ctx, upstreamNamespacedName, upstream); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return nil, fmt.Errorf("referenced %s does not exist: %w", imagev1.ImagePolicyKind, err)
+		}
+		return nil, err
+	}
+
+	// Check if the upstream ImagePolicy allows access to ImagePolicy.
+	aclAuth := acl.NewAuthorization(r.Client)
+	if err := aclAuth.HasAccessToRef(ctx, obj, upstreamNamespacedName, upstream.Spec.AccessFrom); err != nil {
+		return nil, errAccessDenied{err: fmt.Errorf("access denied: %w", err)}
+	}
+
+	return upstream, nil
+}
+
+// maxPromotionHistory is the number of promotions recorded in the promotion
+// history of an ImagePolicy.
+const maxPromotionHistory = 10
+
+// promotionEligible returns true if the given candidate image is eligible for
+// promotion from the given upstream ImagePolicy at the given time, i.e. if the
+// upstream ImagePolicy held an image with the same tag as the candidate as
+// latest image for at least the given minimum duration, according to its
+// promotion history. If the candidate is the upstream latest image and the
+// minimum duration isn't reached yet, the remaining time is returned.
+func promotionEligible(upstream *imagev1.ImagePolicy, minDuration *metav1.Duration, candidate string, now time.Time) (bool, time.Duration) {
+	tag := imageTag(candidate)
+	if tag == "" {
+		return false, 0
+	}
+	var min time.Duration
+	if minDuration != nil {
+		min = minDuration.Duration
+	}
+	current := imageTag(promotedImage(upstream)) == tag
+	if current && min == 0 {
+		return true, 0
+	}
+
+	history := promotionHistory(upstream)
+	for i, promotion := range history {
+		if imageTag(promotion.Image) != tag {
+			continue
+		}
+		// The image was held until the next promotion, if any.
+		until := now
+		if i > 0 {
+			until = history[i-1].Time.Time
+		}
+		if held := until.Sub(promotion.Time.Time); held >= min {
+			return true, 0
+		} else if i == 0 && current {
+			return false, min - held
+		}
+	}
+	// The promotion of the upstream latest image isn't recorded until the
+	// upstream ImagePolicy is reconciled.
+	if current {
+		return false, min
+	}
+	return false, 0
+}
+
+// promotionHistory returns the promotion history of the given ImagePolicy, the
+// most recent promotion first.
+func promotionHistory(obj *imagev1.ImagePolicy) []imagev1.Promotion {
+	if len(obj.Status.PromotionHistory) > 0 {
+		return obj.Status.PromotionHistory
+	}
+	// The history isn't recorded by the previous versions.
+	if obj.Status.LastPromotion != nil {
+		return []imagev1.Promotion{*obj.Status.LastPromotion}
+	}
+	return nil
+}
+
+// eligibleImage returns the highest ranked of the given images that's eligible
+// for promotion from the given upstream ImagePolicy at the given time, and
+// that orders above the promoted image of the given ImagePolicy.
+func eligibleImage(obj, upstream *imagev1.ImagePolicy, images []string, ranked []rankedImage, now time.Time) (rankedImage, bool) {
+	promoted := promotedImage(obj)
+	for _, c := range ranked {
+		if c.image == promoted {
+			break
+		}
+		if _, downgrade := downgradeFrom(obj, images, imageTag(c.image)); downgrade {
+			break
+		}
+		if eligible, _ := promotionEligible(upstream, obj.Spec.PromotedFrom.MinDuration, c.image, now); eligible {
+			return c, true
+		}
+	}
+	return rankedImage{}, false
+}
+
+// policyResult is the result of applying an ImagePolicy to the tags of its
+// ImageRepository.
+type policyResult struct {
+	// latest is the latest tag.
+	latest string
+	// policyIndex is the index of the policy in the fallback chain that
+	// determined the latest tag, 0 being the primary policy.
+	policyIndex int
+	// skipped is the number of tags the policy skipped because they couldn't
+	// be parsed.
+	skipped int
+	// repository is the index of the ImageRepository the latest tag was
+	// selected from.
+	repository int
+	// latestImages maps each group of tags to its latest image, when the
+	// policy groups the tags.
+	latestImages map[string]string
+	// candidates is the list of the top ranked images, when the ImagePolicy
+	// has a candidates limit.
+	candidates []imagev1.Candidate
+	// ranked is the list of the images ranked by the policy from the latest,
+	// when the ImagePolicy is promoted from an upstream ImagePolicy.
+	ranked []rankedImage
+}
+
+// rankedImage is an image ranked by the policy of an ImagePolicy.
+type rankedImage struct {
+	// image is the image reference.
+	image string
+	// repository is the index of the ImageRepository of the image.
+	repository int
+}
+
+// applyPolicy reads the tags of the given repositories from the internal
+// database and applies the tag filters and constraints to return the latest
+// image across their combined tags. When several repositories have the latest
+// tag, the first one is selected.
+func (r *ImagePolicyReconciler) applyPolicy(ctx context.Context, obj *imagev1.ImagePolicy, repos []*imagev1.ImageRepository) (policyResult, error) {
+	choice := withSemVerBaseline(obj.Spec.Policy, obj.Status.SemVerBaseline)
+	policer, err := policy.PolicerFromSpec(choice, obj.Spec.FilterTags)
+	if err != nil {
+		return policyResult{}, errInvalidPolicy{err: fmt.Errorf("invalid policy: %w", err)}
+	}
+	groupPolicer, grouper, err := policy.GroupingFromSpec(choice, obj.Spec.FilterTags)
 	if err != nil {
-		return "", errInvalidPolicy{err: fmt.Errorf("invalid policy: %w", err)}
+		return policyResult{}, errInvalidPolicy{err: fmt.Errorf("invalid policy: %w", err)}
 	}
 
 	// Read tags from database, apply and filter is configured and compute the
 	// result.
-	tags, err := r.Database.Tags(repo.Status.CanonicalImageName)
+	tags, tagRepos, err := r.readTags(repos)
 	if err != nil {
-		return "", fmt.Errorf("failed to read tags from database: %w", err)
+		return policyResult{}, err
 	}
 
 	if len(tags) == 0 {
-		return "", errNoTagsInDatabase
+		return policyResult{}, errNoTagsInDatabase
 	}
 
 	// Apply tag filter.
+	unfiltered := tags
+	original := func(tag string) string { return tag }
 	if obj.Spec.FilterTags != nil {
 		filter, err := policy.NewRegexFilter(obj.Spec.FilterTags.Pattern, obj.Spec.FilterTags.Extract)
 		if err != nil {
-			return "", errInvalidPolicy{err: fmt.Errorf("failed to filter tags: %w", err)}
+			return policyResult{}, errInvalidPolicy{err: fmt.Errorf("failed to filter tags: %w", err)}
 		}
 		filter.Apply(tags)
 		tags = filter.Items()
-		latest, err := policer.Latest(tags)
+		original = filter.GetOriginalTag
+	}
+	// A fallback chain applies the filters of its policies itself.
+	policyTags, policyOriginal := tags, original
+	if _, ok := policer.(*policy.Chain); ok {
+		policyTags, policyOriginal = unfiltered, func(tag string) string { return tag }
+	}
+	// Compute and return result.
+	result, err := evaluatePolicy(policer, policyTags)
+	if err != nil {
+		return policyResult{}, err
+	}
+	result.latest = policyOriginal(result.latest)
+	result.repository = tagRepos[result.latest]
+
+	// Compute the latest image of each group.
+	if grouper != nil {
+		latest := policy.LatestPerGroup(groupPolicer, tags, original, grouper)
+		result.latestImages = make(map[string]string, len(latest))
+		for group, tag := range latest {
+			tag = original(tag)
+			result.latestImages[group] = repos[tagRepos[tag]].Spec.Image + ":" + tag
+		}
+	}
+
+	// Rank the images promoted from an upstream ImagePolicy, for the best
+	// eligible one to be promoted when the latest one isn't.
+	if obj.Spec.PromotedFrom != nil {
+		ranked, err := policer.Rank(policyTags)
 		if err != nil {
-			return "", err
+			return policyResult{}, err
+		}
+		for _, tag := range ranked {
+			tag = policyOriginal(tag)
+			i := tagRepos[tag]
+			result.ranked = append(result.ranked, rankedImage{image: repos[i].Spec.Image + ":" + tag, repository: i})
 		}
-		return filter.GetOriginalTag(latest), nil
 	}
-	// Compute and return result.
-	return policer.Latest(tags)
+
+	// Rank the top candidates, with their digests when the database records
+	// them.
+	if limit := obj.Spec.CandidatesLimit; limit > 0 {
+		ranked, err := policer.Rank(policyTags)
+		if err != nil {
+			return policyResult{}, err
+		}
+		if len(ranked) > limit {
+			ranked = ranked[:limit]
+		}
+		digests := map[int]map[string]string{}
+		for _, tag := range ranked {
+			tag = policyOriginal(tag)
+			i := tagRepos[tag]
+			candidate := imagev1.Candidate{Image: repos[i].Spec.Image + ":" + tag}
+			if dr, ok := r.Database.(DigestReader); ok {
+				if _, ok := digests[i]; !ok {
+					if digests[i], err = dr.Digests(tagsKey(repos[i], r.SharedTagsDatabase)); err != nil {
+						return policyResult{}, fmt.Errorf("failed to read digests from database: %w", err)
+					}
+				}
+				candidate.Digest = digests[i][tag]
+			}
+			result.candidates = append(result.candidates, candidate)
+		}
+	}
+	return result, nil
+}
+
+// readTags reads the combined tags of the given ImageRepositories from the
+// database, along with the index of the first ImageRepository of each tag.
+func (r *ImagePolicyReconciler) readTags(repos []*imagev1.ImageRepository) ([]string, map[string]int, error) {
+	var tags []string
+	tagRepos := map[string]int{}
+	for i, repo := range repos {
+		repoTags, err := r.Database.Tags(tagsKey(repo, r.SharedTagsDatabase))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tags from database: %w", err)
+		}
+		for _, tag := range repoTags {
+			if _, ok := tagRepos[tag]; !ok {
+				tagRepos[tag] = i
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, tagRepos, nil
+}
+
+// explainPolicy evaluates the tags of the given ImageRepositories with the
+// policy of the given ImagePolicy and records the verdict on each tag. At most
+// sample tags are recorded, all of them when sample isn't positive.
+func (r *ImagePolicyReconciler) explainPolicy(obj *imagev1.ImagePolicy, repos []*imagev1.ImageRepository, sample int) (*policy.Explanation, error) {
+	choice := withSemVerBaseline(obj.Spec.Policy, obj.Status.SemVerBaseline)
+	policer, err := policy.PolicerFromSpec(choice, obj.Spec.FilterTags)
+	if err != nil {
+		return nil, errInvalidPolicy{err: fmt.Errorf("invalid policy: %w", err)}
+	}
+	var filter *policy.RegexFilter
+	if obj.Spec.FilterTags != nil {
+		filter, err = policy.NewRegexFilter(obj.Spec.FilterTags.Pattern, obj.Spec.FilterTags.Extract)
+		if err != nil {
+			return nil, errInvalidPolicy{err: fmt.Errorf("failed to filter tags: %w", err)}
+		}
+	}
+	tags, _, err := r.readTags(repos)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Explain(policer, filter, tags, sample), nil
+}
+
+// explanationSummary returns the number of tags of each verdict of the given
+// explanation.
+func explanationSummary(e *policy.Explanation) *imagev1.Explanation {
+	s := &imagev1.Explanation{
+		Selected:   e.Counts[policy.VerdictSelected],
+		Outranked:  e.Counts[policy.VerdictOutranked],
+		OutOfRange: e.Counts[policy.VerdictOutOfRange],
+		Unparsable: e.Counts[policy.VerdictUnparsable],
+		Filtered:   e.Counts[policy.VerdictFiltered],
+	}
+	for _, n := range e.Counts {
+		s.Tags += n
+	}
+	return s
+}
+
+// evaluatePolicy returns the latest version determined by the given policer,
+// along with the details of the evaluation when the policer supports them.
+func evaluatePolicy(policer policy.Policer, tags []string) (policyResult, error) {
+	var result policyResult
+	var err error
+	if chain, ok := policer.(*policy.Chain); ok {
+		result.latest, result.policyIndex, err = chain.LatestWithIndex(tags)
+	} else {
+		result.latest, err = policer.Latest(tags)
+	}
+	if err != nil {
+		return policyResult{}, err
+	}
+	if sc, ok := policer.(policy.SkipCounter); ok {
+		result.skipped = sc.Skipped()
+	}
+	return result, nil
+}
+
+// downgradeFrom returns the tag of the promoted image of the given
+// ImagePolicy and true if downgrades aren't allowed and the given latest tag
+// orders below it. The promoted image must be one of the given images. Tags
+// that can't be compared by the policy, e.g. after a change of the policy,
+// aren't considered a downgrade.
+func downgradeFrom(obj *imagev1.ImagePolicy, images []string, latestTag string) (string, bool) {
+	if obj.Spec.AllowDowngrade == nil || *obj.Spec.AllowDowngrade {
+		return "", false
+	}
+	current := promotedImage(obj)
+	if current == "" {
+		return "", false
+	}
+	ref, err := name.NewTag(current)
+	if err != nil {
+		return "", false
+	}
+	// Only the tags of the referenced images can be compared.
+	prevTag := ref.TagStr()
+	if prevTag == latestTag {
+		return "", false
+	}
+	referenced := false
+	for _, image := range images {
+		if current == image+":"+prevTag {
+			referenced = true
+			break
+		}
+	}
+	if !referenced {
+		return "", false
+	}
+
+	choice := withSemVerBaseline(obj.Spec.Policy, obj.Status.SemVerBaseline)
+	policer, err := policy.PolicerFromSpec(choice, obj.Spec.FilterTags)
+	if err != nil {
+		return "", false
+	}
+	tags := []string{prevTag, latestTag}
+	var filter *policy.RegexFilter
+	// A fallback chain applies the filters of its policies itself.
+	if _, ok := policer.(*policy.Chain); !ok && obj.Spec.FilterTags != nil {
+		filter, err = policy.NewRegexFilter(obj.Spec.FilterTags.Pattern, obj.Spec.FilterTags.Extract)
+		if err != nil {
+			return "", false
+		}
+		filter.Apply(tags)
+		tags = filter.Items()
+		if len(tags) != 2 {
+			return "", false
+		}
+	}
+	latest, err := policer.Latest(tags)
+	if err != nil {
+		return "", false
+	}
+	if filter != nil {
+		latest = filter.GetOriginalTag(latest)
+	}
+	return prevTag, latest == prevTag
+}
+
+// stabilize returns the stabilization state of the given candidate image of the
+// given ImagePolicy after an ImageRepository scan at the given time, and true
+// if the candidate is stable. A candidate is stable when it's the promoted
+// image, or when it was computed as latest image for the required number of
+// consecutive scans and duration. If the duration isn't reached yet, the
+// remaining time is returned. The state of a stable candidate is kept until
+// it's promoted or replaced, e.g. while held back by the other gates.
+func stabilize(obj *imagev1.ImagePolicy, candidate string, scanTime metav1.Time, now time.Time) (*imagev1.StabilizationStatus, bool, time.Duration) {
+	if candidate == promotedImage(obj) {
+		return nil, true, 0
+	}
+
+	st := obj.Status.Stabilization.DeepCopy()
+	if st == nil || st.Candidate != candidate {
+		st = &imagev1.StabilizationStatus{
+			Candidate:         candidate,
+			FirstObservedTime: metav1.NewTime(now),
+			Scans:             1,
+			LastScanTime:      scanTime,
+		}
+	} else if st.LastScanTime.Unix() != scanTime.Unix() {
+		// The status times have a precision of seconds.
+		st.Scans++
+		st.LastScanTime = scanTime
+	}
+
+	spec := obj.Spec.Stabilization
+	if st.Scans < spec.Scans {
+		return st, false, 0
+	}
+	if spec.Duration != nil {
+		if elapsed := now.Sub(st.FirstObservedTime.Time); elapsed < spec.Duration.Duration {
+			return st, false, spec.Duration.Duration - elapsed
+		}
+	}
+	return st, true, 0
+}
+
+// soonest returns the shortest of the given non-zero requeue delays, zero if
+// none.
+func soonest(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// keepLatestImage restores the latest image of the old object, along with the
+// details of its evaluation, on the new object. When a failure reset the
+// latest image of the old object, its promoted image is restored instead,
+// referencing the first of the given ImageRepositories of the image, if any.
+func keepLatestImage(obj, oldObj *imagev1.ImagePolicy, repos []*imagev1.ImageRepository) {
+	if oldObj.Status.LatestImage == "" {
+		obj.Status.LatestImage = ""
+		obj.Status.LatestImageRepositoryRef = nil
+		obj.Status.ResolvedPolicy = ""
+		obj.Status.SkippedTagCount = 0
+		promoted := promotedImage(oldObj)
+		for _, repo := range repos {
+			if promoted != "" && repo.Spec.Image == imageName(promoted) {
+				obj.Status.LatestImage = promoted
+				obj.Status.LatestImageRepositoryRef = &meta.NamespacedObjectReference{
+					Name:      repo.Name,
+					Namespace: repo.Namespace,
+				}
+				break
+			}
+		}
+		return
+	}
+	obj.Status.LatestImage = oldObj.Status.LatestImage
+	obj.Status.LatestImageRepositoryRef = oldObj.Status.LatestImageRepositoryRef
+	obj.Status.ResolvedPolicy = oldObj.Status.ResolvedPolicy
+	obj.Status.SkippedTagCount = oldObj.Status.SkippedTagCount
+}
+
+// promotedImage returns the image last promoted as latest image by the given
+// ImagePolicy. Unlike the latest image, which is reset by the failures of the
+// reconciliation, the promotion record survives them.
+func promotedImage(obj *imagev1.ImagePolicy) string {
+	if obj.Status.LatestImage != "" {
+		return obj.Status.LatestImage
+	}
+	if p := obj.Status.LastPromotion; p != nil {
+		return p.Image
+	}
+	return ""
+}
+
+// awaitingApproval returns true if the given ImagePolicy requires approval and
+// the given candidate image is neither its current latest image nor approved
+// by the approval annotation. The annotation approves an image by its tag, its
+// full reference, or its digest, optionally prefixed with `@` or the image
+// name and `@`. An approval by digest requires the digest of the candidate.
+func awaitingApproval(obj *imagev1.ImagePolicy, candidate, digest string) bool {
+	if !obj.Spec.RequireApproval || candidate == promotedImage(obj) {
+		return false
+	}
+	approved, ok := obj.GetAnnotations()[imagev1.ApprovedImageAnnotation]
+	if !ok || approved == "" {
+		return true
+	}
+	if approved == candidate || approved == imageTag(candidate) {
+		return false
+	}
+	if digest == "" {
+		return true
+	}
+	if i := strings.LastIndex(approved, "@"); i >= 0 {
+		if ref := approved[:i]; ref != "" && ref != candidate && ref != imageName(candidate) {
+			return true
+		}
+		approved = approved[i+1:]
+	}
+	return approved != digest
+}
+
+// imageDigest returns the digest recorded in the database for the given image
+// of one of the given ImageRepositories, or an empty string if it's unknown.
+func (r *ImagePolicyReconciler) imageDigest(image string, repos []*imagev1.ImageRepository) (string, error) {
+	dr, ok := r.Database.(DigestReader)
+	if !ok {
+		return "", nil
+	}
+	name, tag := imageName(image), imageTag(image)
+	for _, repo := range repos {
+		if repo.Spec.Image != name {
+			continue
+		}
+		digests, err := dr.Digests(tagsKey(repo, r.SharedTagsDatabase))
+		if err != nil {
+			return "", fmt.Errorf("failed to read digests from database: %w", err)
+		}
+		if d, ok := digests[tag]; ok {
+			return d, nil
+		}
+	}
+	return "", nil
+}
+
+// imageName returns the image reference without the tag, or the given
+// reference if it can't be parsed.
+func imageName(image string) string {
+	if tag := imageTag(image); tag != "" {
+		return strings.TrimSuffix(image, ":"+tag)
+	}
+	return image
+}
+
+// imageTag returns the tag of the given image reference, or an empty string if
+// it can't be parsed.
+func imageTag(image string) string {
+	if image == "" {
+		return ""
+	}
+	ref, err := name.NewTag(image)
+	if err != nil {
+		return ""
+	}
+	return ref.TagStr()
+}
+
+// semverBaseline returns the version the relative SemVer ranges of the given
+// ImagePolicy are anchored to. It's the baseline pinned by spec.policy.semver
+// if any, else the tag of the promoted image, which survives the failures. When
+// its tag isn't a version, the last observed baseline is kept. It returns an
+// empty string when the policy has no relative SemVer range.
+func semverBaseline(obj *imagev1.ImagePolicy) string {
+	relative := false
+	for _, s := range semverPolicies(&obj.Spec.Policy) {
+		if s.Relative != nil {
+			relative = true
+			break
+		}
+	}
+	if !relative {
+		return ""
+	}
+	if s := obj.Spec.Policy.SemVer; s != nil && s.Relative != nil && s.Relative.Baseline != "" {
+		return s.Relative.Baseline
+	}
+
+	if current := promotedImage(obj); current != "" {
+		if ref, err := name.NewTag(current); err == nil {
+			tag := ref.TagStr()
+			// The policy is applied to the extracted values of the tags.
+			if obj.Spec.FilterTags != nil {
+				if filter, err := policy.NewRegexFilter(obj.Spec.FilterTags.Pattern, obj.Spec.FilterTags.Extract); err == nil {
+					filter.Apply([]string{tag})
+					if items := filter.Items(); len(items) == 1 {
+						tag = items[0]
+					}
+				}
+			}
+			if _, err := version.ParseVersion(tag); err == nil {
+				return tag
+			}
+		}
+	}
+	return obj.Status.SemVerBaseline
+}
+
+// withSemVerBaseline returns a copy of the given policy choice with the
+// baseline set on the relative SemVer ranges that don't pin one.
+func withSemVerBaseline(choice imagev1.ImagePolicyChoice, baseline string) imagev1.ImagePolicyChoice {
+	if baseline == "" {
+		return choice
+	}
+	c := choice.DeepCopy()
+	for _, s := range semverPolicies(c) {
+		if s.Relative != nil && s.Relative.Baseline == "" {
+			s.Relative.Baseline = baseline
+		}
+	}
+	return *c
+}
+
+// semverPolicies returns the SemVer policies of the given policy choice and
+// its fallbacks.
+func semverPolicies(choice *imagev1.ImagePolicyChoice) []*imagev1.SemVerPolicy {
+	var semvers []*imagev1.SemVerPolicy
+	if choice.SemVer != nil {
+		semvers = append(semvers, choice.SemVer)
+	}
+	for _, f := range choice.Fallback {
+		if f.SemVer != nil {
+			semvers = append(semvers, f.SemVer)
+		}
+	}
+	return semvers
+}
+
+// resolvedPolicyPath returns the path of the policy in the fallback chain at
+// the given index, as reported in the ImagePolicy status.
+func resolvedPolicyPath(idx int) string {
+	if idx == 0 {
+		return "spec.policy"
+	}
+	return fmt.Sprintf("spec.policy.fallback[%d]", idx-1)
 }
 
 // reconcileDelete handles the deletion of the object.
@@ -434,6 +1344,39 @@ func (r *ImagePolicyReconciler) imagePoliciesForRepository(ctx context.Context,
 		log.Error(err, "failed to list ImagePolcies while getting reconcile requests for the same")
 		return nil
 	}
+	reqs := make([]reconcile.Request, 0, len(policies.Items))
+	seen := map[types.NamespacedName]bool{}
+	for i := range policies.Items {
+		key := client.ObjectKeyFromObject(&policies.Items[i])
+		seen[key] = true
+		reqs = append(reqs, reconcile.Request{NamespacedName: key})
+	}
+
+	// Add the policies selecting the repository by its labels.
+	var selecting imagev1.ImagePolicyList
+	if err := r.List(ctx, &selecting, client.MatchingFields{imageRepoSelectorKey: obj.GetNamespace()}); err != nil {
+		log.Error(err, "failed to list ImagePolcies while getting reconcile requests for the same")
+		return reqs
+	}
+	for i := range selecting.Items {
+		key := client.ObjectKeyFromObject(&selecting.Items[i])
+		selector, err := metav1.LabelSelectorAsSelector(selecting.Items[i].Spec.ImageRepositorySelector)
+		if err != nil || seen[key] || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		seen[key] = true
+		reqs = append(reqs, reconcile.Request{NamespacedName: key})
+	}
+	return reqs
+}
+
+func (r *ImagePolicyReconciler) imagePoliciesPromotedFrom(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := ctrl.LoggerFrom(ctx)
+	var policies imagev1.ImagePolicyList
+	if err := r.List(ctx, &policies, client.MatchingFields{promotedFromKey: client.ObjectKeyFromObject(obj).String()}); err != nil {
+		log.Error(err, "failed to list ImagePolicies promoted from the ImagePolicy")
+		return nil
+	}
 	reqs := make([]reconcile.Request, len(policies.Items))
 	for i := range policies.Items {
 		reqs[i].NamespacedName.Name = policies.Items[i].GetName()
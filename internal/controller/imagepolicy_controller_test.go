@@ -19,15 +19,20 @@ package controller
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	aclapis "github.com/fluxcd/pkg/apis/acl"
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/runtime/acl"
+	"github.com/fluxcd/pkg/runtime/conditions"
+	"github.com/fluxcd/pkg/runtime/patch"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -72,7 +77,7 @@ func TestImagePolicyReconciler_deleteBeforeFinalizer(t *testing.T) {
 	g.Expect(err).NotTo(HaveOccurred())
 }
 
-func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
+func TestImagePolicyReconciler_getImageRepositories(t *testing.T) {
 	testImageRepoName := "test-repo"
 	testNamespace1 := "test-ns1" // Default namespace of ImagePolicy.
 	testNamespace2 := "test-ns2" // Used for cross-namespace repo reference.
@@ -85,7 +90,7 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 		imageRepoNamespace    string
 		imageRepoAccessFrom   *aclapis.AccessFrom
 		wantErr               bool
-		wantRepo              string
+		wantRepos             []string
 	}{
 		{
 			name:    "NoCrossNamespaceRefs=true, repo in same namespace",
@@ -96,7 +101,7 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 				},
 			},
 			imageRepoNamespace: testNamespace1,
-			wantRepo:           testImageRepoName,
+			wantRepos:          []string{testImageRepoName},
 		},
 		{
 			name:    "NoCrossNamespaceRefs=true, repo in different namespace",
@@ -110,6 +115,32 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 			imageRepoNamespace: testNamespace2,
 			wantErr:            true,
 		},
+		{
+			name: "repo referenced twice",
+			imagePolicySpec: imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{
+					Name: testImageRepoName,
+				},
+				ImageRepositoryRefs: []meta.NamespacedObjectReference{
+					{Name: testImageRepoName},
+				},
+			},
+			imageRepoNamespace: testNamespace1,
+			wantRepos:          []string{testImageRepoName},
+		},
+		{
+			name: "repo in the refs does not exist",
+			imagePolicySpec: imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{
+					Name: testImageRepoName,
+				},
+				ImageRepositoryRefs: []meta.NamespacedObjectReference{
+					{Name: "some-non-existing-repo"},
+				},
+			},
+			imageRepoNamespace: testNamespace1,
+			wantErr:            true,
+		},
 		{
 			name: "referred repo does not exist",
 			imagePolicySpec: imagev1.ImagePolicySpec{
@@ -127,7 +158,7 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 				},
 			},
 			imageRepoNamespace: testNamespace1,
-			wantRepo:           testImageRepoName,
+			wantRepos:          []string{testImageRepoName},
 		},
 		{
 			name: "repo in different namespace, ACL not authorized",
@@ -162,7 +193,7 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 					{MatchLabels: map[string]string{"foo1": "bar1"}},
 				},
 			},
-			wantRepo: testImageRepoName,
+			wantRepos: []string{testImageRepoName},
 		},
 		{
 			name: "repo in different namespace, multiple ACL namespace selectors, authorized",
@@ -184,7 +215,7 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 					{MatchLabels: map[string]string{"xxx": "yyy"}},
 				},
 			},
-			wantRepo: testImageRepoName,
+			wantRepos: []string{testImageRepoName},
 		},
 		{
 			name: "repo in different namespace, multiple ACL namespace selectors, unauthorized",
@@ -253,23 +284,304 @@ func TestImagePolicyReconciler_getImageRepository(t *testing.T) {
 			}
 			obj.Spec = tt.imagePolicySpec
 
-			repo, err := r.getImageRepository(context.TODO(), obj)
+			repos, err := r.getImageRepositories(context.TODO(), obj)
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			if err == nil {
+				var names []string
+				for _, repo := range repos {
+					names = append(names, repo.Name)
+				}
+				g.Expect(names).To(Equal(tt.wantRepos))
+			}
+		})
+	}
+}
+
+func TestImagePolicyReconciler_getUpstreamImagePolicy(t *testing.T) {
+	testUpstreamName := "test-upstream"
+	testNamespace1 := "test-ns1" // Default namespace of ImagePolicy.
+	testNamespace2 := "test-ns2" // Used for cross-namespace upstream reference.
+	namespaceLabels := map[string]string{"env": "staging"}
+
+	tests := []struct {
+		name               string
+		aclOpts            acl.Options
+		ref                meta.NamespacedObjectReference
+		upstreamNamespace  string
+		upstreamAccessFrom *aclapis.AccessFrom
+		wantErr            bool
+	}{
+		{
+			name:              "upstream in same namespace",
+			ref:               meta.NamespacedObjectReference{Name: testUpstreamName},
+			upstreamNamespace: testNamespace1,
+		},
+		{
+			name:    "upstream does not exist",
+			ref:     meta.NamespacedObjectReference{Name: "some-non-existing-policy"},
+			wantErr: true,
+		},
+		{
+			name:    "NoCrossNamespaceRefs=true, upstream in different namespace",
+			aclOpts: acl.Options{NoCrossNamespaceRefs: true},
+			ref: meta.NamespacedObjectReference{
+				Name:      testUpstreamName,
+				Namespace: testNamespace2,
+			},
+			upstreamNamespace: testNamespace2,
+			upstreamAccessFrom: &aclapis.AccessFrom{
+				NamespaceSelectors: []aclapis.NamespaceSelector{{MatchLabels: namespaceLabels}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "upstream in different namespace, no ACL",
+			ref: meta.NamespacedObjectReference{
+				Name:      testUpstreamName,
+				Namespace: testNamespace2,
+			},
+			upstreamNamespace: testNamespace2,
+			wantErr:           true,
+		},
+		{
+			name: "upstream in different namespace, ACL authorized",
+			ref: meta.NamespacedObjectReference{
+				Name:      testUpstreamName,
+				Namespace: testNamespace2,
+			},
+			upstreamNamespace: testNamespace2,
+			upstreamAccessFrom: &aclapis.AccessFrom{
+				NamespaceSelectors: []aclapis.NamespaceSelector{{MatchLabels: namespaceLabels}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			policyNS := &corev1.Namespace{}
+			policyNS.Name = testNamespace1
+			policyNS.Labels = namespaceLabels
+
+			upstreamNS := &corev1.Namespace{}
+			upstreamNS.Name = testNamespace2
+
+			upstream := &imagev1.ImagePolicy{}
+			upstream.Name = testUpstreamName
+			upstream.Namespace = tt.upstreamNamespace
+			upstream.Spec.AccessFrom = tt.upstreamAccessFrom
+
+			clientBuilder := fake.NewClientBuilder()
+			clientBuilder.WithObjects(policyNS, upstreamNS, upstream)
+
+			r := &ImagePolicyReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        clientBuilder.Build(),
+				ACLOptions:    tt.aclOpts,
+			}
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = testNamespace1
+			obj.Spec.PromotedFrom = &imagev1.PromotedFrom{PolicyRef: tt.ref}
+
+			got, err := r.getUpstreamImagePolicy(context.TODO(), obj)
 			g.Expect(err != nil).To(Equal(tt.wantErr))
 			if err == nil {
-				g.Expect(repo.Name).To(Equal(tt.wantRepo))
+				g.Expect(got.Name).To(Equal(testUpstreamName))
 			}
 		})
 	}
 }
 
+func TestPromotionEligible(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		latestImage   string
+		lastPromotion *imagev1.Promotion
+		history       []imagev1.Promotion
+		minDuration   *metav1.Duration
+		candidate     string
+		wantEligible  bool
+		wantWait      time.Duration
+	}{
+		{
+			name:         "upstream latest image",
+			latestImage:  "registry.dev/foo/bar:1.1.0",
+			candidate:    "registry.prod/foo/bar:1.1.0",
+			wantEligible: true,
+		},
+		{
+			name:        "not upstream latest image",
+			latestImage: "registry.dev/foo/bar:1.2.0",
+			candidate:   "registry.prod/foo/bar:1.1.0",
+		},
+		{
+			name:        "no upstream latest image",
+			candidate:   "registry.prod/foo/bar:1.1.0",
+			minDuration: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			name:        "upstream promotion not recorded",
+			latestImage: "registry.dev/foo/bar:1.1.0",
+			candidate:   "registry.prod/foo/bar:1.1.0",
+			minDuration: &metav1.Duration{Duration: time.Hour},
+			wantWait:    time.Hour,
+		},
+		{
+			name:        "upstream promotion too recent",
+			latestImage: "registry.dev/foo/bar:1.1.0",
+			lastPromotion: &imagev1.Promotion{
+				Image: "registry.dev/foo/bar:1.1.0",
+				Time:  metav1.NewTime(now.Add(-20 * time.Minute)),
+			},
+			candidate:   "registry.prod/foo/bar:1.1.0",
+			minDuration: &metav1.Duration{Duration: time.Hour},
+			wantWait:    40 * time.Minute,
+		},
+		{
+			name:        "upstream promotion old enough",
+			latestImage: "registry.dev/foo/bar:1.1.0",
+			lastPromotion: &imagev1.Promotion{
+				Image: "registry.dev/foo/bar:1.1.0",
+				Time:  metav1.NewTime(now.Add(-2 * time.Hour)),
+			},
+			candidate:    "registry.prod/foo/bar:1.1.0",
+			minDuration:  &metav1.Duration{Duration: time.Hour},
+			wantEligible: true,
+		},
+		{
+			name:        "image held long enough by fast upstream",
+			latestImage: "registry.dev/foo/bar:1.3.0",
+			history: []imagev1.Promotion{
+				{Image: "registry.dev/foo/bar:1.3.0", Time: metav1.NewTime(now.Add(-5 * time.Minute))},
+				{Image: "registry.dev/foo/bar:1.2.0", Time: metav1.NewTime(now.Add(-25 * time.Minute))},
+				{Image: "registry.dev/foo/bar:1.1.0", Time: metav1.NewTime(now.Add(-3 * time.Hour))},
+			},
+			candidate:    "registry.prod/foo/bar:1.1.0",
+			minDuration:  &metav1.Duration{Duration: time.Hour},
+			wantEligible: true,
+		},
+		{
+			name:        "image not held long enough by fast upstream",
+			latestImage: "registry.dev/foo/bar:1.3.0",
+			history: []imagev1.Promotion{
+				{Image: "registry.dev/foo/bar:1.3.0", Time: metav1.NewTime(now.Add(-5 * time.Minute))},
+				{Image: "registry.dev/foo/bar:1.2.0", Time: metav1.NewTime(now.Add(-25 * time.Minute))},
+				{Image: "registry.dev/foo/bar:1.1.0", Time: metav1.NewTime(now.Add(-3 * time.Hour))},
+			},
+			candidate:   "registry.prod/foo/bar:1.2.0",
+			minDuration: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			name:        "upstream latest image of fast upstream",
+			latestImage: "registry.dev/foo/bar:1.3.0",
+			history: []imagev1.Promotion{
+				{Image: "registry.dev/foo/bar:1.3.0", Time: metav1.NewTime(now.Add(-5 * time.Minute))},
+				{Image: "registry.dev/foo/bar:1.2.0", Time: metav1.NewTime(now.Add(-25 * time.Minute))},
+			},
+			candidate:   "registry.prod/foo/bar:1.3.0",
+			minDuration: &metav1.Duration{Duration: time.Hour},
+			wantWait:    55 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			upstream := &imagev1.ImagePolicy{}
+			upstream.Status.LatestImage = tt.latestImage
+			upstream.Status.LastPromotion = tt.lastPromotion
+			upstream.Status.PromotionHistory = tt.history
+
+			eligible, wait := promotionEligible(upstream, tt.minDuration, tt.candidate, now)
+			g.Expect(eligible).To(Equal(tt.wantEligible))
+			g.Expect(wait).To(Equal(tt.wantWait))
+		})
+	}
+}
+
+func TestImagePolicyReconciler_fastUpstream(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Now()
+
+	repo := &imagev1.ImageRepository{}
+	repo.Name = "test-repo"
+	repo.Namespace = "default"
+	repo.Spec.Image = "foo/bar"
+	repo.Status.CanonicalImageName = "foo/bar"
+	repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 4}
+
+	// The upstream ImagePolicy promotes a new image every 20 minutes.
+	upstream := &imagev1.ImagePolicy{}
+	upstream.Name = "staging"
+	upstream.Namespace = "default"
+	upstream.Status.LatestImage = "foo/bar:1.3.0"
+	upstream.Status.PromotionHistory = []imagev1.Promotion{
+		{Image: "foo/bar:1.3.0", Time: metav1.NewTime(now.Add(-5 * time.Minute))},
+		{Image: "foo/bar:1.2.0", Time: metav1.NewTime(now.Add(-25 * time.Minute))},
+		{Image: "foo/bar:1.1.0", Time: metav1.NewTime(now.Add(-3 * time.Hour))},
+	}
+	upstream.Status.LastPromotion = &upstream.Status.PromotionHistory[0]
+
+	obj := &imagev1.ImagePolicy{}
+	obj.Name = "prod"
+	obj.Namespace = "default"
+	obj.Spec = imagev1.ImagePolicySpec{
+		ImageRepositoryRef: meta.NamespacedObjectReference{Name: repo.Name},
+		Policy: imagev1.ImagePolicyChoice{
+			SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+		},
+		PromotedFrom: &imagev1.PromotedFrom{
+			PolicyRef:   meta.NamespacedObjectReference{Name: upstream.Name},
+			MinDuration: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	obj.Status.LatestImage = "foo/bar:1.0.0"
+
+	c := fake.NewClientBuilder().
+		WithObjects(repo, upstream, obj).
+		WithStatusSubresource(upstream, obj).
+		Build()
+	r := &ImagePolicyReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        c,
+		Database:      &mockDatabase{TagData: []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"}},
+		patchOptions:  getPatchOptions(imagePolicyOwnedConditions, "irc"),
+	}
+
+	sp := patch.NewSerialPatcher(obj, r.Client)
+	result, err := r.reconcile(ctx, sp, obj)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The image the upstream held for the minimum duration is promoted, while
+	// the upstream latest image is pending.
+	g.Expect(obj.Status.LatestImage).To(Equal("foo/bar:1.1.0"))
+	g.Expect(obj.Status.PendingImage).To(Equal("foo/bar:1.3.0"))
+	g.Expect(conditions.IsTrue(obj, imagev1.AwaitingUpstreamPromotionCondition)).To(BeTrue())
+	g.Expect(result.RequeueAfter).To(BeNumerically("~", 55*time.Minute, time.Minute))
+	g.Expect(obj.Status.PromotionHistory).To(HaveLen(1))
+	g.Expect(obj.Status.PromotionHistory[0].Image).To(Equal("foo/bar:1.1.0"))
+}
+
 func TestImagePolicyReconciler_applyPolicy(t *testing.T) {
 	tests := []struct {
-		name       string
-		policy     imagev1.ImagePolicyChoice
-		filter     *imagev1.TagFilter
-		db         *mockDatabase
-		wantErr    bool
-		wantResult string
+		name        string
+		policy      imagev1.ImagePolicyChoice
+		filter      *imagev1.TagFilter
+		baseline    string
+		limit       int
+		db          *mockDatabase
+		wantErr     bool
+		wantResult  string
+		wantIdx     int
+		wantSkipped int
+		wantImages  map[string]string
+		wantCands   []imagev1.Candidate
 	}{
 		{
 			name:    "invalid policy",
@@ -343,6 +655,146 @@ func TestImagePolicyReconciler_applyPolicy(t *testing.T) {
 			}},
 			wantResult: "foo-zzz",
 		},
+		{
+			name: "semver with numerical fallback",
+			policy: imagev1.ImagePolicyChoice{
+				SemVer:   &imagev1.SemVerPolicy{Range: "1.0.x"},
+				Fallback: []imagev1.ImagePolicyFallback{{Numerical: &imagev1.NumericalPolicy{}}},
+			},
+			filter: &imagev1.TagFilter{
+				Pattern: "^build-(?P<id>[0-9]+)$",
+				Extract: "$id",
+			},
+			db: &mockDatabase{TagData: []string{
+				"build-100", "build-99", "build-101", "1.0.0",
+			}},
+			wantResult: "build-101",
+			wantIdx:    1,
+		},
+		{
+			name: "semver with numerical fallback, semver matches",
+			policy: imagev1.ImagePolicyChoice{
+				SemVer:   &imagev1.SemVerPolicy{Range: "1.0.x"},
+				Fallback: []imagev1.ImagePolicyFallback{{Numerical: &imagev1.NumericalPolicy{}}},
+			},
+			db:         &mockDatabase{TagData: []string{"1.0.0", "1.0.1", "100"}},
+			wantResult: "1.0.1",
+		},
+		{
+			name: "no policy in fallback chain determines a result",
+			policy: imagev1.ImagePolicyChoice{
+				SemVer:   &imagev1.SemVerPolicy{Range: "2.0.x"},
+				Fallback: []imagev1.ImagePolicyFallback{{Numerical: &imagev1.NumericalPolicy{}}},
+			},
+			db:      &mockDatabase{TagData: []string{"1.0.0", "latest"}},
+			wantErr: true,
+		},
+		{
+			name:    "numerical with unparsable tags",
+			policy:  imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{}},
+			db:      &mockDatabase{TagData: []string{"100", "latest", "101"}},
+			wantErr: true,
+		},
+		{
+			name:        "numerical skipping unparsable tags",
+			policy:      imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{SkipUnparsable: true}},
+			db:          &mockDatabase{TagData: []string{"100", "latest", "101", "main"}},
+			wantResult:  "101",
+			wantSkipped: 2,
+		},
+		{
+			name: "relative semver with baseline",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Relative: &imagev1.SemVerRelative{Updates: "patch"},
+			}},
+			baseline:   "1.4.2",
+			db:         &mockDatabase{TagData: []string{"1.4.2", "1.4.3", "1.5.0", "2.0.0"}},
+			wantResult: "1.4.3",
+		},
+		{
+			name: "relative semver without range nor baseline",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Relative: &imagev1.SemVerRelative{Updates: "patch"},
+			}},
+			db:      &mockDatabase{TagData: []string{"1.4.2", "1.4.3", "1.5.0", "2.0.0"}},
+			wantErr: true,
+		},
+		{
+			name: "relative semver without baseline",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Range:    "1.x",
+				Relative: &imagev1.SemVerRelative{Updates: "patch"},
+			}},
+			db:         &mockDatabase{TagData: []string{"1.4.2", "1.4.3", "1.5.0", "2.0.0"}},
+			wantResult: "1.5.0",
+		},
+		{
+			name: "semver grouped by major version",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Range:   ">=1.0.0",
+				GroupBy: &imagev1.GroupBy{Version: "major"},
+			}},
+			db:         &mockDatabase{TagData: []string{"1.4.2", "1.4.3", "2.0.0", "2.1.0", "latest"}},
+			wantResult: "2.1.0",
+			wantImages: map[string]string{"1": "foo/bar:1.4.3", "2": "foo/bar:2.1.0"},
+		},
+		{
+			name: "semver grouped by major version of extracted values",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Range:   ">=1.0.0",
+				GroupBy: &imagev1.GroupBy{Version: "major"},
+			}},
+			filter:     &imagev1.TagFilter{Pattern: `^app-(?P<v>.*)$`, Extract: "$v"},
+			db:         &mockDatabase{TagData: []string{"app-1.4.2", "app-1.4.3", "app-2.0.0", "other-3.0.0"}},
+			wantResult: "app-2.0.0",
+			wantImages: map[string]string{"1": "foo/bar:app-1.4.3", "2": "foo/bar:app-2.0.0"},
+		},
+		{
+			name: "numerical grouped by capture group",
+			policy: imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+				GroupBy: &imagev1.GroupBy{CaptureGroup: "train"},
+			}},
+			filter:     &imagev1.TagFilter{Pattern: `^(?P<train>[a-z]+)-(?P<ts>\d+)$`, Extract: "$ts"},
+			db:         &mockDatabase{TagData: []string{"main-10", "main-20", "stable-15", "stable-3"}},
+			wantResult: "main-20",
+			wantImages: map[string]string{"main": "foo/bar:main-20", "stable": "foo/bar:stable-15"},
+		},
+		{
+			name: "numerical grouped by version",
+			policy: imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+				GroupBy: &imagev1.GroupBy{Version: "major"},
+			}},
+			db:      &mockDatabase{TagData: []string{"1", "2"}},
+			wantErr: true,
+		},
+		{
+			name:   "semver with candidates",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"}},
+			limit:  3,
+			db: &mockDatabase{
+				TagData:    []string{"1.0.0", "1.10.0", "1.2.0", "1.9.0", "latest"},
+				DigestData: map[string]string{"1.10.0": "sha256:1100", "1.2.0": "sha256:120"},
+			},
+			wantResult: "1.10.0",
+			wantCands: []imagev1.Candidate{
+				{Image: "foo/bar:1.10.0", Digest: "sha256:1100"},
+				{Image: "foo/bar:1.9.0"},
+				{Image: "foo/bar:1.2.0", Digest: "sha256:120"},
+			},
+		},
+		{
+			name:       "numerical with candidates and tag filter",
+			policy:     imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{}},
+			filter:     &imagev1.TagFilter{Pattern: `^main-(?P<ts>\d+)$`, Extract: "$ts"},
+			limit:      5,
+			db:         &mockDatabase{TagData: []string{"main-10", "main-9", "main-11", "dev-12"}},
+			wantResult: "main-11",
+			wantCands: []imagev1.Candidate{
+				{Image: "foo/bar:main-11"},
+				{Image: "foo/bar:main-10"},
+				{Image: "foo/bar:main-9"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -363,18 +815,869 @@ func TestImagePolicyReconciler_applyPolicy(t *testing.T) {
 			}
 			obj.Spec.Policy = tt.policy
 			obj.Spec.FilterTags = tt.filter
+			obj.Spec.CandidatesLimit = tt.limit
+			obj.Status.SemVerBaseline = tt.baseline
 
 			repo := &imagev1.ImageRepository{}
+			repo.Spec.Image = "foo/bar"
 
-			result, err := r.applyPolicy(context.TODO(), obj, repo)
+			result, err := r.applyPolicy(context.TODO(), obj, []*imagev1.ImageRepository{repo})
 			g.Expect(err != nil).To(Equal(tt.wantErr))
 			if err == nil {
-				g.Expect(result).To(Equal(tt.wantResult))
+				g.Expect(result.latest).To(Equal(tt.wantResult))
+				g.Expect(result.policyIndex).To(Equal(tt.wantIdx))
+				g.Expect(result.skipped).To(Equal(tt.wantSkipped))
+				g.Expect(result.latestImages).To(Equal(tt.wantImages))
+				g.Expect(result.candidates).To(Equal(tt.wantCands))
 			}
 		})
 	}
 }
 
+// repoDatabase is a Database recording the tags of each repository key.
+type repoDatabase map[string][]string
+
+// Tags implements the DatabaseReader interface of the Database.
+func (db repoDatabase) Tags(repo string) ([]string, error) {
+	return db[repo], nil
+}
+
+// SetTags implements the DatabaseWriter interface of the Database.
+func (db repoDatabase) SetTags(repo string, tags []string) error {
+	db[repo] = tags
+	return nil
+}
+
+// DeleteTags implements the DatabaseWriter interface of the Database.
+func (db repoDatabase) DeleteTags(repo string) error {
+	delete(db, repo)
+	return nil
+}
+
+// Repositories implements the RepositoryLister interface of the Database.
+func (db repoDatabase) Repositories() ([]string, error) {
+	var repos []string
+	for repo := range db {
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+func TestImagePolicyReconciler_multipleRepositories(t *testing.T) {
+	newRepo := func(name, image string, labels map[string]string) *imagev1.ImageRepository {
+		repo := &imagev1.ImageRepository{}
+		repo.Name = name
+		repo.Namespace = "default"
+		repo.Labels = labels
+		repo.Spec.Image = image
+		repo.Status.CanonicalImageName = image
+		repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 2}
+		return repo
+	}
+	docker := newRepo("docker", "docker.io/foo/bar", nil)
+	quay := newRepo("quay", "quay.io/foo/bar", map[string]string{"app": "bar"})
+	ghcr := newRepo("ghcr", "ghcr.io/foo/bar", map[string]string{"app": "bar"})
+	db := repoDatabase{
+		tagsKey(docker, false): {"1.0.0", "1.1.0"},
+		tagsKey(quay, false):   {"1.0.0", "1.1.0", "1.2.0"},
+		tagsKey(ghcr, false):   {"1.0.0", "1.3.0-rc.1"},
+	}
+
+	tests := []struct {
+		name            string
+		refs            []meta.NamespacedObjectReference
+		selector        *metav1.LabelSelector
+		policy          imagev1.ImagePolicyChoice
+		wantLatestImage string
+		wantRepo        string
+	}{
+		{
+			name:            "single repository",
+			policy:          imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"}},
+			wantLatestImage: "docker.io/foo/bar:1.1.0",
+			wantRepo:        "docker",
+		},
+		{
+			name:            "repositories by reference",
+			refs:            []meta.NamespacedObjectReference{{Name: "quay"}},
+			policy:          imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"}},
+			wantLatestImage: "quay.io/foo/bar:1.2.0",
+			wantRepo:        "quay",
+		},
+		{
+			name:            "latest tag in several repositories",
+			refs:            []meta.NamespacedObjectReference{{Name: "quay"}},
+			policy:          imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.1.x"}},
+			wantLatestImage: "docker.io/foo/bar:1.1.0",
+			wantRepo:        "docker",
+		},
+		{
+			name:            "repositories by selector",
+			selector:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "bar"}},
+			policy:          imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0-0"}},
+			wantLatestImage: "ghcr.io/foo/bar:1.3.0-rc.1",
+			wantRepo:        "ghcr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = "default"
+			obj.Spec = imagev1.ImagePolicySpec{
+				ImageRepositoryRef:      meta.NamespacedObjectReference{Name: docker.Name},
+				ImageRepositoryRefs:     tt.refs,
+				ImageRepositorySelector: tt.selector,
+				Policy:                  tt.policy,
+			}
+
+			c := fake.NewClientBuilder().
+				WithObjects(docker, quay, ghcr, obj).
+				WithStatusSubresource(obj).
+				Build()
+			r := &ImagePolicyReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        c,
+				Database:      db,
+				patchOptions:  getPatchOptions(imagePolicyOwnedConditions, "irc"),
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcile(ctx, sp, obj)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(obj.Status.LatestImage).To(Equal(tt.wantLatestImage))
+			g.Expect(obj.Status.LatestImageRepositoryRef).ToNot(BeNil())
+			g.Expect(obj.Status.LatestImageRepositoryRef.Name).To(Equal(tt.wantRepo))
+			g.Expect(conditions.GetMessage(obj, meta.ReadyCondition)).To(ContainSubstring(tt.wantLatestImage[:strings.LastIndex(tt.wantLatestImage, ":")]))
+		})
+	}
+}
+
+func TestImagePolicyReconciler_approval(t *testing.T) {
+	tests := []struct {
+		name            string
+		requireApproval bool
+		approved        string
+		latestImage     string
+		wantLatestImage string
+		wantPending     string
+	}{
+		{
+			name:            "approval not required",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "awaiting approval",
+			requireApproval: true,
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+		},
+		{
+			name:            "awaiting approval without latest image",
+			requireApproval: true,
+			wantPending:     "foo/bar:1.1.0",
+		},
+		{
+			name:            "approval of another image",
+			requireApproval: true,
+			approved:        "1.0.0",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+		},
+		{
+			name:            "approved by tag",
+			requireApproval: true,
+			approved:        "1.1.0",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "approved by reference",
+			requireApproval: true,
+			approved:        "foo/bar:1.1.0",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "approved by digest",
+			requireApproval: true,
+			approved:        "sha256:110",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "approved by @ digest",
+			requireApproval: true,
+			approved:        "@sha256:110",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "approved by digest reference",
+			requireApproval: true,
+			approved:        "foo/bar@sha256:110",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "approval of another digest",
+			requireApproval: true,
+			approved:        "foo/bar@sha256:100",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+		},
+		{
+			name:            "approval of the digest of another image",
+			requireApproval: true,
+			approved:        "foo/baz@sha256:110",
+			latestImage:     "foo/bar:1.0.0",
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+		},
+		{
+			name:            "current latest image",
+			requireApproval: true,
+			latestImage:     "foo/bar:1.1.0",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repo := &imagev1.ImageRepository{}
+			repo.Name = "test-repo"
+			repo.Namespace = "default"
+			repo.Spec.Image = "foo/bar"
+			repo.Status.CanonicalImageName = "foo/bar"
+			repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 2}
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = "default"
+			obj.Spec = imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{Name: repo.Name},
+				Policy: imagev1.ImagePolicyChoice{
+					SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+				},
+				RequireApproval: tt.requireApproval,
+			}
+			if tt.approved != "" {
+				obj.SetAnnotations(map[string]string{imagev1.ApprovedImageAnnotation: tt.approved})
+			}
+			obj.Status.LatestImage = tt.latestImage
+
+			c := fake.NewClientBuilder().
+				WithObjects(repo, obj).
+				WithStatusSubresource(obj).
+				Build()
+			r := &ImagePolicyReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        c,
+				Database: &mockDatabase{
+					TagData:    []string{"1.0.0", "1.1.0"},
+					DigestData: map[string]string{"1.0.0": "sha256:100", "1.1.0": "sha256:110"},
+				},
+				patchOptions: getPatchOptions(imagePolicyOwnedConditions, "irc"),
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcile(ctx, sp, obj)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(obj.Status.LatestImage).To(Equal(tt.wantLatestImage))
+			g.Expect(obj.Status.PendingImage).To(Equal(tt.wantPending))
+			g.Expect(conditions.IsTrue(obj, imagev1.AwaitingApprovalCondition)).To(Equal(tt.wantPending != ""))
+			g.Expect(conditions.IsReady(obj)).To(BeTrue())
+		})
+	}
+}
+
+func TestImagePolicyReconciler_promotionWindows(t *testing.T) {
+	now := time.Now().UTC()
+	openWindow := imagev1.PromotionWindow{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+	}
+	closedWindow := imagev1.PromotionWindow{
+		Start: now.Add(2 * time.Hour).Format("15:04"),
+		End:   now.Add(3 * time.Hour).Format("15:04"),
+	}
+
+	tests := []struct {
+		name            string
+		windows         []imagev1.PromotionWindow
+		afterFailure    bool
+		wantLatestImage string
+		wantPending     string
+		wantRequeue     bool
+		wantStalled     bool
+	}{
+		{
+			name:            "no promotion windows",
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "inside promotion window",
+			windows:         []imagev1.PromotionWindow{closedWindow, openWindow},
+			wantLatestImage: "foo/bar:1.1.0",
+		},
+		{
+			name:            "outside promotion windows",
+			windows:         []imagev1.PromotionWindow{closedWindow},
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+			wantRequeue:     true,
+		},
+		{
+			name:            "outside promotion windows after a failure",
+			windows:         []imagev1.PromotionWindow{closedWindow},
+			afterFailure:    true,
+			wantLatestImage: "foo/bar:1.0.0",
+			wantPending:     "foo/bar:1.1.0",
+			wantRequeue:     true,
+		},
+		{
+			name:        "invalid promotion window",
+			windows:     []imagev1.PromotionWindow{{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus"}},
+			wantStalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repo := &imagev1.ImageRepository{}
+			repo.Name = "test-repo"
+			repo.Namespace = "default"
+			repo.Spec.Image = "foo/bar"
+			repo.Status.CanonicalImageName = "foo/bar"
+			repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 2}
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = "default"
+			obj.Spec = imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{Name: repo.Name},
+				Policy: imagev1.ImagePolicyChoice{
+					SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+				},
+				PromotionWindows: tt.windows,
+			}
+			obj.Status.LatestImage = "foo/bar:1.0.0"
+			obj.Status.LastPromotion = &imagev1.Promotion{Image: "foo/bar:1.0.0"}
+			// A failure resets the latest image, not the promotion record.
+			if tt.afterFailure {
+				obj.Status.LatestImage = ""
+			}
+
+			c := fake.NewClientBuilder().
+				WithObjects(repo, obj).
+				WithStatusSubresource(obj).
+				Build()
+			r := &ImagePolicyReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        c,
+				Database:      &mockDatabase{TagData: []string{"1.0.0", "1.1.0"}},
+				patchOptions:  getPatchOptions(imagePolicyOwnedConditions, "irc"),
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			result, err := r.reconcile(ctx, sp, obj)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tt.wantStalled {
+				g.Expect(conditions.IsStalled(obj)).To(BeTrue())
+				return
+			}
+			g.Expect(obj.Status.LatestImage).To(Equal(tt.wantLatestImage))
+			g.Expect(obj.Status.PendingImage).To(Equal(tt.wantPending))
+			g.Expect(conditions.IsTrue(obj, imagev1.PromotionWindowClosedCondition)).To(Equal(tt.wantPending != ""))
+			if tt.wantRequeue {
+				g.Expect(result.RequeueAfter).To(BeNumerically(">", time.Hour))
+				g.Expect(result.RequeueAfter).To(BeNumerically("<=", 2*time.Hour))
+			} else {
+				g.Expect(result.RequeueAfter).To(BeZero())
+			}
+		})
+	}
+}
+
+func TestStabilize(t *testing.T) {
+	now := time.Now()
+	scan1 := metav1.NewTime(now.Add(-2 * time.Minute))
+	scan2 := metav1.NewTime(now.Add(-time.Minute))
+
+	tests := []struct {
+		name          string
+		stabilization imagev1.Stabilization
+		status        *imagev1.StabilizationStatus
+		candidate     string
+		scanTime      metav1.Time
+		wantStatus    *imagev1.StabilizationStatus
+		wantStable    bool
+		wantWait      time.Duration
+	}{
+		{
+			name:          "current latest image",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			status:        &imagev1.StabilizationStatus{Candidate: "foo/bar:1.1.0", Scans: 1},
+			candidate:     "foo/bar:1.0.0",
+			scanTime:      scan1,
+			wantStable:    true,
+		},
+		{
+			name:          "new candidate",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			candidate:     "foo/bar:1.1.0",
+			scanTime:      scan1,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: metav1.NewTime(now),
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+		},
+		{
+			name:          "candidate replaced",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.2.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan2,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: metav1.NewTime(now),
+				Scans:             1,
+				LastScanTime:      scan2,
+			},
+		},
+		{
+			name:          "same scan",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan1,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+		},
+		{
+			name:          "stable after scans",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan2,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             2,
+				LastScanTime:      scan2,
+			},
+			wantStable: true,
+		},
+		{
+			name:          "stable candidate held back",
+			stabilization: imagev1.Stabilization{Scans: 2},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             2,
+				LastScanTime:      scan2,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan2,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             2,
+				LastScanTime:      scan2,
+			},
+			wantStable: true,
+		},
+		{
+			name:          "waiting for duration",
+			stabilization: imagev1.Stabilization{Duration: &metav1.Duration{Duration: 5 * time.Minute}},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan2,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             2,
+				LastScanTime:      scan2,
+			},
+			wantWait: 3 * time.Minute,
+		},
+		{
+			name:          "stable after duration",
+			stabilization: imagev1.Stabilization{Duration: &metav1.Duration{Duration: time.Minute}},
+			status: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			candidate: "foo/bar:1.1.0",
+			scanTime:  scan1,
+			wantStatus: &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: scan1,
+				Scans:             1,
+				LastScanTime:      scan1,
+			},
+			wantStable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Spec.Stabilization = &tt.stabilization
+			obj.Status.LatestImage = "foo/bar:1.0.0"
+			obj.Status.Stabilization = tt.status
+
+			status, stable, wait := stabilize(obj, tt.candidate, tt.scanTime, now)
+			g.Expect(status).To(Equal(tt.wantStatus))
+			g.Expect(stable).To(Equal(tt.wantStable))
+			g.Expect(wait).To(Equal(tt.wantWait))
+		})
+	}
+}
+
+func TestImagePolicyReconciler_stabilizationWithGates(t *testing.T) {
+	now := time.Now().UTC()
+	closedWindow := imagev1.PromotionWindow{
+		Start: now.Add(2 * time.Hour).Format("15:04"),
+		End:   now.Add(3 * time.Hour).Format("15:04"),
+	}
+
+	tests := []struct {
+		name            string
+		windows         []imagev1.PromotionWindow
+		requireApproval bool
+		condition       string
+		wantRequeue     bool
+	}{
+		{
+			name:        "outside promotion windows",
+			windows:     []imagev1.PromotionWindow{closedWindow},
+			condition:   imagev1.PromotionWindowClosedCondition,
+			wantRequeue: true,
+		},
+		{
+			name:            "awaiting approval",
+			requireApproval: true,
+			condition:       imagev1.AwaitingApprovalCondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scanTime := metav1.NewTime(now.Add(-time.Minute).Truncate(time.Second))
+			repo := &imagev1.ImageRepository{}
+			repo.Name = "test-repo"
+			repo.Namespace = "default"
+			repo.Spec.Image = "foo/bar"
+			repo.Status.CanonicalImageName = "foo/bar"
+			repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 2, ScanTime: scanTime}
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = "default"
+			obj.Spec = imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{Name: repo.Name},
+				Policy: imagev1.ImagePolicyChoice{
+					SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+				},
+				Stabilization:    &imagev1.Stabilization{Scans: 2},
+				PromotionWindows: tt.windows,
+				RequireApproval:  tt.requireApproval,
+			}
+			obj.Status.LatestImage = "foo/bar:1.0.0"
+			obj.Status.Stabilization = &imagev1.StabilizationStatus{
+				Candidate:         "foo/bar:1.1.0",
+				FirstObservedTime: metav1.NewTime(now.Add(-time.Hour).Truncate(time.Second)),
+				Scans:             1,
+				LastScanTime:      metav1.NewTime(now.Add(-time.Hour).Truncate(time.Second)),
+			}
+
+			c := fake.NewClientBuilder().
+				WithObjects(repo, obj).
+				WithStatusSubresource(obj).
+				Build()
+			r := &ImagePolicyReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        c,
+				Database:      &mockDatabase{TagData: []string{"1.0.0", "1.1.0"}},
+				patchOptions:  getPatchOptions(imagePolicyOwnedConditions, "irc"),
+			}
+
+			// The candidate becomes stable on the second scan, and stays
+			// stable while held back by the other gate.
+			for i := 0; i < 3; i++ {
+				sp := patch.NewSerialPatcher(obj, r.Client)
+				result, err := r.reconcile(ctx, sp, obj)
+				g.Expect(err).ToNot(HaveOccurred())
+
+				g.Expect(obj.Status.LatestImage).To(Equal("foo/bar:1.0.0"))
+				g.Expect(obj.Status.PendingImage).To(Equal("foo/bar:1.1.0"))
+				g.Expect(obj.Status.Stabilization).ToNot(BeNil())
+				g.Expect(obj.Status.Stabilization.Scans).To(Equal(2))
+				g.Expect(conditions.IsTrue(obj, tt.condition)).To(BeTrue())
+				if tt.wantRequeue {
+					g.Expect(result.RequeueAfter).To(BeNumerically(">", time.Hour))
+				} else {
+					g.Expect(result.RequeueAfter).To(BeZero())
+				}
+			}
+
+			// The stabilization state is dropped once the candidate is
+			// promoted.
+			if tt.requireApproval {
+				obj.SetAnnotations(map[string]string{imagev1.ApprovedImageAnnotation: "1.1.0"})
+				sp := patch.NewSerialPatcher(obj, r.Client)
+				_, err := r.reconcile(ctx, sp, obj)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(obj.Status.LatestImage).To(Equal("foo/bar:1.1.0"))
+				g.Expect(obj.Status.Stabilization).To(BeNil())
+			}
+		})
+	}
+}
+
+func TestDowngradeFrom(t *testing.T) {
+	semver := imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"}}
+
+	tests := []struct {
+		name           string
+		allowDowngrade *bool
+		policy         imagev1.ImagePolicyChoice
+		filter         *imagev1.TagFilter
+		latestImage    string
+		lastPromotion  string
+		latestTag      string
+		wantPrevTag    string
+		wantDowngrade  bool
+	}{
+		{
+			name:        "downgrade allowed by default",
+			policy:      semver,
+			latestImage: "foo/bar:1.2.0",
+			latestTag:   "1.0.0",
+		},
+		{
+			name:           "downgrade allowed",
+			allowDowngrade: pointer.Bool(true),
+			policy:         semver,
+			latestImage:    "foo/bar:1.2.0",
+			latestTag:      "1.0.0",
+		},
+		{
+			name:           "downgrade prevented",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestImage:    "foo/bar:1.2.0",
+			latestTag:      "1.0.0",
+			wantPrevTag:    "1.2.0",
+			wantDowngrade:  true,
+		},
+		{
+			name:           "downgrade prevented after a failure",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			lastPromotion:  "foo/bar:1.2.0",
+			latestTag:      "1.0.0",
+			wantPrevTag:    "1.2.0",
+			wantDowngrade:  true,
+		},
+		{
+			name:           "upgrade",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestImage:    "foo/bar:1.2.0",
+			latestTag:      "1.3.0",
+		},
+		{
+			name:           "same tag",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestImage:    "foo/bar:1.2.0",
+			latestTag:      "1.2.0",
+		},
+		{
+			name:           "no latest image",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestTag:      "1.0.0",
+		},
+		{
+			name:           "different image",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestImage:    "foo/baz:1.2.0",
+			latestTag:      "1.0.0",
+		},
+		{
+			name:           "previous tag not comparable",
+			allowDowngrade: pointer.Bool(false),
+			policy:         semver,
+			latestImage:    "foo/bar:latest",
+			latestTag:      "1.0.0",
+		},
+		{
+			name:           "downgrade prevented with extract filter",
+			allowDowngrade: pointer.Bool(false),
+			policy: imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+				Order: "asc",
+			}},
+			filter: &imagev1.TagFilter{
+				Pattern: "^main-(?P<ts>[0-9]+)$",
+				Extract: "$ts",
+			},
+			latestImage:   "foo/bar:main-1700",
+			latestTag:     "main-1650",
+			wantPrevTag:   "main-1700",
+			wantDowngrade: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Spec.AllowDowngrade = tt.allowDowngrade
+			obj.Spec.Policy = tt.policy
+			obj.Spec.FilterTags = tt.filter
+			obj.Status.LatestImage = tt.latestImage
+			if tt.lastPromotion != "" {
+				obj.Status.LastPromotion = &imagev1.Promotion{Image: tt.lastPromotion}
+			}
+
+			prevTag, downgrade := downgradeFrom(obj, []string{"foo/bar"}, tt.latestTag)
+			g.Expect(downgrade).To(Equal(tt.wantDowngrade))
+			if tt.wantDowngrade {
+				g.Expect(prevTag).To(Equal(tt.wantPrevTag))
+			}
+		})
+	}
+}
+
+func TestSemverBaseline(t *testing.T) {
+	relative := imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Relative: &imagev1.SemVerRelative{Updates: "patch"},
+	}}
+
+	tests := []struct {
+		name         string
+		policy       imagev1.ImagePolicyChoice
+		filter       *imagev1.TagFilter
+		status       imagev1.ImagePolicyStatus
+		wantBaseline string
+	}{
+		{
+			name:   "no relative range",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.0.x"}},
+			status: imagev1.ImagePolicyStatus{LatestImage: "foo/bar:1.0.1", SemVerBaseline: "1.0.0"},
+		},
+		{
+			name: "pinned baseline",
+			policy: imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+				Relative: &imagev1.SemVerRelative{Updates: "patch", Baseline: "1.2.0"},
+			}},
+			status:       imagev1.ImagePolicyStatus{LatestImage: "foo/bar:1.4.1"},
+			wantBaseline: "1.2.0",
+		},
+		{
+			name:         "latest image tag",
+			policy:       relative,
+			status:       imagev1.ImagePolicyStatus{LatestImage: "foo/bar:1.4.1", SemVerBaseline: "1.4.0"},
+			wantBaseline: "1.4.1",
+		},
+		{
+			name:   "latest image tag with extract filter",
+			policy: relative,
+			filter: &imagev1.TagFilter{
+				Pattern: "^app-(?P<version>.*)$",
+				Extract: "$version",
+			},
+			status:       imagev1.ImagePolicyStatus{LatestImage: "foo/bar:app-1.4.1"},
+			wantBaseline: "1.4.1",
+		},
+		{
+			name:         "latest image reset",
+			policy:       relative,
+			status:       imagev1.ImagePolicyStatus{SemVerBaseline: "1.4.0"},
+			wantBaseline: "1.4.0",
+		},
+		{
+			name:   "latest image reset with promotion",
+			policy: relative,
+			status: imagev1.ImagePolicyStatus{
+				LastPromotion:  &imagev1.Promotion{Image: "foo/bar:1.4.1"},
+				SemVerBaseline: "1.4.0",
+			},
+			wantBaseline: "1.4.1",
+		},
+		{
+			name:         "latest image tag not a version",
+			policy:       relative,
+			status:       imagev1.ImagePolicyStatus{LatestImage: "foo/bar:1024", SemVerBaseline: "1.4.0"},
+			wantBaseline: "1.4.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Spec.Policy = tt.policy
+			obj.Spec.FilterTags = tt.filter
+			obj.Status = tt.status
+
+			g.Expect(semverBaseline(obj)).To(Equal(tt.wantBaseline))
+		})
+	}
+}
+
 func TestComposeImagePolicyReadyMessage(t *testing.T) {
 	testImage := "foo/bar"
 
@@ -413,3 +1716,73 @@ func TestComposeImagePolicyReadyMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestImagePolicyReconciler_tenantIsolation(t *testing.T) {
+	newRepo := func(namespace string) *imagev1.ImageRepository {
+		repo := &imagev1.ImageRepository{}
+		repo.Name = "repo"
+		repo.Namespace = namespace
+		repo.Spec.Image = "ghcr.io/foo/private"
+		repo.Status.CanonicalImageName = "ghcr.io/foo/private"
+		repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 2}
+		return repo
+	}
+	tenantA := newRepo("tenant-a")
+	tenantB := newRepo("tenant-b")
+	// Only the ImageRepository of tenant A was scanned with valid credentials.
+	db := repoDatabase{
+		tagsKey(tenantA, false): {"1.0.0", "1.1.0"},
+		tagsKey(tenantA, true):  {"1.0.0", "1.1.0"},
+	}
+
+	tests := []struct {
+		name    string
+		shared  bool
+		wantErr bool
+	}{
+		{
+			name:    "tags scoped to the ImageRepository object",
+			wantErr: true,
+		},
+		{
+			name:   "tags shared by canonical image name",
+			shared: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &imagev1.ImagePolicy{}
+			obj.Name = "test-policy"
+			obj.Namespace = tenantB.Namespace
+			obj.Spec = imagev1.ImagePolicySpec{
+				ImageRepositoryRef: meta.NamespacedObjectReference{Name: tenantB.Name},
+				Policy:             imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"}},
+			}
+
+			c := fake.NewClientBuilder().
+				WithObjects(tenantA, tenantB, obj).
+				WithStatusSubresource(obj).
+				Build()
+			r := &ImagePolicyReconciler{
+				EventRecorder:      record.NewFakeRecorder(32),
+				Client:             c,
+				Database:           db,
+				SharedTagsDatabase: tt.shared,
+				patchOptions:       getPatchOptions(imagePolicyOwnedConditions, "irc"),
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcile(ctx, sp, obj)
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			if tt.wantErr {
+				g.Expect(err).To(Equal(errNoTagsInDatabase))
+				g.Expect(obj.Status.LatestImage).To(BeEmpty())
+				return
+			}
+			g.Expect(obj.Status.LatestImage).To(Equal("ghcr.io/foo/private:1.1.0"))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/image-reflector-controller/internal/policy"
+)
+
+// ExplainPath is the path of the debug endpoint explaining the evaluation of
+// the ImagePolicies, followed by `<namespace>/<name>`.
+const ExplainPath = "/debug/imagepolicies/"
+
+// defaultExplainLimit is the default number of tags explained by the debug
+// endpoint.
+const defaultExplainLimit = 1000
+
+// imagePolicyExplanation is the response of the explain debug endpoint.
+type imagePolicyExplanation struct {
+	Namespace   string              `json:"namespace"`
+	Name        string              `json:"name"`
+	LatestImage string              `json:"latestImage,omitempty"`
+	Explanation *policy.Explanation `json:"explanation"`
+}
+
+// ExplainHandler returns the handler of the debug endpoint serving the
+// verdicts of the policy of an ImagePolicy on its tags, as JSON, e.g.
+// `/debug/imagepolicies/flux-system/podinfo?limit=100`. The `limit` query
+// parameter is the number of explained tags, 1000 by default.
+func (r *ImagePolicyReconciler) ExplainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		namespace, name, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, ExplainPath), "/")
+		if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+			http.Error(w, fmt.Sprintf("expected path %s<namespace>/<name>", ExplainPath), http.StatusBadRequest)
+			return
+		}
+		limit := defaultExplainLimit
+		if l := req.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid limit '%s'", l), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		ctx := req.Context()
+		obj := &imagev1.ImagePolicy{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		repos, err := r.getImageRepositories(ctx, obj)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		e, err := r.explainPolicy(obj, repos, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(imagePolicyExplanation{
+			Namespace:   namespace,
+			Name:        name,
+			LatestImage: obj.Status.LatestImage,
+			Explanation: e,
+		})
+	})
+}
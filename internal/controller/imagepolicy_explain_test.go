@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/patch"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/image-reflector-controller/internal/policy"
+)
+
+func newExplainTestObjects() (*imagev1.ImageRepository, *imagev1.ImagePolicy, repoDatabase) {
+	repo := &imagev1.ImageRepository{}
+	repo.Name = "repo"
+	repo.Namespace = "default"
+	repo.Spec.Image = "foo/bar"
+	repo.Status.CanonicalImageName = "foo/bar"
+	repo.Status.LastScanResult = &imagev1.ScanResult{TagCount: 5}
+
+	obj := &imagev1.ImagePolicy{}
+	obj.Name = "test-policy"
+	obj.Namespace = "default"
+	obj.Spec = imagev1.ImagePolicySpec{
+		ImageRepositoryRef: meta.NamespacedObjectReference{Name: repo.Name},
+		FilterTags:         &imagev1.TagFilter{Pattern: "^v"},
+		Policy:             imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.x"}},
+		Explain:            true,
+	}
+
+	db := repoDatabase{
+		tagsKey(repo, false): {"v1.0.0", "v1.1.0", "v2.0.0", "vlatest", "main"},
+	}
+	return repo, obj, db
+}
+
+func TestImagePolicyReconciler_explanation(t *testing.T) {
+	g := NewWithT(t)
+
+	repo, obj, db := newExplainTestObjects()
+	c := fake.NewClientBuilder().
+		WithObjects(repo, obj).
+		WithStatusSubresource(obj).
+		Build()
+	r := &ImagePolicyReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        c,
+		Database:      db,
+		patchOptions:  getPatchOptions(imagePolicyOwnedConditions, "irc"),
+	}
+
+	sp := patch.NewSerialPatcher(obj, r.Client)
+	_, err := r.reconcile(ctx, sp, obj)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(obj.Status.LatestImage).To(Equal("foo/bar:v1.1.0"))
+	g.Expect(obj.Status.Explanation).To(Equal(&imagev1.Explanation{
+		Tags:       5,
+		Selected:   1,
+		Outranked:  1,
+		OutOfRange: 1,
+		Unparsable: 1,
+		Filtered:   1,
+	}))
+
+	// The summary is reported when the policy fails to determine a latest tag.
+	obj.Spec.Policy = imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "3.x"}}
+	_, err = r.reconcile(ctx, sp, obj)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(obj.Status.Explanation).To(Equal(&imagev1.Explanation{
+		Tags:       5,
+		OutOfRange: 3,
+		Unparsable: 1,
+		Filtered:   1,
+	}))
+}
+
+func TestImagePolicyReconciler_ExplainHandler(t *testing.T) {
+	repo, obj, db := newExplainTestObjects()
+	obj.Status.LatestImage = "foo/bar:v1.1.0"
+	c := fake.NewClientBuilder().
+		WithObjects(repo, obj).
+		Build()
+	r := &ImagePolicyReconciler{
+		Client:   c,
+		Database: db,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantTags   []policy.TagExplanation
+	}{
+		{
+			name:       "explains the tags",
+			path:       ExplainPath + "default/test-policy",
+			wantStatus: http.StatusOK,
+			wantTags: []policy.TagExplanation{
+				{Tag: "v1.1.0", Verdict: policy.VerdictSelected},
+				{Tag: "v1.0.0", Verdict: policy.VerdictOutranked},
+				{Tag: "main", Verdict: policy.VerdictFiltered},
+				{Tag: "v2.0.0", Verdict: policy.VerdictOutOfRange},
+				{Tag: "vlatest", Verdict: policy.VerdictUnparsable},
+			},
+		},
+		{
+			name:       "limits the explained tags",
+			path:       ExplainPath + "default/test-policy?limit=1",
+			wantStatus: http.StatusOK,
+			wantTags: []policy.TagExplanation{
+				{Tag: "v1.1.0", Verdict: policy.VerdictSelected},
+			},
+		},
+		{
+			name:       "invalid limit",
+			path:       ExplainPath + "default/test-policy?limit=none",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid path",
+			path:       ExplainPath + "default",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "policy not found",
+			path:       ExplainPath + "default/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			path:       ExplainPath + "default/test-policy",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			r.ExplainHandler().ServeHTTP(rec, httptest.NewRequest(method, tt.path, nil))
+			g.Expect(rec.Code).To(Equal(tt.wantStatus))
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp imagePolicyExplanation
+			g.Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			g.Expect(resp.LatestImage).To(Equal("foo/bar:v1.1.0"))
+			g.Expect(resp.Explanation.Tags).To(Equal(tt.wantTags))
+			g.Expect(resp.Explanation.Counts).To(HaveLen(5))
+		})
+	}
+}
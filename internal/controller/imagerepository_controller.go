@@ -54,12 +54,11 @@ import (
 	"github.com/fluxcd/pkg/runtime/reconcile"
 
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/image-reflector-controller/internal/database"
+	"github.com/fluxcd/image-reflector-controller/internal/policy"
 	"github.com/fluxcd/image-reflector-controller/internal/secret"
 )
 
-// latestTagsCount is the number of tags to use as latest tags.
-const latestTagsCount = 10
-
 // imageRepositoryOwnedConditions is a list of conditions owned by the
 // ImageRepositoryReconciler.
 var imageRepositoryOwnedConditions = []string{
@@ -82,10 +81,16 @@ const (
 	scanReasonReconcileRequested   = "reconcile requested"
 	scanReasonNewImageName         = "new image name"
 	scanReasonUpdatedExclusionList = "updated exclusion list"
+	scanReasonUpdatedLatestTags    = "updated latest tags order or count"
 	scanReasonEmptyDatabase        = "no tags in database"
 	scanReasonInterval             = "triggered by interval"
 )
 
+// orphanedTagsGracePeriod is the period during which the recorded tags aren't
+// swept as orphaned, longer than the resolution of their last seen time, so
+// that the tags being scanned are kept.
+const orphanedTagsGracePeriod = 2 * time.Hour
+
 // getPatchOptions composes patch options based on the given parameters.
 // It is used as the options used when patching an object.
 func getPatchOptions(ownedConditions []string, controllerName string) []patch.Option {
@@ -113,6 +118,25 @@ type ImageRepositoryReconciler struct {
 		DatabaseReader
 	}
 	DeprecatedLoginOpts login.ProviderOptions
+	// SharedTagsDatabase records the tags keyed by canonical image name
+	// rather than scoped to the ImageRepository objects, sharing them between
+	// the ImageRepositories of the same image.
+	SharedTagsDatabase bool
+	// DigestLookups is the maximum number of tags of which the digest is
+	// resolved on every scan, the latest tags first, when the Database
+	// records digests. The digests of the tags are resolved once. Disabled
+	// when 0.
+	DigestLookups int
+	// WatchNamespace is the namespace of the watched ImageRepositories, all
+	// namespaces if empty. The tags of the ImageRepositories of the other
+	// namespaces aren't swept.
+	WatchNamespace string
+	// APIReader reads the ImageRepositories from the API server rather than
+	// the cache when sweeping the orphaned tags.
+	APIReader client.Reader
+	// DatabaseReady is closed once the Database is ready to be used, e.g. its
+	// keys migrated. The reconciliations wait for it when not nil.
+	DatabaseReady <-chan struct{}
 
 	patchOptions []patch.Option
 }
@@ -134,6 +158,9 @@ func (r *ImageRepositoryReconciler) SetupWithManager(mgr ctrl.Manager, opts Imag
 }
 
 func (r *ImageRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, retErr error) {
+	if err := waitForDatabase(ctx, r.DatabaseReady); err != nil {
+		return ctrl.Result{}, err
+	}
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
@@ -265,6 +292,15 @@ func (r *ImageRepositoryReconciler) reconcile(ctx context.Context, sp *patch.Ser
 		return
 	}
 
+	// Consider the tags recorded for a never scanned ImageRepository, e.g.
+	// imported from an archive in a new cluster, as its last scan.
+	if err := r.restoreScanResult(obj, ref); err != nil {
+		e := fmt.Errorf("failed to read the recorded tags: %w", err)
+		conditions.MarkFalse(obj, meta.ReadyCondition, metav1.StatusFailure, e.Error())
+		result, retErr = ctrl.Result{}, e
+		return
+	}
+
 	// Check if it can be scanned now.
 	ok, when, reasonMsg, err := r.shouldScan(*obj, startTime)
 	if err != nil {
@@ -438,10 +474,11 @@ func (r *ImageRepositoryReconciler) setAuthOptions(ctx context.Context, obj *ima
 // the repository should be scanned now, and how long to wait for the
 // next scan. It also returns the reason for the scan.
 // It returns immediate scan if
-//   - the repository is never scanned before
+//   - the repository is never scanned before, see restoreScanResult
 //   - reconcile annotation is set on the object with a new value
 //   - the image URL has changed
 //   - the exclusion list has changed
+//   - the order or the number of the latest tags has changed
 //   - there's no tag in the database
 //   - the difference between current time and last time is more than the scan
 //     interval
@@ -481,6 +518,14 @@ func (r *ImageRepositoryReconciler) shouldScan(obj imagev1.ImageRepository, now
 		return true, scanInterval, scanReasonUpdatedExclusionList, nil
 	}
 
+	// If the order or the number of the latest tags has changed, scan now.
+	// They aren't observed for the scan results of the previous versions.
+	if obj.Status.ObservedLatestTagsOrder != "" &&
+		(obj.GetLatestTagsOrder() != obj.Status.ObservedLatestTagsOrder ||
+			obj.GetLatestTagsCount() != obj.Status.ObservedLatestTagsCount) {
+		return true, scanInterval, scanReasonUpdatedLatestTags, nil
+	}
+
 	// when recovering, it's possible that the resource has a last
 	// scan time, but there's no records because the database has been
 	// dropped and created again.
@@ -488,7 +533,7 @@ func (r *ImageRepositoryReconciler) shouldScan(obj imagev1.ImageRepository, now
 	// FIXME If the repo exists, has been
 	// scanned, and doesn't have any tags, this will mean a scan every
 	// time the resource comes up for reconciliation.
-	tags, err := r.Database.Tags(obj.Status.CanonicalImageName)
+	tags, err := r.Database.Tags(tagsKey(&obj, r.SharedTagsDatabase))
 	if err != nil {
 		return false, scanInterval, "", err
 	}
@@ -523,16 +568,34 @@ func (r *ImageRepositoryReconciler) scan(ctx context.Context, obj *imagev1.Image
 	}
 
 	canonicalName := ref.Context().String()
-	if err := r.Database.SetTags(canonicalName, filteredTags); err != nil {
+	key := database.RepositoryKey(obj.Namespace, obj.Name, canonicalName, r.SharedTagsDatabase)
+	// Keep the known tags in the order they were first seen, for the latest
+	// tags to be ordered by it.
+	if obj.GetLatestTagsOrder() == imagev1.LatestTagsOrderFirstSeen {
+		knownTags, err := r.Database.Tags(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read tags for %q: %w", canonicalName, err)
+		}
+		filteredTags = firstSeenOrder(knownTags, filteredTags)
+	}
+	if err := r.Database.SetTags(key, filteredTags); err != nil {
 		return 0, fmt.Errorf("failed to set tags for %q: %w", canonicalName, err)
 	}
+	// The digests that can't be resolved don't fail the scan, they are
+	// looked up again on the next scan.
+	if err := r.resolveDigests(ctx, obj, ref, key, filteredTags, options); err != nil {
+		eventLogf(ctx, r.EventRecorder, obj, corev1.EventTypeWarning, imagev1.ReadOperationFailedReason,
+			"failed to resolve digests for %q: %s", canonicalName, err)
+	}
 
 	scanTime := metav1.Now()
 	obj.Status.LastScanResult = &imagev1.ScanResult{
 		TagCount:   len(filteredTags),
 		ScanTime:   scanTime,
-		LatestTags: getLatestTags(filteredTags),
+		LatestTags: getLatestTags(filteredTags, obj.GetLatestTagsOrder(), obj.GetLatestTagsCount()),
 	}
+	obj.Status.ObservedLatestTagsOrder = obj.GetLatestTagsOrder()
+	obj.Status.ObservedLatestTagsCount = obj.GetLatestTagsCount()
 
 	// If the reconcile request annotation was set, consider it
 	// handled (NB it doesn't matter here if it was changed since last
@@ -544,8 +607,68 @@ func (r *ImageRepositoryReconciler) scan(ctx context.Context, obj *imagev1.Image
 	return len(filteredTags), nil
 }
 
+// resolveDigests looks up the digests of at most DigestLookups of the given
+// tags of which no digest is recorded yet, the latest tags first, and records
+// them in the database. It returns an error if any of the tags can't be
+// resolved, e.g. deleted since they were listed, after recording the others.
+func (r *ImageRepositoryReconciler) resolveDigests(ctx context.Context, obj *imagev1.ImageRepository, ref name.Reference,
+	key string, tags []string, options []remote.Option) error {
+	dr, ok := r.Database.(DigestReader)
+	if !ok || r.DigestLookups <= 0 {
+		return nil
+	}
+	dw, ok := r.Database.(DigestWriter)
+	if !ok {
+		return nil
+	}
+	known, err := dr.Digests(key)
+	if err != nil {
+		return err
+	}
+
+	resolved := map[string]string{}
+	lookups, failed := 0, 0
+	var lookupErr error
+	for _, tag := range rankTags(tags, obj.GetLatestTagsOrder()) {
+		if lookups >= r.DigestLookups {
+			break
+		}
+		if _, ok := known[tag]; ok {
+			continue
+		}
+		lookups++
+		desc, err := remote.Head(ref.Context().Tag(tag), options...)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			failed++
+			lookupErr = fmt.Errorf("tag '%s': %w", tag, err)
+			continue
+		}
+		resolved[tag] = desc.Digest.String()
+	}
+	if len(resolved) > 0 {
+		if err := dw.SetDigests(key, resolved); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to resolve %d of %d digests, last error: %w", failed, lookups, lookupErr)
+	}
+	return nil
+}
+
 // reconcileDelete handles the deletion of the object.
 func (r *ImageRepositoryReconciler) reconcileDelete(ctx context.Context, obj *imagev1.ImageRepository) (ctrl.Result, error) {
+	// Purge the tags of the object from the database before letting it go.
+	if err := r.deleteTags(ctx, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to delete tags from database: %w", err)
+	}
+
 	// Remove our finalizer from the list.
 	controllerutil.RemoveFinalizer(obj, imagev1.ImageFinalizer)
 
@@ -553,6 +676,174 @@ func (r *ImageRepositoryReconciler) reconcileDelete(ctx context.Context, obj *im
 	return ctrl.Result{}, nil
 }
 
+// deleteTags deletes the tags of the given ImageRepository from the database.
+// Shared tags are kept as long as another ImageRepository of the same
+// canonical image name refers to them.
+func (r *ImageRepositoryReconciler) deleteTags(ctx context.Context, obj *imagev1.ImageRepository) error {
+	if obj.Status.CanonicalImageName == "" {
+		return nil
+	}
+	if r.SharedTagsDatabase {
+		refs, err := r.countTagsReferences(ctx, obj)
+		if err != nil {
+			return err
+		}
+		if refs > 0 {
+			return nil
+		}
+	}
+	return r.Database.DeleteTags(tagsKey(obj, r.SharedTagsDatabase))
+}
+
+// countTagsReferences returns the number of the other ImageRepositories, not
+// being deleted, sharing the canonical image name of the given one.
+func (r *ImageRepositoryReconciler) countTagsReferences(ctx context.Context, obj *imagev1.ImageRepository) (int, error) {
+	var repos imagev1.ImageRepositoryList
+	if err := r.List(ctx, &repos); err != nil {
+		return 0, err
+	}
+	refs := 0
+	for _, repo := range repos.Items {
+		if repo.UID == obj.UID || !repo.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if repo.Status.CanonicalImageName == obj.Status.CanonicalImageName {
+			refs++
+		}
+	}
+	return refs, nil
+}
+
+// SweepOrphanedTags deletes the tags recorded in the database for which no
+// ImageRepository exists anymore, e.g. ImageRepositories deleted while the
+// controller was not running. It returns the number of deleted tag sets, and
+// does nothing if the Database does not implement RepositoryLister.
+//
+// The ImageRepositories are read from the API server, in the watched
+// namespace but regardless of the label selector, so that the tags of the
+// ImageRepositories of the other controller shards sharing the database aren't
+// seen as orphans. Only the tags of the watched namespace are swept, and the
+// tags recorded within orphanedTagsGracePeriod are kept.
+func (r *ImageRepositoryReconciler) SweepOrphanedTags(ctx context.Context) (int, error) {
+	lister, ok := r.Database.(RepositoryLister)
+	if !ok {
+		return 0, nil
+	}
+	// List the recorded tags first, so that the tags recorded by a scan in
+	// the meantime are not seen as orphans.
+	keys, err := lister.Repositories()
+	if err != nil {
+		return 0, err
+	}
+
+	var repos imagev1.ImageRepositoryList
+	if err := r.APIReader.List(ctx, &repos, client.InNamespace(r.WatchNamespace)); err != nil {
+		return 0, err
+	}
+	inUse := make(map[string]struct{}, len(repos.Items))
+	for i := range repos.Items {
+		if repos.Items[i].Status.CanonicalImageName != "" {
+			inUse[tagsKey(&repos.Items[i], r.SharedTagsDatabase)] = struct{}{}
+		}
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := inUse[key]; ok || !r.sweepable(key) {
+			continue
+		}
+		recent, err := r.recentlyRecorded(key, time.Now())
+		if err != nil {
+			return deleted, err
+		}
+		if recent {
+			continue
+		}
+		if err := r.Database.DeleteTags(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// sweepable returns whether the tags of the given key belong to the watched
+// namespace. The tags shared by canonical image name belong to any namespace,
+// and are only swept when watching all namespaces.
+func (r *ImageRepositoryReconciler) sweepable(key string) bool {
+	if r.WatchNamespace == "" {
+		return true
+	}
+	namespace, scoped := database.KeyNamespace(key)
+	return scoped && namespace == r.WatchNamespace
+}
+
+// restoreScanResult sets the last scan result of an ImageRepository that was
+// never scanned from the tags recorded under its key, as the result of a scan
+// at the time the tags were last seen, so that it's scanned on its interval.
+// It does nothing if no tags are recorded, if the Database does not implement
+// HistoryReader, or with SharedTagsDatabase, as the shared tags may have been
+// scanned with the credentials of another ImageRepository.
+func (r *ImageRepositoryReconciler) restoreScanResult(obj *imagev1.ImageRepository, ref name.Reference) error {
+	if obj.Status.LastScanResult != nil || r.SharedTagsDatabase {
+		return nil
+	}
+	hr, ok := r.Database.(HistoryReader)
+	if !ok {
+		return nil
+	}
+	canonicalName := ref.Context().String()
+	key := database.RepositoryKey(obj.Namespace, obj.Name, canonicalName, false)
+	tags, err := r.Database.Tags(key)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	records, err := hr.History(key)
+	if err != nil {
+		return err
+	}
+	var lastSeen time.Time
+	for _, record := range records {
+		if record.LastSeen.After(lastSeen) {
+			lastSeen = record.LastSeen
+		}
+	}
+
+	obj.Status.CanonicalImageName = canonicalName
+	obj.Status.ObservedExclusionList = obj.GetExclusionList()
+	obj.Status.LastScanResult = &imagev1.ScanResult{
+		TagCount:   len(tags),
+		ScanTime:   metav1.NewTime(lastSeen),
+		LatestTags: getLatestTags(tags, obj.GetLatestTagsOrder(), obj.GetLatestTagsCount()),
+	}
+	obj.Status.ObservedLatestTagsOrder = obj.GetLatestTagsOrder()
+	obj.Status.ObservedLatestTagsCount = obj.GetLatestTagsCount()
+	return nil
+}
+
+// recentlyRecorded returns whether the tags of the given key were first seen,
+// last seen or disappeared within orphanedTagsGracePeriod of the given time,
+// e.g. scanned for an ImageRepository created after it was listed. It returns
+// false if the Database does not implement HistoryReader.
+func (r *ImageRepositoryReconciler) recentlyRecorded(key string, now time.Time) (bool, error) {
+	hr, ok := r.Database.(HistoryReader)
+	if !ok {
+		return false, nil
+	}
+	records, err := hr.History(key)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		for _, t := range []time.Time{record.FirstSeen, record.LastSeen, record.Disappeared} {
+			if now.Sub(t) < orphanedTagsGracePeriod {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 // eventLogf records events, and logs at the same time.
 //
 // This log is different from the debug log in the EventRecorder, in the sense
@@ -619,17 +910,77 @@ func filterOutTags(tags []string, patterns []string) ([]string, error) {
 	return filteredTags, nil
 }
 
-// getLatestTags takes a slice of tags, sorts them in descending order of their
-// values and returns the 10 latest tags.
-func getLatestTags(tags []string) []string {
+// getLatestTags takes a slice of tags, sorts them from the latest in the given
+// order and returns the given number of latest tags. The tags that can't be
+// ordered by the policy of the order follow in descending alphabetical order.
+// For the first-seen order, the tags must be in the order they were first
+// seen.
+func getLatestTags(tags []string, order string, count int) []string {
+	if len(tags) == 0 {
+		return nil
+	}
 	var result []string
-	sort.SliceStable(tags, func(i, j int) bool { return tags[i] > tags[j] })
-
-	if len(tags) >= latestTagsCount {
-		latestTags := tags[0:latestTagsCount]
-		result = append(result, latestTags...)
+	if order == imagev1.LatestTagsOrderFirstSeen {
+		for i := len(tags) - 1; i >= 0; i-- {
+			result = append(result, tags[i])
+		}
 	} else {
-		result = append(result, tags...)
+		result = rankTags(tags, order)
+	}
+
+	if len(result) > count {
+		result = result[:count]
+	}
+	return result
+}
+
+// rankTags returns the given tags ordered from the latest by the policy of
+// the given order, followed by the tags the policy can't order in descending
+// alphabetical order.
+func rankTags(tags []string, order string) []string {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	p, err := policy.PolicerFromLatestTagsOrder(order)
+	if err != nil {
+		return sorted
+	}
+	ranked, err := p.Rank(tags)
+	if err != nil {
+		return sorted
+	}
+	rankedTags := make(map[string]struct{}, len(ranked))
+	for _, tag := range ranked {
+		rankedTags[tag] = struct{}{}
+	}
+	for _, tag := range sorted {
+		if _, ok := rankedTags[tag]; !ok {
+			ranked = append(ranked, tag)
+		}
+	}
+	return ranked
+}
+
+// firstSeenOrder returns the given tags in the order they were first seen:
+// the known tags still present in their order, followed by the new tags.
+func firstSeenOrder(knownTags, tags []string) []string {
+	present := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		present[tag] = struct{}{}
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range knownTags {
+		if _, ok := present[tag]; ok {
+			result = append(result, tag)
+			seen[tag] = struct{}{}
+		}
+	}
+	for _, tag := range tags {
+		if _, ok := seen[tag]; !ok {
+			result = append(result, tag)
+		}
 	}
 	return result
 }
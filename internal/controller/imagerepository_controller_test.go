@@ -27,6 +27,7 @@ import (
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,15 +37,20 @@ import (
 	"github.com/fluxcd/pkg/runtime/conditions"
 
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/image-reflector-controller/internal/database"
 	"github.com/fluxcd/image-reflector-controller/internal/secret"
 	"github.com/fluxcd/image-reflector-controller/internal/test"
 )
 
 // mockDatabase mocks the image repository database.
 type mockDatabase struct {
-	TagData    []string
-	ReadError  error
-	WriteError error
+	TagData     []string
+	DigestData  map[string]string
+	DeletedRepo []string
+	ReadError   error
+	WriteError  error
+	// DigestWriteError is returned when recording digests only.
+	DigestWriteError error
 }
 
 // SetTags implements the DatabaseWriter interface of the Database.
@@ -56,6 +62,15 @@ func (db *mockDatabase) SetTags(repo string, tags []string) error {
 	return nil
 }
 
+// DeleteTags implements the DatabaseWriter interface of the Database.
+func (db *mockDatabase) DeleteTags(repo string) error {
+	if db.WriteError != nil {
+		return db.WriteError
+	}
+	db.DeletedRepo = append(db.DeletedRepo, repo)
+	return nil
+}
+
 // Tags implements the DatabaseReader interface of the Database.
 func (db mockDatabase) Tags(repo string) ([]string, error) {
 	if db.ReadError != nil {
@@ -64,6 +79,31 @@ func (db mockDatabase) Tags(repo string) ([]string, error) {
 	return db.TagData, nil
 }
 
+// Digests implements the DigestReader interface of the Database.
+func (db mockDatabase) Digests(repo string) (map[string]string, error) {
+	if db.ReadError != nil {
+		return nil, db.ReadError
+	}
+	return db.DigestData, nil
+}
+
+// SetDigests implements the DigestWriter interface of the Database.
+func (db *mockDatabase) SetDigests(repo string, digests map[string]string) error {
+	if db.WriteError != nil {
+		return db.WriteError
+	}
+	if db.DigestWriteError != nil {
+		return db.DigestWriteError
+	}
+	if db.DigestData == nil {
+		db.DigestData = map[string]string{}
+	}
+	for tag, digest := range digests {
+		db.DigestData[tag] = digest
+	}
+	return nil
+}
+
 func TestImageRepositoryReconciler_deleteBeforeFinalizer(t *testing.T) {
 	g := NewWithT(t)
 
@@ -98,6 +138,27 @@ func TestImageRepositoryReconciler_deleteBeforeFinalizer(t *testing.T) {
 	g.Expect(err).NotTo(HaveOccurred())
 }
 
+func TestImageRepositoryReconciler_waitForDatabase(t *testing.T) {
+	g := NewWithT(t)
+
+	ready := make(chan struct{})
+	r := &ImageRepositoryReconciler{
+		Client:        fake.NewClientBuilder().Build(),
+		DatabaseReady: ready,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "missing"}}
+
+	// The reconciliation waits for the database.
+	timeoutCtx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err := r.Reconcile(timeoutCtx, req)
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+
+	close(ready)
+	_, err = r.Reconcile(context.TODO(), req)
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
 func TestImageRepositoryReconciler_setAuthOptions(t *testing.T) {
 	testImg := "example.com/foo/bar"
 	testSecretName := "test-secret"
@@ -413,6 +474,53 @@ func TestImageRepositoryReconciler_shouldScan(t *testing.T) {
 			wantNextScan: time.Minute,
 			wantReason:   scanReasonUpdatedExclusionList,
 		},
+		{
+			name:          "latest tags order change",
+			reconcileTime: time.Now(),
+			beforeFunc: func(obj *imagev1.ImageRepository, reconcileTime time.Time) {
+				obj.Spec.LatestTagsOrder = imagev1.LatestTagsOrderSemVer
+				obj.Status.ObservedLatestTagsOrder = imagev1.LatestTagsOrderAlphabetical
+				obj.Status.ObservedLatestTagsCount = obj.GetLatestTagsCount()
+				obj.Status.CanonicalImageName = testImage
+				obj.Status.LastScanResult = &imagev1.ScanResult{
+					ScanTime: metav1.NewTime(reconcileTime.Add(-time.Second * 30)),
+				}
+			},
+			db:           &mockDatabase{TagData: []string{"foo"}},
+			wantScan:     true,
+			wantNextScan: time.Minute,
+			wantReason:   scanReasonUpdatedLatestTags,
+		},
+		{
+			name:          "latest tags count change",
+			reconcileTime: time.Now(),
+			beforeFunc: func(obj *imagev1.ImageRepository, reconcileTime time.Time) {
+				obj.Spec.LatestTagsCount = 5
+				obj.Status.ObservedLatestTagsOrder = obj.GetLatestTagsOrder()
+				obj.Status.ObservedLatestTagsCount = 10
+				obj.Status.CanonicalImageName = testImage
+				obj.Status.LastScanResult = &imagev1.ScanResult{
+					ScanTime: metav1.NewTime(reconcileTime.Add(-time.Second * 30)),
+				}
+			},
+			db:           &mockDatabase{TagData: []string{"foo"}},
+			wantScan:     true,
+			wantNextScan: time.Minute,
+			wantReason:   scanReasonUpdatedLatestTags,
+		},
+		{
+			name:          "latest tags not observed",
+			reconcileTime: time.Now(),
+			beforeFunc: func(obj *imagev1.ImageRepository, reconcileTime time.Time) {
+				obj.Spec.LatestTagsCount = 5
+				obj.Status.CanonicalImageName = testImage
+				obj.Status.LastScanResult = &imagev1.ScanResult{
+					ScanTime: metav1.NewTime(reconcileTime.Add(-time.Second * 30)),
+				}
+			},
+			db:           &mockDatabase{TagData: []string{"foo"}},
+			wantNextScan: time.Second * 30,
+		},
 		{
 			name:          "no tags",
 			reconcileTime: time.Now(),
@@ -487,6 +595,62 @@ func TestImageRepositoryReconciler_shouldScan(t *testing.T) {
 	}
 }
 
+func TestImageRepositoryReconciler_restoreScanResult(t *testing.T) {
+	g := NewWithT(t)
+
+	lastSeen := time.Now().Add(-30 * time.Second).UTC().Truncate(time.Second)
+	db := database.NewMemoryDatabase()
+	imported := &imagev1.ImageRepository{}
+	imported.Name = "imported"
+	imported.Namespace = "default"
+	imported.Spec.Image = "ghcr.io/foo/bar"
+	imported.Spec.Interval = metav1.Duration{Duration: time.Minute}
+	imported.Spec.ExclusionList = []string{"^.*\\.sig$"}
+	g.Expect(db.SetHistory(database.RepositoryKey("default", "imported", "ghcr.io/foo/bar", false), []database.TagRecord{
+		{Tag: "1.0.0", FirstSeen: lastSeen.Add(-time.Hour), LastSeen: lastSeen.Add(-time.Hour)},
+		{Tag: "1.0.1", FirstSeen: lastSeen, LastSeen: lastSeen},
+	})).To(Succeed())
+	notRecorded := imported.DeepCopy()
+	notRecorded.Name = "not-recorded"
+
+	r := &ImageRepositoryReconciler{Database: db}
+	ref, err := parseImageReference(imported.Spec.Image)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The recorded tags are the last scan, of which the interval isn't
+	// elapsed yet.
+	g.Expect(r.restoreScanResult(imported, ref)).To(Succeed())
+	g.Expect(imported.Status.CanonicalImageName).To(Equal("ghcr.io/foo/bar"))
+	g.Expect(imported.Status.ObservedExclusionList).To(Equal(imported.Spec.ExclusionList))
+	g.Expect(imported.Status.LastScanResult).ToNot(BeNil())
+	g.Expect(imported.Status.LastScanResult.TagCount).To(Equal(2))
+	g.Expect(imported.Status.LastScanResult.ScanTime.Time).To(BeTemporally("==", lastSeen))
+	g.Expect(imported.Status.LastScanResult.LatestTags).To(Equal([]string{"1.0.1", "1.0.0"}))
+	scan, _, _, err := r.shouldScan(*imported, time.Now())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(scan).To(BeFalse())
+
+	g.Expect(r.restoreScanResult(notRecorded, ref)).To(Succeed())
+	g.Expect(notRecorded.Status.LastScanResult).To(BeNil())
+	_, _, reason, err := r.shouldScan(*notRecorded, time.Now())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reason).To(Equal(scanReasonNeverScanned))
+
+	// The shared tags may have been scanned with the credentials of another
+	// ImageRepository, which is scanned instead.
+	g.Expect(db.SetHistory(database.RepositoryKey("", "", "ghcr.io/foo/bar", true), []database.TagRecord{
+		{Tag: "1.0.1", FirstSeen: lastSeen, LastSeen: lastSeen},
+	})).To(Succeed())
+	shared := notRecorded.DeepCopy()
+	shared.Name = "shared"
+	r.SharedTagsDatabase = true
+	g.Expect(r.restoreScanResult(shared, ref)).To(Succeed())
+	g.Expect(shared.Status.LastScanResult).To(BeNil())
+	_, _, reason, err = r.shouldScan(*shared, time.Now())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reason).To(Equal(scanReasonNeverScanned))
+}
+
 func TestImageRepositoryReconciler_scan(t *testing.T) {
 	registryServer := test.NewRegistryServer()
 	defer registryServer.Close()
@@ -496,10 +660,13 @@ func TestImageRepositoryReconciler_scan(t *testing.T) {
 		tags           []string
 		exclusionList  []string
 		annotation     string
+		digestLookups  int
 		db             *mockDatabase
 		wantErr        bool
 		wantTags       []string
 		wantLatestTags []string
+		wantDigests    []string
+		wantWarning    bool
 	}{
 		{
 			name:    "no tags",
@@ -547,6 +714,24 @@ func TestImageRepositoryReconciler_scan(t *testing.T) {
 			db:      &mockDatabase{WriteError: errors.New("fail")},
 			wantErr: true,
 		},
+		{
+			name:           "with digest lookups",
+			tags:           []string{"a", "b", "c", "d"},
+			digestLookups:  2,
+			db:             &mockDatabase{DigestData: map[string]string{"d": "sha256:d"}},
+			wantTags:       []string{"a", "b", "c", "d"},
+			wantLatestTags: []string{"d", "c", "b", "a"},
+			wantDigests:    []string{"b", "c"},
+		},
+		{
+			name:           "digest write fails",
+			tags:           []string{"a", "b"},
+			digestLookups:  2,
+			db:             &mockDatabase{DigestWriteError: errors.New("fail")},
+			wantTags:       []string{"a", "b"},
+			wantLatestTags: []string{"b", "a"},
+			wantWarning:    true,
+		},
 		{
 			name:           "with reconcile annotation",
 			tags:           []string{"a", "b"},
@@ -564,9 +749,11 @@ func TestImageRepositoryReconciler_scan(t *testing.T) {
 			imgRepo, err := test.LoadImages(registryServer, "test-fetch-"+randStringRunes(5), tt.tags)
 			g.Expect(err).ToNot(HaveOccurred())
 
+			recorder := record.NewFakeRecorder(32)
 			r := ImageRepositoryReconciler{
-				EventRecorder: record.NewFakeRecorder(32),
+				EventRecorder: recorder,
 				Database:      tt.db,
+				DigestLookups: tt.digestLookups,
 				patchOptions:  getPatchOptions(imageRepositoryOwnedConditions, "irc"),
 			}
 
@@ -585,6 +772,10 @@ func TestImageRepositoryReconciler_scan(t *testing.T) {
 
 			opts := []remote.Option{}
 
+			var knownDigests int
+			if tt.db != nil {
+				knownDigests = len(tt.db.DigestData)
+			}
 			tagCount, err := r.scan(context.TODO(), repo, ref, opts)
 			g.Expect(err != nil).To(Equal(tt.wantErr))
 			if err == nil {
@@ -595,15 +786,183 @@ func TestImageRepositoryReconciler_scan(t *testing.T) {
 				if tt.annotation != "" {
 					g.Expect(repo.Status.LastHandledReconcileAt).To(Equal(tt.annotation))
 				}
+				for _, tag := range tt.wantDigests {
+					desc, err := remote.Head(ref.Context().Tag(tag))
+					g.Expect(err).ToNot(HaveOccurred())
+					g.Expect(tt.db.DigestData).To(HaveKeyWithValue(tag, desc.Digest.String()))
+				}
+				g.Expect(tt.db.DigestData).To(HaveLen(knownDigests + len(tt.wantDigests)))
+			}
+			if tt.wantWarning {
+				g.Expect(recorder.Events).To(Receive(HavePrefix(corev1.EventTypeWarning)))
+			} else {
+				g.Expect(recorder.Events).ToNot(Receive())
+			}
+		})
+	}
+}
+
+func TestImageRepositoryReconciler_reconcileDelete(t *testing.T) {
+	newRepo := func(namespace, name, image string) *imagev1.ImageRepository {
+		repo := &imagev1.ImageRepository{}
+		repo.Name = name
+		repo.Namespace = namespace
+		repo.UID = types.UID(namespace + "/" + name)
+		repo.Spec.Image = image
+		repo.Status.CanonicalImageName = image
+		return repo
+	}
+
+	tests := []struct {
+		name        string
+		shared      bool
+		otherImage  string
+		wantDeleted bool
+	}{
+		{
+			name:        "scoped tags are deleted",
+			otherImage:  "ghcr.io/foo/bar",
+			wantDeleted: true,
+		},
+		{
+			name:       "shared tags referenced by another ImageRepository are kept",
+			shared:     true,
+			otherImage: "ghcr.io/foo/bar",
+		},
+		{
+			name:        "shared tags of the last ImageRepository are deleted",
+			shared:      true,
+			otherImage:  "ghcr.io/foo/baz",
+			wantDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := newRepo("tenant-a", "repo", "ghcr.io/foo/bar")
+			obj.Finalizers = []string{imagev1.ImageFinalizer}
+			other := newRepo("tenant-b", "repo", tt.otherImage)
+			db := repoDatabase{
+				tagsKey(obj, tt.shared):   {"1.0.0"},
+				tagsKey(other, tt.shared): {"1.0.0"},
+			}
+
+			r := &ImageRepositoryReconciler{
+				EventRecorder:      record.NewFakeRecorder(32),
+				Client:             fake.NewClientBuilder().WithObjects(obj, other).Build(),
+				Database:           db,
+				SharedTagsDatabase: tt.shared,
+			}
+
+			_, err := r.reconcileDelete(ctx, obj)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(obj.Finalizers).To(BeEmpty())
+			g.Expect(db).To(HaveKey(tagsKey(other, tt.shared)))
+			if tt.wantDeleted {
+				g.Expect(db).ToNot(HaveKey(tagsKey(obj, tt.shared)))
+			} else {
+				g.Expect(db).To(HaveKey(tagsKey(obj, tt.shared)))
 			}
 		})
 	}
+
+	t.Run("database error keeps the finalizer", func(t *testing.T) {
+		g := NewWithT(t)
+
+		obj := newRepo("tenant-a", "repo", "ghcr.io/foo/bar")
+		obj.Finalizers = []string{imagev1.ImageFinalizer}
+		r := &ImageRepositoryReconciler{
+			EventRecorder: record.NewFakeRecorder(32),
+			Client:        fake.NewClientBuilder().WithObjects(obj).Build(),
+			Database:      &mockDatabase{WriteError: errors.New("disk full")},
+		}
+
+		_, err := r.reconcileDelete(ctx, obj)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(obj.Finalizers).To(ContainElement(imagev1.ImageFinalizer))
+	})
+}
+
+func TestImageRepositoryReconciler_SweepOrphanedTags(t *testing.T) {
+	g := NewWithT(t)
+
+	repo := &imagev1.ImageRepository{}
+	repo.Name = "repo"
+	repo.Namespace = "default"
+	repo.Spec.Image = "ghcr.io/foo/bar"
+	repo.Status.CanonicalImageName = "ghcr.io/foo/bar"
+	deleted := repo.DeepCopy()
+	deleted.Name = "deleted"
+
+	otherNamespace := deleted.DeepCopy()
+	otherNamespace.Namespace = "other"
+	recent := deleted.DeepCopy()
+	recent.Name = "recent"
+	// An ImageRepository of another shard, not matching the label selector
+	// of the cache.
+	otherShard := deleted.DeepCopy()
+	otherShard.Name = "other-shard"
+
+	old := time.Now().Add(-3 * time.Hour).UTC().Truncate(time.Second)
+	oldRecords := []database.TagRecord{{Tag: "1.0.0", FirstSeen: old, LastSeen: old}}
+	db := database.NewMemoryDatabase()
+	for _, key := range []string{
+		tagsKey(repo, false),
+		tagsKey(deleted, false),
+		tagsKey(repo, true),
+		tagsKey(otherNamespace, false),
+		tagsKey(otherShard, false),
+	} {
+		g.Expect(db.SetHistory(key, oldRecords)).To(Succeed())
+	}
+	g.Expect(db.SetTags(tagsKey(recent, false), []string{"1.0.0"})).To(Succeed())
+
+	r := &ImageRepositoryReconciler{
+		APIReader:      fake.NewClientBuilder().WithObjects(repo, otherShard).Build(),
+		Database:       db,
+		WatchNamespace: "default",
+	}
+
+	n, err := r.SweepOrphanedTags(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).To(Equal(1))
+	keys, err := db.Repositories()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(keys).To(ConsistOf(
+		tagsKey(repo, false),
+		tagsKey(repo, true),
+		tagsKey(otherNamespace, false),
+		tagsKey(otherShard, false),
+		tagsKey(recent, false),
+	))
+
+	// When watching all namespaces, the shared tags and the tags of every
+	// namespace are swept.
+	r.WatchNamespace = ""
+	n, err = r.SweepOrphanedTags(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).To(Equal(2))
+	keys, err = db.Repositories()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(keys).To(ConsistOf(tagsKey(repo, false), tagsKey(otherShard, false), tagsKey(recent, false)))
+
+	// A Database that does not list its repositories is not swept.
+	n, err = (&ImageRepositoryReconciler{
+		APIReader: r.APIReader,
+		Database:  &mockDatabase{},
+	}).SweepOrphanedTags(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).To(BeZero())
 }
 
 func TestGetLatestTags(t *testing.T) {
 	tests := []struct {
 		name           string
 		tags           []string
+		order          string
+		count          int
 		wantLatestTags []string
 	}{
 		{
@@ -645,17 +1004,65 @@ func TestGetLatestTags(t *testing.T) {
 			tags:           []string{"aaa", "bbb", "ccc", "ddd", "eee", "fff", "ggg", "hhh", "iii", "jjj", "kkk", "lll"},
 			wantLatestTags: []string{"lll", "kkk", "jjj", "iii", "hhh", "ggg", "fff", "eee", "ddd", "ccc"},
 		},
+		{
+			name:           "semver order",
+			tags:           []string{"v9.0.0", "v10.0.0", "v10.1.0-rc.1", "latest", "v1.0.0", "main"},
+			order:          imagev1.LatestTagsOrderSemVer,
+			wantLatestTags: []string{"v10.1.0-rc.1", "v10.0.0", "v9.0.0", "v1.0.0", "main", "latest"},
+		},
+		{
+			name:           "numerical order with count",
+			tags:           []string{"9", "100", "latest", "10", "2"},
+			order:          imagev1.LatestTagsOrderNumerical,
+			count:          3,
+			wantLatestTags: []string{"100", "10", "9"},
+		},
+		{
+			name:           "numerical order without numerical tags",
+			tags:           []string{"aaa", "ccc", "bbb"},
+			order:          imagev1.LatestTagsOrderNumerical,
+			wantLatestTags: []string{"ccc", "bbb", "aaa"},
+		},
+		{
+			name:           "natural order",
+			tags:           []string{"build-9", "build-10", "build-100", "build-2"},
+			order:          imagev1.LatestTagsOrderNatural,
+			wantLatestTags: []string{"build-100", "build-10", "build-9", "build-2"},
+		},
+		{
+			name:           "first-seen order",
+			tags:           []string{"zzz", "aaa", "mmm"},
+			order:          imagev1.LatestTagsOrderFirstSeen,
+			count:          2,
+			wantLatestTags: []string{"mmm", "aaa"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			g.Expect(getLatestTags(tt.tags)).To(Equal(tt.wantLatestTags))
+			order := tt.order
+			if order == "" {
+				order = imagev1.LatestTagsOrderAlphabetical
+			}
+			count := tt.count
+			if count == 0 {
+				count = 10
+			}
+			g.Expect(getLatestTags(tt.tags, order, count)).To(Equal(tt.wantLatestTags))
 		})
 	}
 }
 
+func TestFirstSeenOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(firstSeenOrder(nil, []string{"b", "a"})).To(Equal([]string{"b", "a"}))
+	g.Expect(firstSeenOrder([]string{"c", "b", "a"}, []string{"a", "d", "c", "e"})).To(
+		Equal([]string{"c", "a", "d", "e"}))
+}
+
 func TestParseImageReference(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,302 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// ExportPath is the path of the endpoint exporting the database, served
+	// by the metrics server.
+	ExportPath = "/debug/database/export"
+
+	// archiveVersion is the version of the archive format.
+	archiveVersion = 1
+	// ociScheme prefixes the archive sources in OCI artifacts.
+	ociScheme = "oci://"
+)
+
+// The database archives are gzip compressed JSON documents, listing the tag
+// records of every repo:
+//
+//	{"version":1,"repositories":[{"repository":"...","tags":[{"tag":"...",
+//	"firstSeen":"...","lastSeen":"...","disappeared":"..."}]}]}
+//
+// The times are omitted when unknown. The version precedes the repositories,
+// for them to be decoded one by one.
+type archiveRepository struct {
+	Repository string       `json:"repository"`
+	Tags       []archiveTag `json:"tags"`
+}
+
+type archiveTag struct {
+	Tag         string     `json:"tag"`
+	FirstSeen   *time.Time `json:"firstSeen,omitempty"`
+	LastSeen    *time.Time `json:"lastSeen,omitempty"`
+	Disappeared *time.Time `json:"disappeared,omitempty"`
+	Digest      string     `json:"digest,omitempty"`
+}
+
+// Export writes an archive of the tag records of all the repos of the
+// database. It returns the number of exported repos.
+func Export(db Database, w io.Writer) (int, error) {
+	repos, err := db.Repositories()
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(repos)
+
+	gz := gzip.NewWriter(w)
+	// Write the repos one by one, rather than holding the whole database in
+	// memory.
+	if _, err := fmt.Fprintf(gz, `{"version":%d,"repositories":[`, archiveVersion); err != nil {
+		return 0, err
+	}
+	for i, repo := range repos {
+		records, err := db.History(repo)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read tags of '%s': %w", repo, err)
+		}
+		b, err := json.Marshal(archiveRepository{Repository: repo, Tags: archiveTags(records)})
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			b = append([]byte{','}, b...)
+		}
+		if _, err := gz.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.WriteString(gz, "]}"); err != nil {
+		return 0, err
+	}
+	return len(repos), gz.Close()
+}
+
+// Import records the tag records of the archive in the database, overwriting
+// the tag sets of the same repos. The tag sets archived with another key
+// scheme than the given one are recorded under the keys they are migrated to
+// by MigrateKeys. It returns the number of imported repos.
+func Import(db Database, r io.Reader, shared bool, objects []RepositoryObject) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid database archive: %w", err)
+	}
+	defer gz.Close()
+
+	// Decode the repos one by one, rather than holding the whole archive in
+	// memory.
+	dec := json.NewDecoder(gz)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, fmt.Errorf("invalid database archive: %w", err)
+	}
+	version, imported := 0, 0
+	for dec.More() {
+		field, err := dec.Token()
+		if err != nil {
+			return imported, fmt.Errorf("invalid database archive: %w", err)
+		}
+		switch field {
+		case "version":
+			err = dec.Decode(&version)
+		case "repositories":
+			if version != archiveVersion {
+				return 0, fmt.Errorf("unsupported database archive version %d", version)
+			}
+			err = expectDelim(dec, '[')
+			for err == nil && dec.More() {
+				var repo archiveRepository
+				if err = dec.Decode(&repo); err != nil {
+					break
+				}
+				if err := importRepository(db, repo, shared, objects); err != nil {
+					return imported, fmt.Errorf("failed to import tags of '%s': %w", repo.Repository, err)
+				}
+				imported++
+			}
+			if err == nil {
+				err = expectDelim(dec, ']')
+			}
+		default:
+			var ignored json.RawMessage
+			err = dec.Decode(&ignored)
+		}
+		if err != nil {
+			return imported, fmt.Errorf("invalid database archive: %w", err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return imported, fmt.Errorf("invalid database archive: %w", err)
+	}
+	if version != archiveVersion {
+		return imported, fmt.Errorf("unsupported database archive version %d", version)
+	}
+	return imported, nil
+}
+
+// importRepository records the tag records of the archived repo.
+func importRepository(db Database, repo archiveRepository, shared bool, objects []RepositoryObject) error {
+	records := tagRecords(repo.Tags)
+	if keys, ok := migratedKeys(repo.Repository, shared, objects); ok {
+		return setHistoryIfEmpty(db, keys, records)
+	}
+	return db.SetHistory(repo.Repository, records)
+}
+
+// expectDelim reads the next token of the decoder, which must be the given
+// delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected '%s', got %v", delim, t)
+	}
+	return nil
+}
+
+// ImportIfEmpty imports the archive of the given source in the database,
+// unless the database already records tags, so that the archive restores the
+// database on startup without overwriting the tags scanned since. The source
+// is either a file path, or an OCI artifact reference prefixed with 'oci://',
+// of which the first layer is the archive. It returns the number of imported
+// repos.
+func ImportIfEmpty(ctx context.Context, db Database, source string, shared bool, objects []RepositoryObject) (int, error) {
+	repos, err := db.Repositories()
+	if err != nil {
+		return 0, err
+	}
+	if len(repos) > 0 {
+		return 0, nil
+	}
+
+	rc, err := openArchive(ctx, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database archive '%s': %w", source, err)
+	}
+	defer rc.Close()
+	return Import(db, rc, shared, objects)
+}
+
+// openArchive opens the archive of the given source.
+func openArchive(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, ociScheme) {
+		return os.Open(source)
+	}
+
+	ref, err := name.ParseReference(strings.TrimPrefix(source, ociScheme))
+	if err != nil {
+		return nil, err
+	}
+	img, err := remote.Image(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("artifact has no layers")
+	}
+	// The layer is the archive as pushed, e.g. with 'oras push'.
+	return layers[0].Compressed()
+}
+
+// ExportHandler returns an HTTP handler serving the archive of the database. A
+// single archive is exported at a time, the concurrent requests are rejected.
+func ExportHandler(db Database) http.Handler {
+	exporting := make(chan struct{}, 1)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		select {
+		case exporting <- struct{}{}:
+			defer func() { <-exporting }()
+		default:
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "an export is already in progress", http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="image-reflector-database.json.gz"`)
+		if _, err := Export(db, w); err != nil {
+			// The status is already sent, abort the response for the client
+			// to see a truncated archive.
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+func archiveTags(records []TagRecord) []archiveTag {
+	tags := make([]archiveTag, len(records))
+	for i, r := range records {
+		tags[i] = archiveTag{
+			Tag:         r.Tag,
+			FirstSeen:   timeOrNil(r.FirstSeen),
+			LastSeen:    timeOrNil(r.LastSeen),
+			Disappeared: timeOrNil(r.Disappeared),
+			Digest:      r.Digest,
+		}
+	}
+	return tags
+}
+
+func tagRecords(tags []archiveTag) []TagRecord {
+	records := make([]TagRecord, len(tags))
+	for i, t := range tags {
+		records[i] = TagRecord{Tag: t.Tag, Digest: t.Digest}
+		for _, p := range []struct {
+			from *time.Time
+			to   *time.Time
+		}{
+			{t.FirstSeen, &records[i].FirstSeen},
+			{t.LastSeen, &records[i].LastSeen},
+			{t.Disappeared, &records[i].Disappeared},
+		} {
+			if p.from != nil {
+				*p.to = p.from.UTC().Truncate(time.Second)
+			}
+		}
+	}
+	return records
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
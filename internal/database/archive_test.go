@@ -0,0 +1,264 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+
+	"github.com/fluxcd/image-reflector-controller/internal/test"
+)
+
+// newArchiveTestDatabase returns a database with the history of two repos.
+func newArchiveTestDatabase(t *testing.T) Database {
+	t.Helper()
+	t0 := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	defer func() { now = time.Now }()
+
+	db := NewMemoryDatabase()
+	now = func() time.Time { return t0 }
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2", "v0.0.1"}))
+	fatalIfError(t, db.SetTags("another/repo", []string{"latest"}))
+	now = func() time.Time { return t0.Add(2 * time.Hour) }
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.3", "v0.0.2"}))
+	fatalIfError(t, db.SetDigests(testRepo, map[string]string{"v0.0.3": "sha256:0003"}))
+	return db
+}
+
+func assertSameDatabase(t *testing.T, want, got Database) {
+	t.Helper()
+	wantRepos, err := want.Repositories()
+	fatalIfError(t, err)
+	gotRepos, err := got.Repositories()
+	fatalIfError(t, err)
+	sort.Strings(wantRepos)
+	sort.Strings(gotRepos)
+	if !reflect.DeepEqual(wantRepos, gotRepos) {
+		t.Fatalf("got repos %#v, want %#v", gotRepos, wantRepos)
+	}
+	for _, repo := range wantRepos {
+		wantRecords, err := want.History(repo)
+		fatalIfError(t, err)
+		gotRecords, err := got.History(repo)
+		fatalIfError(t, err)
+		if !reflect.DeepEqual(wantRecords, gotRecords) {
+			t.Fatalf("got history %#v for '%s', want %#v", gotRecords, repo, wantRecords)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	db := newArchiveTestDatabase(t)
+	var buf bytes.Buffer
+	n, err := Export(db, &buf)
+	fatalIfError(t, err)
+	if n != 2 {
+		t.Fatalf("Export() exported %d repos, want 2", n)
+	}
+
+	imported := NewMemoryDatabase()
+	n, err = Import(imported, &buf, true, nil)
+	fatalIfError(t, err)
+	if n != 2 {
+		t.Fatalf("Import() imported %d repos, want 2", n)
+	}
+	assertSameDatabase(t, db, imported)
+}
+
+func TestImportMigratesKeys(t *testing.T) {
+	db := newArchiveTestDatabase(t)
+	var buf bytes.Buffer
+	_, err := Export(db, &buf)
+	fatalIfError(t, err)
+
+	// The shared tag sets of the archive are recorded under the scoped keys
+	// of the ImageRepositories of their image.
+	imported := NewMemoryDatabase()
+	objects := []RepositoryObject{
+		{Namespace: "default", Name: "repo", CanonicalName: testRepo},
+		{Namespace: "other", Name: "repo", CanonicalName: testRepo},
+	}
+	_, err = Import(imported, bytes.NewReader(buf.Bytes()), false, objects)
+	fatalIfError(t, err)
+	repos, err := imported.Repositories()
+	fatalIfError(t, err)
+	sort.Strings(repos)
+	scoped := RepositoryKey("default", "repo", testRepo, false)
+	otherScoped := RepositoryKey("other", "repo", testRepo, false)
+	if want := []string{scoped, otherScoped}; !reflect.DeepEqual(want, repos) {
+		t.Fatalf("Import() recorded %#v, want %#v", repos, want)
+	}
+	want, err := db.History(testRepo)
+	fatalIfError(t, err)
+	got, err := imported.History(otherScoped)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("History() got %#v after import, want %#v", got, want)
+	}
+
+	// The scoped tag sets of the archive are recorded under the shared key
+	// of their image.
+	buf.Reset()
+	_, err = Export(imported, &buf)
+	fatalIfError(t, err)
+	shared := NewMemoryDatabase()
+	_, err = Import(shared, &buf, true, nil)
+	fatalIfError(t, err)
+	repos, err = shared.Repositories()
+	fatalIfError(t, err)
+	if want := []string{testRepo}; !reflect.DeepEqual(want, repos) {
+		t.Fatalf("Import() recorded %#v, want %#v", repos, want)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	if _, err := Import(NewMemoryDatabase(), strings.NewReader("{}"), true, nil); err == nil {
+		t.Fatal("Import() returned no error for an uncompressed archive")
+	}
+
+	tests := []struct {
+		name     string
+		archive  string
+		imported int
+	}{
+		{name: "not an object", archive: `[]`},
+		{name: "unsupported version", archive: `{"version":2,"repositories":[{"repository":"a/repo","tags":[]}]}`},
+		{name: "version after the repositories", archive: `{"repositories":[],"version":1}`},
+		{name: "no version", archive: `{}`},
+		{
+			name:     "truncated",
+			archive:  `{"version":1,"repositories":[{"repository":"a/repo","tags":[{"tag":"v1"}]},{"repository":"b/re`,
+			imported: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write([]byte(tt.archive))
+			fatalIfError(t, err)
+			fatalIfError(t, gz.Close())
+
+			db := NewMemoryDatabase()
+			n, err := Import(db, &buf, true, nil)
+			if err == nil {
+				t.Fatal("Import() returned no error")
+			}
+			if n != tt.imported {
+				t.Fatalf("Import() imported %d repos, want %d", n, tt.imported)
+			}
+			repos, err := db.Repositories()
+			fatalIfError(t, err)
+			if len(repos) != tt.imported {
+				t.Fatalf("Import() recorded %#v", repos)
+			}
+		})
+	}
+}
+
+func TestImportIfEmpty(t *testing.T) {
+	db := newArchiveTestDatabase(t)
+	path := filepath.Join(t.TempDir(), "database.json.gz")
+	f, err := os.Create(path)
+	fatalIfError(t, err)
+	_, err = Export(db, f)
+	fatalIfError(t, err)
+	fatalIfError(t, f.Close())
+
+	imported := NewMemoryDatabase()
+	n, err := ImportIfEmpty(context.Background(), imported, path, true, nil)
+	fatalIfError(t, err)
+	if n != 2 {
+		t.Fatalf("ImportIfEmpty() imported %d repos, want 2", n)
+	}
+	assertSameDatabase(t, db, imported)
+
+	// A database with tags is left untouched.
+	fatalIfError(t, imported.SetTags(testRepo, []string{"v0.0.4"}))
+	n, err = ImportIfEmpty(context.Background(), imported, path, true, nil)
+	fatalIfError(t, err)
+	if n != 0 {
+		t.Fatalf("ImportIfEmpty() imported %d repos in a database with tags", n)
+	}
+	tags, err := imported.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual([]string{"v0.0.4"}, tags) {
+		t.Fatalf("ImportIfEmpty() overwrote tags with %#v", tags)
+	}
+}
+
+func TestImportIfEmptyOCI(t *testing.T) {
+	db := newArchiveTestDatabase(t)
+	var buf bytes.Buffer
+	_, err := Export(db, &buf)
+	fatalIfError(t, err)
+
+	srv := test.NewRegistryServer()
+	defer srv.Close()
+	ref, err := name.ParseReference(test.RegistryName(srv) + "/backups/image-reflector:latest")
+	fatalIfError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer(buf.Bytes(), "application/gzip"))
+	fatalIfError(t, err)
+	fatalIfError(t, remote.Write(ref, img))
+
+	imported := NewMemoryDatabase()
+	n, err := ImportIfEmpty(context.Background(), imported, "oci://"+ref.String(), true, nil)
+	fatalIfError(t, err)
+	if n != 2 {
+		t.Fatalf("ImportIfEmpty() imported %d repos, want 2", n)
+	}
+	assertSameDatabase(t, db, imported)
+}
+
+func TestExportHandler(t *testing.T) {
+	db := newArchiveTestDatabase(t)
+	srv := httptest.NewServer(ExportHandler(db))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	fatalIfError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	imported := NewMemoryDatabase()
+	_, err = Import(imported, resp.Body, true, nil)
+	fatalIfError(t, err)
+	assertSameDatabase(t, db, imported)
+
+	resp, err = http.Post(srv.URL, "application/gzip", nil)
+	fatalIfError(t, err)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST got status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -16,7 +16,7 @@ limitations under the License.
 package database
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 
 	"github.com/dgraph-io/badger/v3"
@@ -26,7 +26,10 @@ const tagsPrefix = "tags"
 
 // BadgerDatabase provides implementations of the tags database based on Badger.
 type BadgerDatabase struct {
-	db *badger.DB
+	db    *badger.DB
+	cache tagsCache
+	// recovered is the directory the corrupt database was moved to.
+	recovered string
 }
 
 // NewBadgerDatabase creates and returns a new database implementation using
@@ -37,6 +40,56 @@ func NewBadgerDatabase(db *badger.DB) *BadgerDatabase {
 	}
 }
 
+// OpenBadgerDatabase opens the Badger database in the storage path of the
+// given options, and returns a database implementation owning it.
+//
+// When an encryption key file is given, the database is encrypted with the
+// key. A database encrypted with the previous key, or not encrypted yet, is
+// rotated to the key first.
+//
+// When recovering corrupt databases, a database that can't be opened is moved
+// aside and replaced with an empty database.
+func OpenBadgerDatabase(opts Options) (*BadgerDatabase, error) {
+	badgerOpts := badger.DefaultOptions(opts.Path)
+	if opts.ValueLogFileSize > 0 {
+		badgerOpts.ValueLogFileSize = opts.ValueLogFileSize
+	}
+	if opts.EncryptionKeyFile != "" {
+		key, err := readEncryptionKey(opts.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var previousKeys [][]byte
+		if opts.PreviousEncryptionKeyFile != "" {
+			previous, err := readEncryptionKey(opts.PreviousEncryptionKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			previousKeys = append(previousKeys, previous)
+		}
+		if _, err := rotateEncryptionKey(opts.Path, key, previousKeys); err != nil {
+			return nil, fmt.Errorf("failed to rotate the encryption key: %w", err)
+		}
+		badgerOpts.EncryptionKey = key
+		badgerOpts.IndexCacheSize = encryptionIndexCacheSize
+		if opts.EncryptionKeyRotation > 0 {
+			badgerOpts.EncryptionKeyRotationDuration = opts.EncryptionKeyRotation
+		}
+	}
+	db, recovered, err := openBadger(badgerOpts, opts.RecoverCorrupt)
+	if err != nil {
+		return nil, err
+	}
+	a := NewBadgerDatabase(db)
+	a.recovered = recovered
+	return a, nil
+}
+
+// Close closes the underlying Badger database.
+func (a *BadgerDatabase) Close() error {
+	return a.db.Close()
+}
+
 // Tags implements the DatabaseReader interface, fetching the tags for the repo.
 //
 // If the repo does not exist, an empty set of tags is returned.
@@ -44,7 +97,7 @@ func (a *BadgerDatabase) Tags(repo string) ([]string, error) {
 	var tags []string
 	err := a.db.View(func(txn *badger.Txn) error {
 		var err error
-		tags, err = getOrEmpty(txn, repo)
+		tags, err = getOrEmpty(txn, &a.cache, repo)
 		return err
 	})
 	return tags, err
@@ -53,46 +106,159 @@ func (a *BadgerDatabase) Tags(repo string) ([]string, error) {
 // SetTags implements the DatabaseWriter interface, recording the tags against
 // the repo.
 //
-// It overwrites existing tag sets for the provided repo.
+// It overwrites existing tag sets for the provided repo, updating the history
+// of the tags.
 func (a *BadgerDatabase) SetTags(repo string, tags []string) error {
-	b, err := marshal(tags)
+	return a.db.Update(func(txn *badger.Txn) error {
+		stored, err := getValue(txn, keyForRepo(tagsPrefix, repo))
+		if err != nil {
+			return err
+		}
+		previous := []TagRecord{}
+		if stored != nil {
+			if previous, err = unmarshalHistory(stored); err != nil {
+				return err
+			}
+		}
+		b, err := marshal(updateHistory(previous, tags, now()))
+		if err != nil {
+			return err
+		}
+		// Unchanged tags aren't written again, for the value log not to grow
+		// on every scan.
+		if bytes.Equal(stored, b) {
+			return nil
+		}
+		e := badger.NewEntry(keyForRepo(tagsPrefix, repo), b)
+		return txn.SetEntry(e)
+	})
+}
+
+// SetHistory records the tag records against the repo as they are, e.g. when
+// importing them.
+func (a *BadgerDatabase) SetHistory(repo string, records []TagRecord) error {
+	b, err := marshal(records)
 	if err != nil {
 		return err
 	}
 	return a.db.Update(func(txn *badger.Txn) error {
-		e := badger.NewEntry(keyForRepo(tagsPrefix, repo), b)
-		return txn.SetEntry(e)
+		return txn.SetEntry(badger.NewEntry(keyForRepo(tagsPrefix, repo), b))
+	})
+}
+
+// History returns the history of the tags of the repo, the existing tags
+// first, in the order they were recorded, followed by the disappeared tags.
+func (a *BadgerDatabase) History(repo string) ([]TagRecord, error) {
+	var records []TagRecord
+	err := a.db.View(func(txn *badger.Txn) error {
+		var err error
+		records, err = getHistory(txn, repo)
+		return err
+	})
+	return records, err
+}
+
+// Digests returns the digests recorded for the existing tags of the repo.
+func (a *BadgerDatabase) Digests(repo string) (map[string]string, error) {
+	records, err := a.History(repo)
+	if err != nil {
+		return nil, err
+	}
+	return digestsOf(records), nil
+}
+
+// SetDigests records the given digests of the existing tags of the repo.
+func (a *BadgerDatabase) SetDigests(repo string, digests map[string]string) error {
+	return a.db.Update(func(txn *badger.Txn) error {
+		previous, err := getHistory(txn, repo)
+		if err != nil {
+			return err
+		}
+		records, changed := withDigests(previous, digests)
+		if !changed {
+			return nil
+		}
+		b, err := marshal(records)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(keyForRepo(tagsPrefix, repo), b))
+	})
+}
+
+// DeleteTags implements the DatabaseWriter interface, deleting the tags
+// recorded against the repo.
+//
+// Deleting the tags of a repo that does not exist is not an error.
+func (a *BadgerDatabase) DeleteTags(repo string) error {
+	defer a.cache.forget(repo)
+	return a.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(keyForRepo(tagsPrefix, repo))
 	})
 }
 
+// Repositories returns the repos for which tags are recorded.
+func (a *BadgerDatabase) Repositories() ([]string, error) {
+	prefix := keyForRepo(tagsPrefix, "")
+	var repos []string
+	err := a.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			repos = append(repos, string(it.Item().Key()[len(prefix):]))
+		}
+		return nil
+	})
+	return repos, err
+}
+
 func keyForRepo(prefix, repo string) []byte {
 	return []byte(fmt.Sprintf("%s:%s", prefix, repo))
 }
 
-func getOrEmpty(txn *badger.Txn, repo string) ([]string, error) {
+func getHistory(txn *badger.Txn, repo string) ([]TagRecord, error) {
 	item, err := txn.Get(keyForRepo(tagsPrefix, repo))
 	if err == badger.ErrKeyNotFound {
-		return []string{}, nil
+		return []TagRecord{}, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	var tags []string
+	var records []TagRecord
 	err = item.Value(func(val []byte) error {
-		tags, err = unmarshal(val)
+		records, err = unmarshalHistory(val)
 		return err
 	})
-	return tags, err
+	return records, err
 }
 
-func marshal(t []string) ([]byte, error) {
-	return json.Marshal(t)
+// getValue returns a copy of the value of the key, nil if it doesn't exist.
+func getValue(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
 }
 
-func unmarshal(b []byte) ([]string, error) {
-	var tags []string
-	if err := json.Unmarshal(b, &tags); err != nil {
+func getOrEmpty(txn *badger.Txn, cache *tagsCache, repo string) ([]string, error) {
+	item, err := txn.Get(keyForRepo(tagsPrefix, repo))
+	if err == badger.ErrKeyNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
 		return nil, err
 	}
-	return tags, nil
+	var tags []string
+	err = item.Value(func(val []byte) error {
+		tags, err = cache.decode(repo, val)
+		return err
+	})
+	return tags, err
 }
@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// encryptionIndexCacheSize is the size of the index cache of the Badger
+// database, required when encrypted.
+const encryptionIndexCacheSize = 64 << 20
+
+// readEncryptionKey reads the AES encryption key of the given file, e.g. a
+// mounted Secret. A trailing newline is ignored unless part of a valid key.
+func readEncryptionKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !validEncryptionKey(key) {
+		key = bytes.TrimRight(key, "\r\n")
+	}
+	if !validEncryptionKey(key) {
+		return nil, fmt.Errorf("invalid encryption key in '%s', must be 16, 24 or 32 bytes long", path)
+	}
+	return key, nil
+}
+
+func validEncryptionKey(key []byte) bool {
+	switch len(key) {
+	case 16, 24, 32:
+		return true
+	default:
+		return false
+	}
+}
+
+// rotateEncryptionKey re-encrypts the key registry of the Badger database in
+// the given directory with the given key, if it's encrypted with one of the
+// previous keys, or not encrypted. The data keys of the registry, encrypting
+// the data, are kept, so the data is not rewritten. It returns whether the
+// key registry was rotated.
+func rotateEncryptionKey(dir string, key []byte, previousKeys [][]byte) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, badger.KeyRegistryFileName)); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	opts := badger.KeyRegistryOptions{
+		Dir:           dir,
+		ReadOnly:      true,
+		EncryptionKey: key,
+	}
+	kr, err := badger.OpenKeyRegistry(opts)
+	if err == nil {
+		return false, kr.Close()
+	}
+	if !errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return false, err
+	}
+
+	// Try the previous keys, then no key for a database encrypted for the
+	// first time.
+	for _, previous := range append(previousKeys, nil) {
+		opts.EncryptionKey = previous
+		kr, err := badger.OpenKeyRegistry(opts)
+		if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		opts.EncryptionKey = key
+		err = badger.WriteKeyRegistry(kr, opts)
+		if closeErr := kr.Close(); err == nil {
+			err = closeErr
+		}
+		return err == nil, err
+	}
+	return false, errors.New("the database is encrypted with another key than the current and previous keys")
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, key string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	fatalIfError(t, os.WriteFile(path, []byte(key), 0o600))
+	return path
+}
+
+// reopen closes the database and opens it again with the given options,
+// returning an error if it can't be opened.
+func reopen(t *testing.T, db *BadgerDatabase, opts Options) (*BadgerDatabase, error) {
+	t.Helper()
+	if db != nil {
+		fatalIfError(t, db.Close())
+	}
+	db, err := OpenBadgerDatabase(opts)
+	if err == nil {
+		t.Cleanup(func() { db.Close() })
+	}
+	return db, err
+}
+
+func assertTags(t *testing.T, db *BadgerDatabase, want []string) {
+	t.Helper()
+	tags, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(want, tags) {
+		t.Fatalf("Tags() got %#v, want %#v", tags, want)
+	}
+}
+
+func TestBadgerEncryption(t *testing.T) {
+	dir := t.TempDir()
+	keyA := writeKeyFile(t, strings.Repeat("a", 32))
+	keyB := writeKeyFile(t, strings.Repeat("b", 32)+"\n")
+	tags := []string{"v0.0.1"}
+
+	// A database encrypted for the first time keeps its data.
+	db, err := reopen(t, nil, Options{Path: dir})
+	fatalIfError(t, err)
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	db, err = reopen(t, db, Options{Path: dir, EncryptionKeyFile: keyA})
+	fatalIfError(t, err)
+	assertTags(t, db, tags)
+	fatalIfError(t, db.SetTags("another/repo", tags))
+
+	// The database can't be opened with another key.
+	fatalIfError(t, db.Close())
+	if _, err := reopen(t, nil, Options{Path: dir, EncryptionKeyFile: keyB}); err == nil {
+		t.Fatal("OpenBadgerDatabase() returned no error for another key")
+	}
+	if _, err := reopen(t, nil, Options{Path: dir}); err == nil {
+		t.Fatal("OpenBadgerDatabase() returned no error without the key")
+	}
+
+	// Rotating the key keeps the data.
+	db, err = reopen(t, nil, Options{Path: dir, EncryptionKeyFile: keyB, PreviousEncryptionKeyFile: keyA})
+	fatalIfError(t, err)
+	assertTags(t, db, tags)
+	db, err = reopen(t, db, Options{Path: dir, EncryptionKeyFile: keyB})
+	fatalIfError(t, err)
+	assertTags(t, db, tags)
+}
+
+func TestReadEncryptionKey(t *testing.T) {
+	for _, tt := range []struct {
+		key     string
+		wantLen int
+	}{
+		{key: strings.Repeat("k", 16), wantLen: 16},
+		{key: strings.Repeat("k", 24) + "\n", wantLen: 24},
+		{key: strings.Repeat("k", 31) + "\n", wantLen: 32},
+		{key: "short"},
+	} {
+		key, err := readEncryptionKey(writeKeyFile(t, tt.key))
+		if tt.wantLen == 0 {
+			if err == nil {
+				t.Fatalf("readEncryptionKey() returned no error for %q", tt.key)
+			}
+			continue
+		}
+		fatalIfError(t, err)
+		if len(key) != tt.wantLen {
+			t.Fatalf("readEncryptionKey() got a %d bytes key for %q, want %d", len(key), tt.key, tt.wantLen)
+		}
+	}
+}
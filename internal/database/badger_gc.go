@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// GCResultRewritten is the result of a GC run that rewrote value log
+	// files.
+	GCResultRewritten = "rewritten"
+	// GCResultNoop is the result of a GC run that found no value log file to
+	// rewrite.
+	GCResultNoop = "noop"
+	// GCResultError is the result of a failed GC run.
+	GCResultError = "error"
+)
+
+// BadgerGarbageCollector periodically runs the value log garbage collection
+// of a Badger database. Every tag set rewrite leaves the previous value behind
+// in the value log, which grows without bound unless garbage collected.
+type BadgerGarbageCollector struct {
+	// Interval is the time between two GC runs.
+	Interval time.Duration
+	// DiscardRatio is the fraction of a value log file that must be
+	// discardable for the file to be rewritten.
+	DiscardRatio float64
+
+	db *badger.DB
+
+	lsmSize  prometheus.Gauge
+	vlogSize prometheus.Gauge
+	runs     *prometheus.CounterVec
+}
+
+// NewBadgerGarbageCollector creates and returns a garbage collector for the
+// given Badger database, validating the interval and the discard ratio.
+func NewBadgerGarbageCollector(db *BadgerDatabase, interval time.Duration, discardRatio float64) (*BadgerGarbageCollector, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid GC interval '%s', must be positive", interval)
+	}
+	if discardRatio <= 0 || discardRatio >= 1 {
+		return nil, fmt.Errorf("invalid GC discard ratio '%v', must be between 0 and 1", discardRatio)
+	}
+	return &BadgerGarbageCollector{
+		Interval:     interval,
+		DiscardRatio: discardRatio,
+		db:           db.db,
+		lsmSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gotk_database_lsm_size_bytes",
+			Help: "The size of the LSM tree files of the database in bytes.",
+		}),
+		vlogSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gotk_database_vlog_size_bytes",
+			Help: "The size of the value log files of the database in bytes.",
+		}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gotk_database_gc_runs_total",
+			Help: "The number of value log garbage collection runs of the database, by result.",
+		}, []string{"result"}),
+	}, nil
+}
+
+// Collectors returns the metrics collectors of the garbage collector, to be
+// registered with a Prometheus registry.
+func (gc *BadgerGarbageCollector) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{gc.lsmSize, gc.vlogSize, gc.runs}
+}
+
+// Start implements the manager.Runnable interface, running the garbage
+// collection every interval until the context is done, and a single pass on
+// the way out, so that the shutdown isn't held up rewriting the value log.
+func (gc *BadgerGarbageCollector) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("database-gc")
+	gc.recordSize()
+
+	ticker := time.NewTicker(gc.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := gc.Run(ctx); err != nil {
+				log.Error(err, "value log garbage collection failed")
+			}
+		case <-ctx.Done():
+			if _, err := gc.run(context.Background(), 1); err != nil {
+				log.Error(err, "value log garbage collection failed on shutdown")
+			}
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection implements the manager.LeaderElectionRunnable interface.
+// Every replica collects the garbage of its own database.
+func (gc *BadgerGarbageCollector) NeedLeaderElection() bool {
+	return false
+}
+
+// Run runs the value log garbage collection until no more value log file can
+// be rewritten, or the context is done. A pass rewriting a value log file
+// isn't interrupted. It returns the number of rewritten files.
+func (gc *BadgerGarbageCollector) Run(ctx context.Context) (int, error) {
+	return gc.run(ctx, 0)
+}
+
+// run runs at most the given number of value log garbage collection passes,
+// without limit if zero, each rewriting a value log file, until no more file
+// can be rewritten or the context is done.
+func (gc *BadgerGarbageCollector) run(ctx context.Context, maxPasses int) (int, error) {
+	defer gc.recordSize()
+
+	rewritten := 0
+	for {
+		if ctx.Err() != nil || (maxPasses > 0 && rewritten >= maxPasses) {
+			gc.recordResult(rewritten)
+			return rewritten, nil
+		}
+		err := gc.db.RunValueLogGC(gc.DiscardRatio)
+		switch {
+		case err == nil:
+			rewritten++
+		case errors.Is(err, badger.ErrNoRewrite):
+			gc.recordResult(rewritten)
+			return rewritten, nil
+		default:
+			gc.runs.WithLabelValues(GCResultError).Inc()
+			return rewritten, err
+		}
+	}
+}
+
+// recordResult records the result of a GC run that rewrote the given number
+// of value log files.
+func (gc *BadgerGarbageCollector) recordResult(rewritten int) {
+	if rewritten > 0 {
+		gc.runs.WithLabelValues(GCResultRewritten).Inc()
+	} else {
+		gc.runs.WithLabelValues(GCResultNoop).Inc()
+	}
+}
+
+// recordSize records the size of the LSM tree and value log files.
+func (gc *BadgerGarbageCollector) recordSize() {
+	lsm, vlog := gc.db.Size()
+	gc.lsmSize.Set(float64(lsm))
+	gc.vlogSize.Set(float64(vlog))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewBadgerGarbageCollector(t *testing.T) {
+	db := createBadgerDatabase(t)
+	for _, tt := range []struct {
+		interval     time.Duration
+		discardRatio float64
+		wantErr      bool
+	}{
+		{interval: time.Minute, discardRatio: 0.5},
+		{interval: 0, discardRatio: 0.5, wantErr: true},
+		{interval: time.Minute, discardRatio: 0, wantErr: true},
+		{interval: time.Minute, discardRatio: 1, wantErr: true},
+	} {
+		_, err := NewBadgerGarbageCollector(db, tt.interval, tt.discardRatio)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("NewBadgerGarbageCollector(%s, %v) error = %v, wantErr %v",
+				tt.interval, tt.discardRatio, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBadgerGarbageCollectorRun(t *testing.T) {
+	db := createBadgerDatabase(t)
+	for i := 0; i < 100; i++ {
+		fatalIfError(t, db.SetTags(testRepo, []string{"latest", "v0.0.1"}))
+	}
+	gc, err := NewBadgerGarbageCollector(db, time.Minute, 0.5)
+	fatalIfError(t, err)
+
+	// The active value log file is never rewritten.
+	n, err := gc.Run(context.Background())
+	fatalIfError(t, err)
+	if n != 0 {
+		t.Fatalf("Run() rewrote %d value log files, want 0", n)
+	}
+	if got := testutil.ToFloat64(gc.runs.WithLabelValues(GCResultNoop)); got != 1 {
+		t.Fatalf("Run() recorded %v noop runs, want 1", got)
+	}
+
+	// A done context stops the garbage collection before the next pass.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err = gc.Run(ctx)
+	fatalIfError(t, err)
+	if n != 0 {
+		t.Fatalf("Run() rewrote %d value log files after the context was done, want 0", n)
+	}
+}
+
+func TestBadgerGarbageCollectorStart(t *testing.T) {
+	db := createBadgerDatabase(t)
+	gc, err := NewBadgerGarbageCollector(db, time.Hour, 0.5)
+	fatalIfError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- gc.Start(ctx)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		fatalIfError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start() did not return after the context was done")
+	}
+	// A single pass of garbage collection runs on shutdown.
+	if got := testutil.CollectAndCount(gc.runs); got != 1 {
+		t.Fatalf("Start() recorded %d GC results on shutdown, want 1", got)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	// corruptDirName is the directory, within the storage path, where a
+	// corrupt Badger database is moved to. The storage path is usually the
+	// mount point of a volume, which can't be renamed.
+	corruptDirName = "corrupt"
+
+	// readinessRepo is the repo read by the readiness check, for which no
+	// tags are ever recorded.
+	readinessRepo = "readiness-check"
+)
+
+// openBadger opens the Badger database with the given options. Badger
+// truncates the corrupt tail of its write-ahead and value logs on open by
+// itself, any other corruption fails the open.
+//
+// When recover is true, the table checksums are verified on open for the
+// corrupt tables to fail the open rather than the reads, and a database that
+// can't be opened is moved aside, for an empty database to be opened in its
+// place. The ImageRepositories are scanned again. It returns the directory
+// the corrupt database was moved to, empty if not recovered.
+func openBadger(opts badger.Options, recover bool) (*badger.DB, string, error) {
+	if !recover {
+		db, err := badger.Open(opts)
+		return db, "", err
+	}
+
+	opts.ChecksumVerificationMode = options.OnTableRead
+	db, err := badger.Open(opts)
+	if err == nil || !recoverable(err) {
+		return db, "", err
+	}
+	moved, moveErr := moveAside(opts.Dir)
+	if moveErr != nil {
+		return nil, "", fmt.Errorf("failed to move the corrupt database aside: %w, after failing to open it: %v", moveErr, err)
+	}
+	db, err = badger.Open(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return db, moved, nil
+}
+
+// recoverable returns whether the error opening a Badger database may be
+// recovered from by moving the database aside, as opposed to the errors of
+// the configuration or environment, with which an empty database would not
+// open either, or would lose a sound database.
+func recoverable(err error) bool {
+	switch {
+	case errors.Is(err, badger.ErrEncryptionKeyMismatch),
+		errors.Is(err, badger.ErrInvalidEncryptionKey),
+		errors.Is(err, fs.ErrPermission),
+		// The database is used by another process, e.g. a replica sharing
+		// the volume.
+		strings.Contains(err.Error(), "Another process is using this Badger database"):
+		return false
+	}
+	return true
+}
+
+// moveAside moves the files of the database of the given directory to its
+// corruptDirName directory, replacing the database moved aside before, and
+// returns the latter.
+func moveAside(dir string) (string, error) {
+	corrupt := filepath.Join(dir, corruptDirName)
+	if err := os.RemoveAll(corrupt); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(corrupt, 0o700); err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if err := os.Rename(filepath.Join(dir, e.Name()), filepath.Join(corrupt, e.Name())); err != nil {
+			return "", err
+		}
+	}
+	return corrupt, nil
+}
+
+// Recovered returns the directory the corrupt database was moved to when
+// opened, empty if the database was not recovered.
+func (a *BadgerDatabase) Recovered() string {
+	return a.recovered
+}
+
+// Collectors returns the metrics collectors of the database, to be
+// registered with a Prometheus registry.
+func (a *BadgerDatabase) Collectors() []prometheus.Collector {
+	recovered := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gotk_database_recovered",
+		Help: "Whether the database was corrupt and replaced with an empty database on startup, 1 if so.",
+	})
+	if a.recovered != "" {
+		recovered.Set(1)
+	}
+	return []prometheus.Collector{recovered}
+}
+
+// ReadyzCheck returns a readiness check failing while the database can't be
+// read, e.g. once closed, or when its storage fails.
+func ReadyzCheck(db Database) healthz.Checker {
+	return func(_ *http.Request) error {
+		if _, err := db.Tags(readinessRepo); err != nil {
+			return fmt.Errorf("database is not usable: %w", err)
+		}
+		return nil
+	}
+}
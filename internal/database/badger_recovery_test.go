@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBadgerRecovery(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenBadgerDatabase(Options{Path: dir})
+	fatalIfError(t, err)
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.1"}))
+	fatalIfError(t, db.Close())
+
+	// Corrupt the manifest, for the database to fail to open.
+	fatalIfError(t, os.WriteFile(filepath.Join(dir, "MANIFEST"), []byte("corrupt"), 0o600))
+
+	if _, err := OpenBadgerDatabase(Options{Path: dir}); err == nil {
+		t.Fatal("OpenBadgerDatabase() opened a corrupt database without recovering it")
+	}
+
+	db, err = OpenBadgerDatabase(Options{Path: dir, RecoverCorrupt: true})
+	fatalIfError(t, err)
+	if want := filepath.Join(dir, corruptDirName); db.Recovered() != want {
+		t.Fatalf("Recovered() got %q, want %q", db.Recovered(), want)
+	}
+	if _, err := os.Stat(filepath.Join(db.Recovered(), "MANIFEST")); err != nil {
+		t.Fatalf("corrupt database not moved aside: %v", err)
+	}
+	if got := testutil.ToFloat64(db.Collectors()[0]); got != 1 {
+		t.Fatalf("recovered metric got %v, want 1", got)
+	}
+
+	tags, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, []string{}) {
+		t.Fatalf("Tags() got %#v after recovery, want %#v", tags, []string{})
+	}
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2"}))
+	fatalIfError(t, db.Close())
+
+	// The recovered database opens next to the corrupt one moved aside.
+	db, err = OpenBadgerDatabase(Options{Path: dir, RecoverCorrupt: true})
+	fatalIfError(t, err)
+	defer db.Close()
+	if db.Recovered() != "" {
+		t.Fatalf("Recovered() got %q for the recovered database", db.Recovered())
+	}
+	tags, err = db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, []string{"v0.0.2"}) {
+		t.Fatalf("Tags() got %#v, want %#v", tags, []string{"v0.0.2"})
+	}
+}
+
+func TestBadgerRecoveryKeepsSoundDatabase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenBadgerDatabase(Options{Path: dir, RecoverCorrupt: true})
+	fatalIfError(t, err)
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.1"}))
+	fatalIfError(t, db.Close())
+
+	db, err = OpenBadgerDatabase(Options{Path: dir, RecoverCorrupt: true})
+	fatalIfError(t, err)
+	defer db.Close()
+	if db.Recovered() != "" {
+		t.Fatalf("Recovered() got %q for a sound database", db.Recovered())
+	}
+	if got := testutil.ToFloat64(db.Collectors()[0]); got != 0 {
+		t.Fatalf("recovered metric got %v, want 0", got)
+	}
+	tags, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, []string{"v0.0.1"}) {
+		t.Fatalf("Tags() got %#v, want %#v", tags, []string{"v0.0.1"})
+	}
+}
+
+func TestRecoverable(t *testing.T) {
+	for _, err := range []error{
+		badger.ErrEncryptionKeyMismatch,
+		os.ErrPermission,
+		errors.New(`Cannot acquire directory lock on "/data".  Another process is using this Badger database.`),
+	} {
+		if recoverable(err) {
+			t.Errorf("recoverable(%q) got true, want false", err)
+		}
+	}
+	if !recoverable(errors.New("manifest has bad magic")) {
+		t.Errorf("recoverable() got false for a corrupt manifest, want true")
+	}
+}
+
+func TestReadyzCheck(t *testing.T) {
+	db, err := OpenBadgerDatabase(Options{Path: t.TempDir()})
+	fatalIfError(t, err)
+	check := ReadyzCheck(db)
+
+	fatalIfError(t, check(nil))
+	repos, err := db.Repositories()
+	fatalIfError(t, err)
+	if len(repos) != 0 {
+		t.Fatalf("readiness check recorded repos %v", repos)
+	}
+
+	fatalIfError(t, db.Close())
+	if err := check(nil); err == nil {
+		t.Fatal("readiness check passed with a closed database")
+	}
+}
@@ -64,6 +64,50 @@ func TestSetTagsOverwrites(t *testing.T) {
 	}
 }
 
+func TestSetTagsUnchanged(t *testing.T) {
+	db := createBadgerDatabase(t)
+	tags := []string{"latest", "v0.0.1"}
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	before := badgerVersion(t, db, testRepo)
+
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	if after := badgerVersion(t, db, testRepo); after != before {
+		t.Fatalf("SetTags() rewrote unchanged tags, version %d, want %d", after, before)
+	}
+	fatalIfError(t, db.SetTags(testRepo, []string{"latest"}))
+	if after := badgerVersion(t, db, testRepo); after == before {
+		t.Fatal("SetTags() didn't write changed tags")
+	}
+}
+
+func badgerVersion(t *testing.T, db *BadgerDatabase, repo string) uint64 {
+	t.Helper()
+	var version uint64
+	fatalIfError(t, db.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyForRepo(tagsPrefix, repo))
+		if err != nil {
+			return err
+		}
+		version = item.Version()
+		return nil
+	}))
+	return version
+}
+
+func TestRepositoryKey(t *testing.T) {
+	if got := RepositoryKey("ns", "repo", "ghcr.io/foo/bar", true); got != "ghcr.io/foo/bar" {
+		t.Fatalf("RepositoryKey() got %q for shared key", got)
+	}
+	a := RepositoryKey("ns-a", "repo", "ghcr.io/foo/bar", false)
+	b := RepositoryKey("ns-b", "repo", "ghcr.io/foo/bar", false)
+	if a == b {
+		t.Fatalf("RepositoryKey() got the same scoped key %q in different namespaces", a)
+	}
+	if !isScopedKey(a) || isScopedKey("ghcr.io/foo/bar") {
+		t.Fatalf("isScopedKey() failed to tell scoped from shared keys")
+	}
+}
+
 func TestGetOnlyFetchesForRepo(t *testing.T) {
 	db := createBadgerDatabase(t)
 	tags1 := []string{"latest", "v0.0.1", "v0.0.2"}
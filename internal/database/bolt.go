@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltFileName is the name of the bbolt database file in the storage path.
+const boltFileName = "tags.db"
+
+// tagsBucket is the bbolt bucket of the tag sets, keyed by repo.
+var tagsBucket = []byte(tagsPrefix)
+
+// BoltDatabase provides an implementation of the tags database based on
+// bbolt. Unlike Badger, bbolt keeps the whole database in a single file
+// without a memory mapped value log, which suits memory limited nodes.
+type BoltDatabase struct {
+	db    *bolt.DB
+	cache tagsCache
+}
+
+// OpenBoltDatabase opens the bbolt database file in the storage path of the
+// given options, creating it if needed, and returns a database implementation
+// owning it.
+func OpenBoltDatabase(opts Options) (*BoltDatabase, error) {
+	if err := os.MkdirAll(opts.Path, 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(opts.Path, boltFileName), 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(tagsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltDatabase{db: db}, nil
+}
+
+// Tags implements the DatabaseReader interface, fetching the tags for the repo.
+//
+// If the repo does not exist, an empty set of tags is returned.
+func (b *BoltDatabase) Tags(repo string) ([]string, error) {
+	tags := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(tagsBucket).Get([]byte(repo))
+		if v == nil {
+			return nil
+		}
+		var err error
+		tags, err = b.cache.decode(repo, v)
+		return err
+	})
+	return tags, err
+}
+
+// SetTags implements the DatabaseWriter interface, recording the tags against
+// the repo.
+//
+// It overwrites existing tag sets for the provided repo, updating the history
+// of the tags.
+func (b *BoltDatabase) SetTags(repo string, tags []string) error {
+	at := now()
+	updated := func(tx *bolt.Tx) ([]byte, bool, error) {
+		previous, err := boltHistory(tx, repo)
+		if err != nil {
+			return nil, false, err
+		}
+		v, err := marshal(updateHistory(previous, tags, at))
+		if err != nil {
+			return nil, false, err
+		}
+		return v, !bytes.Equal(tx.Bucket(tagsBucket).Get([]byte(repo)), v), nil
+	}
+
+	// Unchanged tags aren't written again, not even by an empty read-write
+	// transaction, for the database file not to grow on every scan.
+	var changed bool
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		_, changed, err = updated(tx)
+		return err
+	}); err != nil || !changed {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		v, changed, err := updated(tx)
+		if err != nil || !changed {
+			return err
+		}
+		return tx.Bucket(tagsBucket).Put([]byte(repo), v)
+	})
+}
+
+// SetHistory records the tag records against the repo as they are, e.g. when
+// importing them.
+func (b *BoltDatabase) SetHistory(repo string, records []TagRecord) error {
+	v, err := marshal(records)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tagsBucket).Put([]byte(repo), v)
+	})
+}
+
+// History returns the history of the tags of the repo, the existing tags
+// first, in the order they were recorded, followed by the disappeared tags.
+func (b *BoltDatabase) History(repo string) ([]TagRecord, error) {
+	var records []TagRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		records, err = boltHistory(tx, repo)
+		return err
+	})
+	return records, err
+}
+
+// Digests returns the digests recorded for the existing tags of the repo.
+func (b *BoltDatabase) Digests(repo string) (map[string]string, error) {
+	records, err := b.History(repo)
+	if err != nil {
+		return nil, err
+	}
+	return digestsOf(records), nil
+}
+
+// SetDigests records the given digests of the existing tags of the repo.
+func (b *BoltDatabase) SetDigests(repo string, digests map[string]string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		previous, err := boltHistory(tx, repo)
+		if err != nil {
+			return err
+		}
+		records, changed := withDigests(previous, digests)
+		if !changed {
+			return nil
+		}
+		v, err := marshal(records)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(tagsBucket).Put([]byte(repo), v)
+	})
+}
+
+// DeleteTags implements the DatabaseWriter interface, deleting the tags
+// recorded against the repo.
+func (b *BoltDatabase) DeleteTags(repo string) error {
+	defer b.cache.forget(repo)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tagsBucket).Delete([]byte(repo))
+	})
+}
+
+// Repositories returns the repos for which tags are recorded.
+func (b *BoltDatabase) Repositories() ([]string, error) {
+	var repos []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tagsBucket).ForEach(func(k, _ []byte) error {
+			repos = append(repos, string(k))
+			return nil
+		})
+	})
+	return repos, err
+}
+
+func boltHistory(tx *bolt.Tx, repo string) ([]TagRecord, error) {
+	v := tx.Bucket(tagsBucket).Get([]byte(repo))
+	if v == nil {
+		return []TagRecord{}, nil
+	}
+	return unmarshalHistory(v)
+}
+
+// Close closes the underlying bbolt database.
+func (b *BoltDatabase) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"testing"
+)
+
+func TestBoltSetTagsUnchanged(t *testing.T) {
+	db, err := OpenBoltDatabase(Options{Path: t.TempDir()})
+	fatalIfError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	tags := []string{"latest", "v0.0.1"}
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	before := db.db.Stats().TxStats.Write
+
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	if after := db.db.Stats().TxStats.Write; after != before {
+		t.Fatalf("SetTags() rewrote unchanged tags with %d page writes", after-before)
+	}
+	fatalIfError(t, db.SetTags(testRepo, []string{"latest"}))
+	if after := db.db.Stats().TxStats.Write; after == before {
+		t.Fatal("SetTags() didn't write changed tags")
+	}
+}
@@ -0,0 +1,513 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// configMapNamePrefix is the prefix of the names of the ConfigMaps
+	// holding the tag sets.
+	configMapNamePrefix = "image-reflector-tags-"
+	// configMapDataKey is the key of the encoded tags chunk in the binary
+	// data of a ConfigMap.
+	configMapDataKey = "tags"
+	// configMapChunkSize is the maximum size of the compressed tags chunk of
+	// a ConfigMap, well below the 1MiB limit of the objects.
+	configMapChunkSize = 512 * 1024
+	// configMapReadAttempts is the number of attempts at reading the chunks
+	// of a tag set while it's being replaced.
+	configMapReadAttempts = 3
+	// configMapReadRetryDelay is the delay between the attempts at reading
+	// the chunks of a tag set.
+	configMapReadRetryDelay = 100 * time.Millisecond
+
+	// repoHashLabel labels the ConfigMaps with the hash of their repo.
+	repoHashLabel = "image.toolkit.fluxcd.io/tags"
+	// repoAnnotation records the repo of a manifest ConfigMap.
+	repoAnnotation = "image.toolkit.fluxcd.io/repository"
+	// chunkAnnotation records the index of the chunk of a ConfigMap.
+	chunkAnnotation = "image.toolkit.fluxcd.io/chunk"
+	// chunksAnnotation records the number of chunks of a tag set.
+	chunksAnnotation = "image.toolkit.fluxcd.io/chunks"
+	// revisionAnnotation records the digest of the encoded tag set.
+	revisionAnnotation = "image.toolkit.fluxcd.io/revision"
+)
+
+// errTornTags is returned when the chunks of a tag set don't match its
+// manifest, e.g. while the tag set is being replaced.
+var errTornTags = errors.New("the chunks of the tag set don't match its manifest")
+
+// ConfigMapDatabase provides an implementation of the tags database storing
+// the tag sets in ConfigMaps, so that the controller runs without a
+// persistent volume and keeps the tags across restarts. Each tag set is
+// compressed and split in chunks of at most 512KiB.
+//
+// The first chunk is stored in the manifest ConfigMap of the tag set, which
+// records its revision and number of chunks, and the other chunks in
+// ConfigMaps named after the revision. The manifest is written last, so that
+// an interrupted write leaves the previous tag set in place, and the chunks
+// of the previous revision are deleted once it's replaced. A read that
+// doesn't find the chunks of the manifest, as the tag set was replaced in the
+// meantime, is retried.
+//
+// The ConfigMaps are read from the given reader, e.g. an informer cache,
+// except for the read-modify-write cycles, which read from the client and
+// are retried on conflicts, and the tag sets written by the database that
+// the reader hasn't observed yet.
+type ConfigMapDatabase struct {
+	client    client.Client
+	reader    client.Reader
+	cached    bool
+	namespace string
+	chunkSize int
+	cache     tagsCache
+
+	mu sync.Mutex
+	// written holds the revisions of the tag sets written by the database
+	// that the reader may not have observed yet, empty for the deleted tag
+	// sets.
+	written map[string]string
+}
+
+// NewConfigMapDatabase creates and returns a database implementation storing
+// the tag sets in ConfigMaps in the given namespace. The ConfigMaps are read
+// with the given reader, e.g. an informer cache, or the client if nil.
+func NewConfigMapDatabase(c client.Client, reader client.Reader, namespace string) (*ConfigMapDatabase, error) {
+	if c == nil {
+		return nil, errors.New("a Kubernetes client is required to store the tags in ConfigMaps")
+	}
+	if namespace == "" {
+		return nil, errors.New("a namespace is required to store the tags in ConfigMaps")
+	}
+	cached := reader != nil
+	if !cached {
+		reader = c
+	}
+	return &ConfigMapDatabase{
+		client:    c,
+		reader:    reader,
+		cached:    cached,
+		namespace: namespace,
+		chunkSize: configMapChunkSize,
+		written:   map[string]string{},
+	}, nil
+}
+
+// StartConfigMapCache starts an informer cache of the ConfigMaps of the
+// ConfigMap backend in the given namespace, to read the tag sets from, and
+// waits for it to be synced. The cache is stopped when the context is done.
+func StartConfigMapCache(ctx context.Context, config *rest.Config, namespace string) (client.Reader, error) {
+	hasRepo, err := labels.NewRequirement(repoHashLabel, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cache.New(config, cache.Options{
+		Namespaces: []string{namespace},
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Label: labels.NewSelector().Add(*hasRepo)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Start the informer of the ConfigMaps before waiting for the sync.
+	if _, err := c.GetInformer(ctx, &corev1.ConfigMap{}); err != nil {
+		return nil, err
+	}
+	go c.Start(ctx)
+	if !c.WaitForCacheSync(ctx) {
+		return nil, errors.New("failed to sync the ConfigMaps cache")
+	}
+	return c, nil
+}
+
+// Tags implements the DatabaseReader interface, fetching the tags for the repo.
+//
+// If the repo does not exist, an empty set of tags is returned.
+func (d *ConfigMapDatabase) Tags(repo string) ([]string, error) {
+	ctx := context.Background()
+	reader, err := d.readerFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := d.read(ctx, reader, repo)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return []string{}, nil
+	}
+	return d.cache.decode(repo, payload)
+}
+
+// SetTags implements the DatabaseWriter interface, recording the tags against
+// the repo.
+//
+// It overwrites existing tag sets for the provided repo, updating the history
+// of the tags. The ConfigMaps are left untouched if the tag records did not
+// change. A tag set of which the chunks are missing is replaced.
+func (d *ConfigMapDatabase) SetTags(repo string, tags []string) error {
+	ctx := context.Background()
+	at := now()
+	return d.update(func() error {
+		manifest, payload, err := d.read(ctx, d.client, repo)
+		if err != nil && !errors.Is(err, errTornTags) {
+			return err
+		}
+		previous := []TagRecord{}
+		if payload != nil {
+			if previous, err = unmarshalHistory(payload); err != nil {
+				return err
+			}
+		}
+		return d.writeRecords(ctx, repo, manifest, updateHistory(previous, tags, at))
+	})
+}
+
+// SetHistory records the tag records against the repo as they are, e.g. when
+// importing them.
+func (d *ConfigMapDatabase) SetHistory(repo string, records []TagRecord) error {
+	ctx := context.Background()
+	return d.update(func() error {
+		manifest, err := d.manifest(ctx, d.client, repo)
+		if err != nil {
+			return err
+		}
+		return d.writeRecords(ctx, repo, manifest, records)
+	})
+}
+
+// History returns the history of the tags of the repo, the existing tags
+// first, in the order they were recorded, followed by the disappeared tags.
+func (d *ConfigMapDatabase) History(repo string) ([]TagRecord, error) {
+	ctx := context.Background()
+	reader, err := d.readerFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := d.read(ctx, reader, repo)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return []TagRecord{}, nil
+	}
+	return unmarshalHistory(payload)
+}
+
+// Digests returns the digests recorded for the existing tags of the repo.
+func (d *ConfigMapDatabase) Digests(repo string) (map[string]string, error) {
+	records, err := d.History(repo)
+	if err != nil {
+		return nil, err
+	}
+	return digestsOf(records), nil
+}
+
+// SetDigests records the given digests of the existing tags of the repo.
+func (d *ConfigMapDatabase) SetDigests(repo string, digests map[string]string) error {
+	ctx := context.Background()
+	return d.update(func() error {
+		manifest, payload, err := d.read(ctx, d.client, repo)
+		if err != nil || payload == nil {
+			return err
+		}
+		previous, err := unmarshalHistory(payload)
+		if err != nil {
+			return err
+		}
+		records, changed := withDigests(previous, digests)
+		if !changed {
+			return nil
+		}
+		return d.writeRecords(ctx, repo, manifest, records)
+	})
+}
+
+// DeleteTags implements the DatabaseWriter interface, deleting the tags
+// recorded against the repo. The manifest is deleted first, so that the tag
+// set isn't read from the remaining chunks.
+func (d *ConfigMapDatabase) DeleteTags(repo string) error {
+	defer d.cache.forget(repo)
+	ctx := context.Background()
+	manifest := &corev1.ConfigMap{}
+	manifest.Namespace = d.namespace
+	manifest.Name = manifestName(repo)
+	if err := client.IgnoreNotFound(d.client.Delete(ctx, manifest)); err != nil {
+		return err
+	}
+	d.recordWrite(repo, "")
+	return d.deleteChunks(ctx, repo, "")
+}
+
+// Repositories returns the repos for which tags are recorded.
+func (d *ConfigMapDatabase) Repositories() ([]string, error) {
+	var list corev1.ConfigMapList
+	if err := d.reader.List(context.Background(), &list, client.InNamespace(d.namespace),
+		client.HasLabels{repoHashLabel}); err != nil {
+		return nil, err
+	}
+	var repos []string
+	for _, cm := range list.Items {
+		if repo := cm.Annotations[repoAnnotation]; repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// Close implements the Database interface. There is nothing to release.
+func (d *ConfigMapDatabase) Close() error {
+	return nil
+}
+
+// update runs the read-modify-write cycle of a tag set, again if the manifest
+// was written concurrently since it was read.
+func (d *ConfigMapDatabase) update(fn func() error) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, fn)
+}
+
+// recordWrite records the revision of the tag set of the repo written by the
+// database, empty if deleted, for it to be read from the client until the
+// reader observes it.
+func (d *ConfigMapDatabase) recordWrite(repo, revision string) {
+	if !d.cached {
+		return
+	}
+	d.mu.Lock()
+	d.written[repo] = revision
+	d.mu.Unlock()
+}
+
+// readerFor returns the reader to read the tag set of the repo from: the
+// reader, unless it hasn't observed the last tag set written by the database
+// yet, e.g. the informer cache lagging behind, then the client.
+func (d *ConfigMapDatabase) readerFor(ctx context.Context, repo string) (client.Reader, error) {
+	d.mu.Lock()
+	revision, pending := d.written[repo]
+	d.mu.Unlock()
+	if !pending {
+		return d.reader, nil
+	}
+	manifest, err := d.manifest(ctx, d.reader, repo)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil && revision != "" ||
+		manifest != nil && manifest.Annotations[revisionAnnotation] != revision {
+		return d.client, nil
+	}
+	d.mu.Lock()
+	if d.written[repo] == revision {
+		delete(d.written, repo)
+	}
+	d.mu.Unlock()
+	return d.reader, nil
+}
+
+// read returns the manifest and the encoded tag set of the repo read from the
+// given reader, nil if the repo has no tag set. The read is retried while the
+// chunks don't match the manifest, and it returns errTornTags with the
+// manifest if they never do.
+func (d *ConfigMapDatabase) read(ctx context.Context, reader client.Reader, repo string) (*corev1.ConfigMap, []byte, error) {
+	for attempt := 1; ; attempt++ {
+		manifest, err := d.manifest(ctx, reader, repo)
+		if err != nil || manifest == nil {
+			return nil, nil, err
+		}
+		payload, err := d.assembleChunks(ctx, reader, manifest)
+		if !errors.Is(err, errTornTags) {
+			return manifest, payload, err
+		}
+		if attempt == configMapReadAttempts {
+			return manifest, nil, fmt.Errorf("failed to read the tags of '%s': %w", repo, err)
+		}
+		time.Sleep(configMapReadRetryDelay)
+	}
+}
+
+// manifest returns the manifest ConfigMap of the tag set of the repo read from
+// the given reader, nil if not found.
+func (d *ConfigMapDatabase) manifest(ctx context.Context, reader client.Reader, repo string) (*corev1.ConfigMap, error) {
+	manifest := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: d.namespace, Name: manifestName(repo)}
+	if err := reader.Get(ctx, key, manifest); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// assembleChunks concatenates the data of the manifest and the other chunks
+// of its revision, read from the given reader. It returns errTornTags if a
+// chunk is missing or the data doesn't match the revision.
+func (d *ConfigMapDatabase) assembleChunks(ctx context.Context, reader client.Reader, manifest *corev1.ConfigMap) ([]byte, error) {
+	revision := manifest.Annotations[revisionAnnotation]
+	repo := manifest.Annotations[repoAnnotation]
+	count, err := strconv.Atoi(manifest.Annotations[chunksAnnotation])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid chunks count of the tags of '%s'", repo)
+	}
+	payload := append([]byte{}, manifest.BinaryData[configMapDataKey]...)
+	for i := 1; i < count; i++ {
+		chunk := &corev1.ConfigMap{}
+		key := client.ObjectKey{Namespace: d.namespace, Name: chunkName(repo, revision, i)}
+		if err := reader.Get(ctx, key, chunk); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, errTornTags
+			}
+			return nil, err
+		}
+		payload = append(payload, chunk.BinaryData[configMapDataKey]...)
+	}
+	if digest(payload) != revision {
+		return nil, errTornTags
+	}
+	return payload, nil
+}
+
+// writeRecords writes the tag records in the chunks of the repo, given its
+// current manifest, if any. The chunks other than the first are written
+// first, then the manifest, and the chunks of the previous revision are
+// deleted.
+func (d *ConfigMapDatabase) writeRecords(ctx context.Context, repo string, manifest *corev1.ConfigMap, records []TagRecord) error {
+	payload, err := marshal(records)
+	if err != nil {
+		return err
+	}
+	revision := digest(payload)
+	if manifest != nil && manifest.Annotations[revisionAnnotation] == revision {
+		return nil
+	}
+
+	count := (len(payload) + d.chunkSize - 1) / d.chunkSize
+	if count == 0 {
+		count = 1
+	}
+	chunk := func(i int) []byte {
+		end := (i + 1) * d.chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		return payload[i*d.chunkSize : end]
+	}
+	for i := 1; i < count; i++ {
+		cm := &corev1.ConfigMap{}
+		cm.Namespace = d.namespace
+		cm.Name = chunkName(repo, revision, i)
+		cm.Labels = map[string]string{repoHashLabel: repoHash(repo)}
+		cm.Annotations = map[string]string{
+			chunkAnnotation:    strconv.Itoa(i),
+			revisionAnnotation: revision,
+		}
+		cm.BinaryData = map[string][]byte{configMapDataKey: chunk(i)}
+		// The chunks are named after the revision of their content, so an
+		// existing chunk is already up to date.
+		if err := d.client.Create(ctx, cm); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	create := manifest == nil
+	if create {
+		manifest = &corev1.ConfigMap{}
+		manifest.Namespace = d.namespace
+		manifest.Name = manifestName(repo)
+	}
+	manifest.Labels = map[string]string{repoHashLabel: repoHash(repo)}
+	manifest.Annotations = map[string]string{
+		repoAnnotation:     repo,
+		chunkAnnotation:    "0",
+		chunksAnnotation:   strconv.Itoa(count),
+		revisionAnnotation: revision,
+	}
+	manifest.Data = nil
+	manifest.BinaryData = map[string][]byte{configMapDataKey: chunk(0)}
+	if create {
+		err = d.client.Create(ctx, manifest)
+	} else {
+		err = d.client.Update(ctx, manifest)
+	}
+	if err != nil {
+		return err
+	}
+	d.recordWrite(repo, revision)
+	return d.deleteChunks(ctx, repo, revision)
+}
+
+// deleteChunks deletes the chunks of the repo other than the manifest and the
+// chunks of the given revision, listing them from the client for the chunks
+// not observed by the reader yet not to be left behind.
+func (d *ConfigMapDatabase) deleteChunks(ctx context.Context, repo, revision string) error {
+	var list corev1.ConfigMapList
+	if err := d.client.List(ctx, &list, client.InNamespace(d.namespace),
+		client.MatchingLabels{repoHashLabel: repoHash(repo)}); err != nil {
+		return err
+	}
+	for _, cm := range list.Items {
+		if cm.Name == manifestName(repo) || cm.Annotations[revisionAnnotation] == revision {
+			continue
+		}
+		if err := client.IgnoreNotFound(d.client.Delete(ctx, &cm)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifestName returns the name of the manifest ConfigMap of the repo.
+func manifestName(repo string) string {
+	return configMapNamePrefix + repoHash(repo)
+}
+
+// chunkName returns the name of the ConfigMap of the chunk of the given index
+// and revision of the repo.
+func chunkName(repo, revision string, index int) string {
+	return fmt.Sprintf("%s%s-%s-%d", configMapNamePrefix, repoHash(repo), revision[:12], index)
+}
+
+// repoHash returns a hash of the repo that is valid in ConfigMap names and
+// label values.
+func repoHash(repo string) string {
+	return digest([]byte(repo))[:16]
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const testNamespace = "flux-system"
+
+func TestConfigMapDatabaseChunks(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	db, err := NewConfigMapDatabase(c, nil, testNamespace)
+	fatalIfError(t, err)
+	db.chunkSize = 64
+
+	var tags []string
+	for i := 0; i < 100; i++ {
+		tags = append(tags, fmt.Sprintf("v0.0.%d-%x", i, i*7919))
+	}
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	if n := countConfigMaps(t, c); n < 2 {
+		t.Fatalf("SetTags() created %d ConfigMaps, want the tags split in chunks", n)
+	}
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, loaded) {
+		t.Fatalf("Tags() got %#v, want %#v", loaded, tags)
+	}
+
+	// Fewer chunks delete the chunks left over.
+	db.chunkSize = configMapChunkSize
+	fatalIfError(t, db.SetTags(testRepo, []string{"latest"}))
+	if n := countConfigMaps(t, c); n != 1 {
+		t.Fatalf("SetTags() left %d ConfigMaps, want 1", n)
+	}
+	loaded, err = db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual([]string{"latest"}, loaded) {
+		t.Fatalf("Tags() got %#v, want %#v", loaded, []string{"latest"})
+	}
+}
+
+func TestConfigMapDatabaseUnchangedTags(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	db, err := NewConfigMapDatabase(c, nil, testNamespace)
+	fatalIfError(t, err)
+
+	tags := []string{"latest", "v0.0.1"}
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	before := configMapVersions(t, c)
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	if after := configMapVersions(t, c); !reflect.DeepEqual(before, after) {
+		t.Fatalf("SetTags() updated the ConfigMaps of unchanged tags")
+	}
+}
+
+func TestConfigMapDatabaseInterruptedWrite(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	db, err := NewConfigMapDatabase(c, nil, testNamespace)
+	fatalIfError(t, err)
+	db.chunkSize = 16
+
+	tags := []string{"v0.0.1", "v0.0.2", "v0.0.3"}
+	fatalIfError(t, db.SetTags(testRepo, tags))
+	// Simulate a write interrupted before the manifest, leaving a chunk of
+	// another revision behind.
+	cm := &corev1.ConfigMap{}
+	cm.Namespace = testNamespace
+	cm.Name = chunkName(testRepo, digest([]byte("interrupted")), 1)
+	cm.Labels = map[string]string{repoHashLabel: repoHash(testRepo)}
+	cm.Annotations = map[string]string{revisionAnnotation: digest([]byte("interrupted"))}
+	fatalIfError(t, c.Create(context.Background(), cm))
+
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, loaded) {
+		t.Fatalf("Tags() got %#v after an interrupted write, want %#v", loaded, tags)
+	}
+
+	// The next write deletes the chunks left behind.
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.4"}))
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(cm), cm); !apierrors.IsNotFound(err) {
+		t.Fatalf("SetTags() kept the chunk of an interrupted write: %v", err)
+	}
+}
+
+func TestConfigMapDatabaseTornTags(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	db, err := NewConfigMapDatabase(c, nil, testNamespace)
+	fatalIfError(t, err)
+	db.chunkSize = 16
+
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.1", "v0.0.2", "v0.0.3"}))
+	// Drop a chunk of the manifest, as when replaced between the reads of
+	// the manifest and its chunks.
+	manifest, err := db.manifest(context.Background(), c, testRepo)
+	fatalIfError(t, err)
+	cm := &corev1.ConfigMap{}
+	cm.Namespace = testNamespace
+	cm.Name = chunkName(testRepo, manifest.Annotations[revisionAnnotation], 1)
+	fatalIfError(t, c.Delete(context.Background(), cm))
+
+	if _, err := db.Tags(testRepo); !errors.Is(err, errTornTags) {
+		t.Fatalf("Tags() got error %v for torn tags, want %v", err, errTornTags)
+	}
+
+	// The next scan replaces the torn tags.
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.4"}))
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual([]string{"v0.0.4"}, loaded) {
+		t.Fatalf("Tags() got %#v after replacing torn tags", loaded)
+	}
+}
+
+func TestConfigMapDatabaseLaggingReader(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	// The reader never observes the writes, as an informer cache lagging
+	// behind.
+	reader := fake.NewClientBuilder().Build()
+	db, err := NewConfigMapDatabase(c, reader, testNamespace)
+	fatalIfError(t, err)
+
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2", "v0.0.1"}))
+	fatalIfError(t, db.SetDigests(testRepo, map[string]string{"v0.0.2": "sha256:2"}))
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.3", "v0.0.2"}))
+
+	// The writes are read back, though not observed by the reader.
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if want := []string{"v0.0.3", "v0.0.2"}; !reflect.DeepEqual(want, loaded) {
+		t.Fatalf("Tags() got %#v, want %#v", loaded, want)
+	}
+	history, err := db.History(testRepo)
+	fatalIfError(t, err)
+	if len(history) != 3 || history[1].Tag != "v0.0.2" || history[1].Digest != "sha256:2" {
+		t.Fatalf("History() got %#v, want the digest of v0.0.2 kept", history)
+	}
+
+	// Once the reader catches up, the tags are read from it.
+	var list corev1.ConfigMapList
+	fatalIfError(t, c.List(context.Background(), &list))
+	for i := range list.Items {
+		cm := list.Items[i].DeepCopy()
+		cm.ResourceVersion = ""
+		fatalIfError(t, reader.Create(context.Background(), cm))
+	}
+	if _, err := db.Tags(testRepo); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.written[testRepo]; ok {
+		t.Fatal("Tags() kept reading from the client after the reader caught up")
+	}
+
+	fatalIfError(t, db.DeleteTags(testRepo))
+	loaded, err = db.Tags(testRepo)
+	fatalIfError(t, err)
+	if len(loaded) != 0 {
+		t.Fatalf("Tags() got %#v after DeleteTags(), want no tags", loaded)
+	}
+}
+
+func TestConfigMapDatabaseConflict(t *testing.T) {
+	conflicts := 1
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if conflicts > 0 {
+				conflicts--
+				return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), errors.New("conflict"))
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	db, err := NewConfigMapDatabase(c, nil, testNamespace)
+	fatalIfError(t, err)
+
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.1"}))
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2"}))
+	if conflicts != 0 {
+		t.Fatal("SetTags() didn't update the manifest")
+	}
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if want := []string{"v0.0.2"}; !reflect.DeepEqual(want, loaded) {
+		t.Fatalf("Tags() got %#v after a conflict, want %#v", loaded, want)
+	}
+}
+
+func TestNewConfigMapDatabase(t *testing.T) {
+	if _, err := NewConfigMapDatabase(nil, nil, testNamespace); err == nil {
+		t.Fatal("NewConfigMapDatabase() returned no error without a client")
+	}
+	if _, err := NewConfigMapDatabase(fake.NewClientBuilder().Build(), nil, ""); err == nil {
+		t.Fatal("NewConfigMapDatabase() returned no error without a namespace")
+	}
+}
+
+func countConfigMaps(t *testing.T, c client.Client) int {
+	t.Helper()
+	return len(configMapVersions(t, c))
+}
+
+func configMapVersions(t *testing.T, c client.Client) map[string]string {
+	t.Helper()
+	var list corev1.ConfigMapList
+	fatalIfError(t, c.List(context.Background(), &list, client.InNamespace(testNamespace)))
+	versions := map[string]string{}
+	for _, cm := range list.Items {
+		versions[cm.Name] = cm.ResourceVersion
+	}
+	return versions
+}
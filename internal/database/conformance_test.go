@@ -0,0 +1,274 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestConformance runs the conformance test suite against every registered
+// backend. A new backend passes it before being registered.
+func TestConformance(t *testing.T) {
+	for _, backend := range Backends() {
+		t.Run(backend, func(t *testing.T) {
+			open := func(t *testing.T) Database {
+				t.Helper()
+				db, err := Open(backend, Options{
+					Path:      t.TempDir(),
+					Client:    fake.NewClientBuilder().Build(),
+					Namespace: "flux-system",
+				})
+				fatalIfError(t, err)
+				t.Cleanup(func() { db.Close() })
+				return db
+			}
+
+			t.Run("unknown repo", func(t *testing.T) {
+				db := open(t)
+				tags, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				if tags == nil || len(tags) != 0 {
+					t.Fatalf("Tags() got %#v for an unknown repo, want an empty set", tags)
+				}
+			})
+
+			t.Run("set and overwrite", func(t *testing.T) {
+				db := open(t)
+				fatalIfError(t, db.SetTags(testRepo, []string{"latest", "v0.0.1"}))
+				fatalIfError(t, db.SetTags("another/repo", []string{"v0.0.2"}))
+				tags := []string{"v0.0.3", "v0.0.4"}
+				fatalIfError(t, db.SetTags(testRepo, tags))
+
+				loaded, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				if !reflect.DeepEqual(tags, loaded) {
+					t.Fatalf("Tags() got %#v, want %#v", loaded, tags)
+				}
+			})
+
+			t.Run("recorded tags are not aliased", func(t *testing.T) {
+				db := open(t)
+				tags := []string{"v0.0.1"}
+				fatalIfError(t, db.SetTags(testRepo, tags))
+				tags[0] = "changed"
+				loaded, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				loaded[0] = "changed too"
+				loaded, err = db.Tags(testRepo)
+				fatalIfError(t, err)
+				if !reflect.DeepEqual([]string{"v0.0.1"}, loaded) {
+					t.Fatalf("Tags() got %#v after changing the slices", loaded)
+				}
+			})
+
+			t.Run("delete and list", func(t *testing.T) {
+				db := open(t)
+				fatalIfError(t, db.SetTags(testRepo, []string{"latest"}))
+				fatalIfError(t, db.SetTags("another/repo", []string{"v0.0.1"}))
+				fatalIfError(t, db.SetTags("third/repo", []string{"v0.0.1"}))
+
+				fatalIfError(t, db.DeleteTags(testRepo))
+				// Deleting missing tags is not an error.
+				fatalIfError(t, db.DeleteTags(testRepo))
+
+				loaded, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				if len(loaded) != 0 {
+					t.Fatalf("DeleteTags() kept tags %#v", loaded)
+				}
+				repos, err := db.Repositories()
+				fatalIfError(t, err)
+				sort.Strings(repos)
+				if want := []string{"another/repo", "third/repo"}; !reflect.DeepEqual(want, repos) {
+					t.Fatalf("Repositories() got %#v, want %#v", repos, want)
+				}
+			})
+
+			t.Run("migrate keys", func(t *testing.T) {
+				db := open(t)
+				objects := []RepositoryObject{
+					{Namespace: "default", Name: "repo", CanonicalName: testRepo},
+					{Namespace: "other", Name: "repo", CanonicalName: testRepo},
+					{Namespace: "default", Name: "another", CanonicalName: "another/repo"},
+				}
+				shared := RepositoryKey("default", "repo", testRepo, true)
+				scoped := RepositoryKey("default", "repo", testRepo, false)
+				otherScoped := RepositoryKey("other", "repo", testRepo, false)
+				fatalIfError(t, db.SetTags(shared, []string{"latest", "v0.0.1"}))
+				fatalIfError(t, db.SetTags(scoped, []string{"v0.0.2"}))
+				fatalIfError(t, db.SetTags("orphaned/repo", []string{"v0.0.1"}))
+
+				// Migrating to scoped keys copies the shared tag sets to the
+				// ImageRepositories of their image without tags.
+				n, err := MigrateKeys(db, false, objects)
+				fatalIfError(t, err)
+				if n != 2 {
+					t.Fatalf("MigrateKeys() migrated %d tag sets, want 2", n)
+				}
+				repos, err := db.Repositories()
+				fatalIfError(t, err)
+				sort.Strings(repos)
+				if want := []string{scoped, otherScoped}; !reflect.DeepEqual(want, repos) {
+					t.Fatalf("MigrateKeys() kept %#v, want %#v", repos, want)
+				}
+				for key, want := range map[string][]string{
+					scoped:      {"v0.0.2"},
+					otherScoped: {"latest", "v0.0.1"},
+				} {
+					tags, err := db.Tags(key)
+					fatalIfError(t, err)
+					if !reflect.DeepEqual(want, tags) {
+						t.Fatalf("Tags() got %#v for '%s' after migration, want %#v", tags, key, want)
+					}
+				}
+
+				// Migrating to shared keys copies one of the scoped tag sets
+				// of each image.
+				n, err = MigrateKeys(db, true, objects)
+				fatalIfError(t, err)
+				if n != 2 {
+					t.Fatalf("MigrateKeys() migrated %d tag sets, want 2", n)
+				}
+				repos, err = db.Repositories()
+				fatalIfError(t, err)
+				if want := []string{shared}; !reflect.DeepEqual(want, repos) {
+					t.Fatalf("MigrateKeys() kept %#v, want %#v", repos, want)
+				}
+			})
+
+			t.Run("history", func(t *testing.T) {
+				db := open(t)
+				t0 := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+				t1 := t0.Add(2 * time.Hour)
+				defer func() { now = time.Now }()
+
+				now = func() time.Time { return t0 }
+				fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2", "v0.0.1"}))
+				now = func() time.Time { return t1 }
+				fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.3", "v0.0.2"}))
+
+				tags, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				if want := []string{"v0.0.3", "v0.0.2"}; !reflect.DeepEqual(want, tags) {
+					t.Fatalf("Tags() got %#v, want %#v", tags, want)
+				}
+				records, err := db.History(testRepo)
+				fatalIfError(t, err)
+				want := []TagRecord{
+					{Tag: "v0.0.3", FirstSeen: t1, LastSeen: t1},
+					{Tag: "v0.0.2", FirstSeen: t0, LastSeen: t1},
+					{Tag: "v0.0.1", FirstSeen: t0, LastSeen: t0, Disappeared: t1},
+				}
+				if !reflect.DeepEqual(want, records) {
+					t.Fatalf("History() got %#v, want %#v", records, want)
+				}
+
+				records, err = db.History("unknown/repo")
+				fatalIfError(t, err)
+				if len(records) != 0 {
+					t.Fatalf("History() got %#v for an unknown repo", records)
+				}
+			})
+
+			t.Run("set history", func(t *testing.T) {
+				db := open(t)
+				at := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+				records := []TagRecord{
+					{Tag: "v0.0.2", FirstSeen: at, LastSeen: at},
+					{Tag: "v0.0.1", FirstSeen: at, LastSeen: at, Disappeared: at},
+				}
+				fatalIfError(t, db.SetTags(testRepo, []string{"latest"}))
+				fatalIfError(t, db.SetHistory(testRepo, records))
+
+				loaded, err := db.History(testRepo)
+				fatalIfError(t, err)
+				if !reflect.DeepEqual(records, loaded) {
+					t.Fatalf("History() got %#v, want %#v", loaded, records)
+				}
+				tags, err := db.Tags(testRepo)
+				fatalIfError(t, err)
+				if !reflect.DeepEqual([]string{"v0.0.2"}, tags) {
+					t.Fatalf("Tags() got %#v, want %#v", tags, []string{"v0.0.2"})
+				}
+			})
+
+			t.Run("digests", func(t *testing.T) {
+				db := open(t)
+				fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2", "v0.0.1"}))
+				fatalIfError(t, db.SetDigests(testRepo, map[string]string{
+					"v0.0.1":  "sha256:0001",
+					"unknown": "sha256:ffff",
+				}))
+				fatalIfError(t, db.SetDigests(testRepo, map[string]string{"v0.0.2": "sha256:0002"}))
+				want := map[string]string{"v0.0.2": "sha256:0002", "v0.0.1": "sha256:0001"}
+				digests, err := db.Digests(testRepo)
+				fatalIfError(t, err)
+				if !reflect.DeepEqual(want, digests) {
+					t.Fatalf("Digests() got %#v, want %#v", digests, want)
+				}
+
+				// The digests are kept by the next scans, and dropped with
+				// the tags.
+				fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.3", "v0.0.2"}))
+				digests, err = db.Digests(testRepo)
+				fatalIfError(t, err)
+				if want := map[string]string{"v0.0.2": "sha256:0002"}; !reflect.DeepEqual(want, digests) {
+					t.Fatalf("Digests() got %#v, want %#v", digests, want)
+				}
+
+				digests, err = db.Digests("unknown/repo")
+				fatalIfError(t, err)
+				if len(digests) != 0 {
+					t.Fatalf("Digests() got %#v for an unknown repo", digests)
+				}
+			})
+
+			t.Run("concurrent writes", func(t *testing.T) {
+				db := open(t)
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						repo := fmt.Sprintf("repo/%d", i)
+						if err := db.SetTags(repo, []string{repo}); err != nil {
+							t.Error(err)
+						}
+					}(i)
+				}
+				wg.Wait()
+				repos, err := db.Repositories()
+				fatalIfError(t, err)
+				if len(repos) != 10 {
+					t.Fatalf("Repositories() got %d repos after concurrent writes, want 10", len(repos))
+				}
+			})
+		})
+	}
+}
+
+func TestOpenInvalidBackend(t *testing.T) {
+	if _, err := Open("etcd", Options{Path: t.TempDir()}); err == nil {
+		t.Fatal("Open() returned no error for an invalid backend")
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BackendBadger stores the tags in a Badger database.
+	BackendBadger = "badger"
+	// BackendConfigMap stores the tags in ConfigMaps in the namespace of the
+	// controller.
+	BackendConfigMap = "configmap"
+	// BackendBolt stores the tags in a bbolt database file.
+	BackendBolt = "bbolt"
+	// BackendMemory keeps the tags in memory, losing them on restart.
+	BackendMemory = "memory"
+)
+
+// Database is implemented by the tags database backends.
+type Database interface {
+	// Tags fetches the tags for the repo. If the repo does not exist, an
+	// empty set of tags is returned.
+	Tags(repo string) ([]string, error)
+	// SetTags records the tags against the repo, overwriting the existing
+	// tag set.
+	SetTags(repo string, tags []string) error
+	// History returns the history of the tags of the repo, the existing
+	// tags first, in the order they were recorded, followed by the
+	// disappeared tags.
+	History(repo string) ([]TagRecord, error)
+	// SetHistory records the tag records against the repo as they are,
+	// overwriting the existing tag set.
+	SetHistory(repo string, records []TagRecord) error
+	// Digests returns the digests recorded for the existing tags of the
+	// repo, by tag. The tags of which the digest wasn't resolved are
+	// omitted.
+	Digests(repo string) (map[string]string, error)
+	// SetDigests records the given digests of the existing tags of the
+	// repo, keeping the other recorded digests. The digests of unknown tags
+	// are ignored.
+	SetDigests(repo string, digests map[string]string) error
+	// DeleteTags deletes the tags recorded against the repo. Deleting the
+	// tags of a repo that does not exist is not an error.
+	DeleteTags(repo string) error
+	// Repositories returns the repos for which tags are recorded.
+	Repositories() ([]string, error)
+	// Close releases the resources of the database.
+	Close() error
+}
+
+// Options configures the opening of a database backend.
+type Options struct {
+	// Path is the directory where the database is stored.
+	Path string
+	// ValueLogFileSize is the size of the memory mapped value log files of
+	// the Badger backend in bytes.
+	ValueLogFileSize int64
+	// EncryptionKeyFile is the file of the key encrypting the Badger
+	// backend, e.g. a mounted Secret. The database is not encrypted if
+	// empty.
+	EncryptionKeyFile string
+	// PreviousEncryptionKeyFile is the file of the key the Badger backend
+	// was encrypted with before rotating to the current key.
+	PreviousEncryptionKeyFile string
+	// EncryptionKeyRotation is the interval at which the Badger backend
+	// rotates the data keys encrypted with the encryption key.
+	EncryptionKeyRotation time.Duration
+	// RecoverCorrupt moves a corrupt Badger backend aside, and opens an
+	// empty database in its place, rather than failing.
+	RecoverCorrupt bool
+	// Client is the Kubernetes client of the ConfigMap backend.
+	Client client.Client
+	// Reader reads the ConfigMaps of the ConfigMap backend, e.g. from the
+	// cache started by StartConfigMapCache. The Client reads them if nil.
+	Reader client.Reader
+	// Namespace is the namespace of the ConfigMaps of the ConfigMap backend.
+	Namespace string
+}
+
+// backends maps the name of the database backends to their opener.
+var backends = map[string]func(opts Options) (Database, error){
+	BackendBadger: func(opts Options) (Database, error) { return OpenBadgerDatabase(opts) },
+	BackendBolt:   func(opts Options) (Database, error) { return OpenBoltDatabase(opts) },
+	BackendConfigMap: func(opts Options) (Database, error) {
+		return NewConfigMapDatabase(opts.Client, opts.Reader, opts.Namespace)
+	},
+	BackendMemory: func(opts Options) (Database, error) { return NewMemoryDatabase(), nil },
+}
+
+// Backends returns the names of the database backends, sorted.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the database of the given backend.
+func Open(backend string, opts Options) (Database, error) {
+	open, ok := backends[backend]
+	if !ok {
+		return nil, fmt.Errorf("invalid database backend '%s', must be one of: %s",
+			backend, strings.Join(Backends(), ", "))
+	}
+	return open(opts)
+}
+
+// RepositoryObject identifies an ImageRepository by the parts of the keys of
+// its tags.
+type RepositoryObject struct {
+	Namespace     string
+	Name          string
+	CanonicalName string
+}
+
+// MigrateKeys migrates the tag sets recorded with another key scheme than the
+// given one, either scoped to the ImageRepository objects or shared by
+// canonical image name. A shared tag set is copied to the scoped keys of the
+// given ImageRepositories of its image, and a scoped tag set to the shared key
+// of its image, unless tags are already recorded under the new key, e.g. from
+// another scoped tag set of the same image. The tag sets of the other key
+// scheme are deleted once copied. It returns the number of migrated tag sets.
+func MigrateKeys(db Database, shared bool, objects []RepositoryObject) (int, error) {
+	repos, err := db.Repositories()
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, repo := range repos {
+		keys, ok := migratedKeys(repo, shared, objects)
+		if !ok {
+			continue
+		}
+		records, err := db.History(repo)
+		if err != nil {
+			return migrated, err
+		}
+		if err := setHistoryIfEmpty(db, keys, records); err != nil {
+			return migrated, err
+		}
+		if err := db.DeleteTags(repo); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migratedKeys returns the keys of the given key scheme the tag set of the
+// repo is migrated to, and false if the repo is already recorded with the
+// given key scheme.
+func migratedKeys(repo string, shared bool, objects []RepositoryObject) ([]string, bool) {
+	if isScopedKey(repo) != shared {
+		return nil, false
+	}
+	if shared {
+		_, canonicalName, _ := strings.Cut(repo, scopeSeparator)
+		return []string{canonicalName}, true
+	}
+	var keys []string
+	for _, o := range objects {
+		if o.CanonicalName == repo {
+			keys = append(keys, RepositoryKey(o.Namespace, o.Name, o.CanonicalName, false))
+		}
+	}
+	return keys, true
+}
+
+// setHistoryIfEmpty records the tag records under the keys that don't record
+// tags yet.
+func setHistoryIfEmpty(db Database, keys []string, records []TagRecord) error {
+	for _, key := range keys {
+		existing, err := db.History(key)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+		if err := db.SetHistory(key, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"bytes"
+	"compress/flate"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The tag sets are encoded in a versioned binary format:
+//
+//	byte 0      the encoding version
+//	bytes 1-8   the revision of the tag set, big endian
+//	bytes 9-    the flate compressed body
+//
+// The body of encodingV3 is the number of tag records as a uvarint, followed
+// by the records: the tag prefixed with its length as a uvarint, the first
+// seen, last seen and disappeared times in Unix seconds as varints, zero if
+// unknown, and the digest prefixed with its length as a uvarint. The records
+// of encodingV2 have no digest. The body of encodingV1 is the number of tags
+// as a uvarint, followed by the tags prefixed with their length as a uvarint.
+//
+// The revision is derived from the compressed body, so that the decoded tag
+// sets can be cached until their revision changes. The tag sets recorded by
+// the previous versions, in encodingV1, encodingV2 or JSON encoded, are still
+// read, as tag records without times or digests, and written in the latest
+// version on the next update.
+const (
+	encodingV1 byte = 1
+	encodingV2 byte = 2
+	encodingV3 byte = 3
+
+	encodingHeaderSize = 1 + 8
+)
+
+// marshal encodes the tag records in the latest encoding version.
+func marshal(records []TagRecord) ([]byte, error) {
+	var body bytes.Buffer
+	w, err := flate.NewWriter(&body, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	var n [binary.MaxVarintLen64]byte
+	buf := n[:binary.PutUvarint(n[:], uint64(len(records)))]
+	for _, r := range records {
+		buf = binary.AppendUvarint(buf, uint64(len(r.Tag)))
+		buf = append(buf, r.Tag...)
+		buf = binary.AppendVarint(buf, unixOrZero(r.FirstSeen))
+		buf = binary.AppendVarint(buf, unixOrZero(r.LastSeen))
+		buf = binary.AppendVarint(buf, unixOrZero(r.Disappeared))
+		buf = binary.AppendUvarint(buf, uint64(len(r.Digest)))
+		buf = append(buf, r.Digest...)
+		if len(buf) > 32*1024 {
+			if _, err := w.Write(buf); err != nil {
+				return nil, err
+			}
+			buf = buf[:0]
+		}
+	}
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	b := make([]byte, encodingHeaderSize, encodingHeaderSize+body.Len())
+	b[0] = encodingV3
+	copy(b[1:encodingHeaderSize], sum[:8])
+	return append(b, body.Bytes()...), nil
+}
+
+// unmarshal decodes the tags, excluding the disappeared tags, of any encoding
+// version, or JSON.
+func unmarshal(b []byte) ([]string, error) {
+	if len(b) > 0 && (b[0] == encodingV2 || b[0] == encodingV3) {
+		var tags []string
+		err := decodeRecords(b, func(count uint64) {
+			tags = make([]string, 0, count)
+		}, func(r TagRecord) {
+			if r.Disappeared.IsZero() {
+				tags = append(tags, r.Tag)
+			}
+		})
+		return tags, err
+	}
+	if len(b) > 0 && b[0] == encodingV1 {
+		return unmarshalV1(b)
+	}
+	var tags []string
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return nil, fmt.Errorf("unsupported tags encoding: %w", err)
+	}
+	return tags, nil
+}
+
+// unmarshalHistory decodes the tag records of any encoding version, or JSON.
+// The tags of the encodings without history are returned as records without
+// times.
+func unmarshalHistory(b []byte) ([]TagRecord, error) {
+	if len(b) > 0 && (b[0] == encodingV2 || b[0] == encodingV3) {
+		var records []TagRecord
+		err := decodeRecords(b, func(count uint64) {
+			records = make([]TagRecord, 0, count)
+		}, func(r TagRecord) {
+			records = append(records, r)
+		})
+		return records, err
+	}
+	tags, err := unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return recordsOf(tags), nil
+}
+
+// decodeRecords decodes the tag records of encodingV2 or encodingV3, calling
+// start with the number of records, then add with every record.
+func decodeRecords(b []byte, start func(count uint64), add func(TagRecord)) error {
+	raw, err := decompressBody(b)
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(raw)
+	if n <= 0 || count > uint64(len(raw)) {
+		return errors.New("invalid tags count")
+	}
+	start(count)
+	// Convert the decompressed body to a string once, and slice the tags out
+	// of it, rather than allocating every tag.
+	s := string(raw)
+	i := n
+	for c := uint64(0); c < count; c++ {
+		l, n := binary.Uvarint(raw[i:])
+		if n <= 0 || uint64(len(raw)-i-n) < l {
+			return errors.New("truncated tags")
+		}
+		i += n
+		r := TagRecord{Tag: s[i : i+int(l)]}
+		i += int(l)
+		for _, t := range []*time.Time{&r.FirstSeen, &r.LastSeen, &r.Disappeared} {
+			v, n := binary.Varint(raw[i:])
+			if n <= 0 {
+				return errors.New("truncated tag times")
+			}
+			i += n
+			if v != 0 {
+				*t = time.Unix(v, 0).UTC()
+			}
+		}
+		if b[0] == encodingV3 {
+			l, n := binary.Uvarint(raw[i:])
+			if n <= 0 || uint64(len(raw)-i-n) < l {
+				return errors.New("truncated tag digest")
+			}
+			i += n
+			r.Digest = s[i : i+int(l)]
+			i += int(l)
+		}
+		add(r)
+	}
+	return nil
+}
+
+func unmarshalV1(b []byte) ([]string, error) {
+	raw, err := decompressBody(b)
+	if err != nil {
+		return nil, err
+	}
+	count, n := binary.Uvarint(raw)
+	if n <= 0 || count > uint64(len(raw)) {
+		return nil, errors.New("invalid tags count")
+	}
+	s := string(raw)
+	tags := make([]string, 0, count)
+	for i := n; uint64(len(tags)) < count; {
+		l, n := binary.Uvarint(raw[i:])
+		if n <= 0 || uint64(len(raw)-i-n) < l {
+			return nil, errors.New("truncated tags")
+		}
+		i += n
+		tags = append(tags, s[i:i+int(l)])
+		i += int(l)
+	}
+	return tags, nil
+}
+
+// decompressBody returns the decompressed body of the binary encodings.
+func decompressBody(b []byte) ([]byte, error) {
+	if len(b) < encodingHeaderSize {
+		return nil, errors.New("truncated tags header")
+	}
+	r := flate.NewReader(bytes.NewReader(b[encodingHeaderSize:]))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// revisionOf returns the revision of the encoded tags, false for the
+// encodings without revision.
+func revisionOf(b []byte) (uint64, bool) {
+	if len(b) < encodingHeaderSize || b[0] < encodingV1 || b[0] > encodingV3 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[1:encodingHeaderSize]), true
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// maxCachedTags bounds the number of tags kept by a tagsCache, across all the
+// cached tag sets.
+const maxCachedTags = 1 << 20
+
+// tagsCache caches the decoded tag sets by repo, as long as the revision of
+// the recorded tag set doesn't change, so that the large tag sets read by
+// every ImagePolicy reconciliation aren't decoded again. The least recently
+// used tag sets are evicted once more than maxTags tags are cached.
+type tagsCache struct {
+	mu      sync.Mutex
+	maxTags int
+	size    int
+	entries map[string]*list.Element
+	lru     list.List
+}
+
+type cachedTags struct {
+	repo     string
+	revision uint64
+	tags     []string
+}
+
+// decode returns the decoded tags of the repo, from the cache if the revision
+// of the encoded tags matches. The returned slice is owned by the caller.
+func (c *tagsCache) decode(repo string, b []byte) ([]string, error) {
+	revision, ok := revisionOf(b)
+	if !ok {
+		return unmarshal(b)
+	}
+
+	c.mu.Lock()
+	if e, hit := c.entries[repo]; hit && e.Value.(*cachedTags).revision == revision {
+		c.lru.MoveToFront(e)
+		tags := append([]string{}, e.Value.(*cachedTags).tags...)
+		c.mu.Unlock()
+		return tags, nil
+	}
+	c.mu.Unlock()
+
+	tags, err := unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.store(&cachedTags{repo: repo, revision: revision, tags: tags})
+	c.mu.Unlock()
+	return append([]string{}, tags...), nil
+}
+
+// store caches the entry, evicting the least recently used tag sets to stay
+// within the limit. Tag sets larger than the limit aren't cached.
+func (c *tagsCache) store(entry *cachedTags) {
+	c.remove(entry.repo)
+	limit := c.maxTags
+	if limit == 0 {
+		limit = maxCachedTags
+	}
+	if len(entry.tags) > limit {
+		return
+	}
+	for c.size+len(entry.tags) > limit {
+		c.remove(c.lru.Back().Value.(*cachedTags).repo)
+	}
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+	}
+	c.entries[entry.repo] = c.lru.PushFront(entry)
+	c.size += len(entry.tags)
+}
+
+func (c *tagsCache) remove(repo string) {
+	e, ok := c.entries[repo]
+	if !ok {
+		return
+	}
+	c.lru.Remove(e)
+	delete(c.entries, repo)
+	c.size -= len(e.Value.(*cachedTags).tags)
+}
+
+// forget drops the cached tags of the repo.
+func (c *tagsCache) forget(repo string) {
+	c.mu.Lock()
+	c.remove(repo)
+	c.mu.Unlock()
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, tags := range [][]string{
+		{},
+		{""},
+		{"latest", "v0.0.1", "1.0.0-rc.1+build.42"},
+		{"ünïcode", "main-ab12cd3-1689000000"},
+		testTags(1000),
+	} {
+		b, err := marshal(recordsOf(tags))
+		fatalIfError(t, err)
+		if b[0] != encodingV3 {
+			t.Fatalf("marshal() got encoding version %d, want %d", b[0], encodingV3)
+		}
+		loaded, err := unmarshal(b)
+		fatalIfError(t, err)
+		if !reflect.DeepEqual(tags, loaded) {
+			t.Fatalf("unmarshal() got %#v, want %#v", loaded, tags)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tags := []string{"latest", "v0.0.1"}
+	b, err := json.Marshal(tags)
+	fatalIfError(t, err)
+	loaded, err := unmarshal(b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, loaded) {
+		t.Fatalf("unmarshal() got %#v, want %#v", loaded, tags)
+	}
+	if _, ok := revisionOf(b); ok {
+		t.Fatal("revisionOf() got a revision for JSON tags")
+	}
+}
+
+func TestUnmarshalV1(t *testing.T) {
+	tags := []string{"latest", "v0.0.1"}
+	var raw []byte
+	raw = binary.AppendUvarint(raw, uint64(len(tags)))
+	for _, tag := range tags {
+		raw = binary.AppendUvarint(raw, uint64(len(tag)))
+		raw = append(raw, tag...)
+	}
+	var body bytes.Buffer
+	w, err := flate.NewWriter(&body, flate.DefaultCompression)
+	fatalIfError(t, err)
+	_, err = w.Write(raw)
+	fatalIfError(t, err)
+	fatalIfError(t, w.Close())
+	b := append([]byte{encodingV1, 0, 0, 0, 0, 0, 0, 0, 1}, body.Bytes()...)
+
+	loaded, err := unmarshal(b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, loaded) {
+		t.Fatalf("unmarshal() got %#v, want %#v", loaded, tags)
+	}
+	records, err := unmarshalHistory(b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(recordsOf(tags), records) {
+		t.Fatalf("unmarshalHistory() got %#v, want %#v", records, recordsOf(tags))
+	}
+}
+
+func TestUnmarshalV2(t *testing.T) {
+	at := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	records := []TagRecord{
+		{Tag: "v0.0.2", FirstSeen: at, LastSeen: at},
+		{Tag: "v0.0.1", FirstSeen: at, LastSeen: at, Disappeared: at},
+	}
+	var raw []byte
+	raw = binary.AppendUvarint(raw, uint64(len(records)))
+	for _, r := range records {
+		raw = binary.AppendUvarint(raw, uint64(len(r.Tag)))
+		raw = append(raw, r.Tag...)
+		raw = binary.AppendVarint(raw, unixOrZero(r.FirstSeen))
+		raw = binary.AppendVarint(raw, unixOrZero(r.LastSeen))
+		raw = binary.AppendVarint(raw, unixOrZero(r.Disappeared))
+	}
+	var body bytes.Buffer
+	w, err := flate.NewWriter(&body, flate.DefaultCompression)
+	fatalIfError(t, err)
+	_, err = w.Write(raw)
+	fatalIfError(t, err)
+	fatalIfError(t, w.Close())
+	b := append([]byte{encodingV2, 0, 0, 0, 0, 0, 0, 0, 1}, body.Bytes()...)
+
+	loaded, err := unmarshalHistory(b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(records, loaded) {
+		t.Fatalf("unmarshalHistory() got %#v, want %#v", loaded, records)
+	}
+	tags, err := unmarshal(b)
+	fatalIfError(t, err)
+	if want := []string{"v0.0.2"}; !reflect.DeepEqual(want, tags) {
+		t.Fatalf("unmarshal() got %#v, want %#v", tags, want)
+	}
+}
+
+func TestMarshalHistory(t *testing.T) {
+	at := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	records := []TagRecord{
+		{Tag: "v0.0.2", FirstSeen: at, LastSeen: at.Add(time.Hour), Digest: "sha256:0002"},
+		{Tag: "v0.0.1"},
+		{Tag: "v0.0.0", FirstSeen: at, LastSeen: at, Disappeared: at.Add(time.Hour)},
+	}
+	b, err := marshal(records)
+	fatalIfError(t, err)
+
+	loaded, err := unmarshalHistory(b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(records, loaded) {
+		t.Fatalf("unmarshalHistory() got %#v, want %#v", loaded, records)
+	}
+	tags, err := unmarshal(b)
+	fatalIfError(t, err)
+	if want := []string{"v0.0.2", "v0.0.1"}; !reflect.DeepEqual(want, tags) {
+		t.Fatalf("unmarshal() got %#v, want %#v", tags, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	b, err := marshal(recordsOf(testTags(10)))
+	fatalIfError(t, err)
+	for _, invalid := range [][]byte{
+		{encodingV2},
+		{encodingV3},
+		b[:len(b)/2],
+		{42, 0, 0},
+	} {
+		if _, err := unmarshal(invalid); err == nil {
+			t.Fatalf("unmarshal() returned no error for %v", invalid)
+		}
+	}
+}
+
+func TestRevision(t *testing.T) {
+	a1, err := marshal(recordsOf([]string{"v0.0.1"}))
+	fatalIfError(t, err)
+	a2, err := marshal(recordsOf([]string{"v0.0.1"}))
+	fatalIfError(t, err)
+	b, err := marshal(recordsOf([]string{"v0.0.2"}))
+	fatalIfError(t, err)
+
+	ra1, _ := revisionOf(a1)
+	ra2, _ := revisionOf(a2)
+	rb, _ := revisionOf(b)
+	if ra1 != ra2 {
+		t.Fatal("revisionOf() got different revisions for the same tags")
+	}
+	if ra1 == rb {
+		t.Fatal("revisionOf() got the same revision for different tags")
+	}
+}
+
+func TestTagsCache(t *testing.T) {
+	var cache tagsCache
+	b, err := marshal(recordsOf([]string{"v0.0.1"}))
+	fatalIfError(t, err)
+
+	tags, err := cache.decode(testRepo, b)
+	fatalIfError(t, err)
+	tags[0] = "changed"
+	tags, err = cache.decode(testRepo, b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual([]string{"v0.0.1"}, tags) {
+		t.Fatalf("decode() got %#v after changing the returned tags", tags)
+	}
+
+	// A new revision is decoded again.
+	b, err = marshal(recordsOf([]string{"v0.0.2"}))
+	fatalIfError(t, err)
+	tags, err = cache.decode(testRepo, b)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual([]string{"v0.0.2"}, tags) {
+		t.Fatalf("decode() got %#v for a new revision", tags)
+	}
+}
+
+func TestTagsCacheEviction(t *testing.T) {
+	cache := tagsCache{maxTags: 3}
+	encoded := map[string][]byte{}
+	for _, repo := range []string{"a", "b", "c"} {
+		b, err := marshal(recordsOf([]string{repo + "1", repo + "2"}))
+		fatalIfError(t, err)
+		encoded[repo] = b
+	}
+
+	for _, repo := range []string{"a", "b", "c"} {
+		_, err := cache.decode(repo, encoded[repo])
+		fatalIfError(t, err)
+		if cache.size > cache.maxTags {
+			t.Fatalf("cache holds %d tags, more than %d", cache.size, cache.maxTags)
+		}
+	}
+	if _, ok := cache.entries["c"]; !ok || len(cache.entries) != 1 {
+		t.Fatalf("cache holds %d tag sets, want only the most recent one", len(cache.entries))
+	}
+
+	// Tag sets larger than the limit aren't cached.
+	b, err := marshal(recordsOf([]string{"d1", "d2", "d3", "d4"}))
+	fatalIfError(t, err)
+	tags, err := cache.decode("d", b)
+	fatalIfError(t, err)
+	if len(tags) != 4 {
+		t.Fatalf("decode() got %#v", tags)
+	}
+	if _, ok := cache.entries["d"]; ok {
+		t.Fatal("cache holds a tag set larger than the limit")
+	}
+
+	cache.forget("c")
+	if cache.size != 0 || cache.lru.Len() != 0 {
+		t.Fatalf("cache holds %d tags after forgetting all repos", cache.size)
+	}
+}
+
+func TestBadgerReadsJSONTags(t *testing.T) {
+	db := createBadgerDatabase(t)
+	tags := []string{"latest", "v0.0.1"}
+	b, err := json.Marshal(tags)
+	fatalIfError(t, err)
+	fatalIfError(t, db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(keyForRepo(tagsPrefix, testRepo), b)
+	}))
+
+	loaded, err := db.Tags(testRepo)
+	fatalIfError(t, err)
+	if !reflect.DeepEqual(tags, loaded) {
+		t.Fatalf("Tags() got %#v, want %#v", loaded, tags)
+	}
+
+	// The next update migrates the JSON tags, of which the first seen time
+	// is unknown.
+	fatalIfError(t, db.SetTags(testRepo, []string{"v0.0.2", "v0.0.1"}))
+	records, err := db.History(testRepo)
+	fatalIfError(t, err)
+	if len(records) != 3 || records[0].FirstSeen.IsZero() || !records[1].FirstSeen.IsZero() ||
+		records[2].Tag != "latest" || records[2].Disappeared.IsZero() {
+		t.Fatalf("History() got %#v after migrating JSON tags", records)
+	}
+}
+
+// testTags returns n tags looking like the tags of a busy repository.
+func testTags(n int) []string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("main-%07x-%d", i*7919, 1689000000+i)
+	}
+	return tags
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	tags := testTags(100000)
+	jsonTags, err := json.Marshal(tags)
+	if err != nil {
+		b.Fatal(err)
+	}
+	binaryTags, err := marshal(recordsOf(tags))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Logf("encoded size: JSON %d bytes, binary %d bytes", len(jsonTags), len(binaryTags))
+
+	for _, bm := range []struct {
+		name    string
+		encoded []byte
+	}{
+		{name: "json", encoded: jsonTags},
+		{name: "binary", encoded: binaryTags},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := unmarshal(bm.encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Run("binary-cached", func(b *testing.B) {
+		var cache tagsCache
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.decode(testRepo, binaryTags); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkBadgerTags(b *testing.B) {
+	db, err := OpenBadgerDatabase(Options{Path: b.TempDir()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetTags(testRepo, testTags(100000)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Tags(testRepo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
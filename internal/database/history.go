@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// lastSeenResolution is the resolution of the last seen time of the
+	// tags. Recording every scan would change the tag set, and write it, on
+	// every scan.
+	lastSeenResolution = time.Hour
+	// maxDisappearedTags is the number of disappeared tags kept in the
+	// history of a repo. The tags that disappeared first are dropped.
+	maxDisappearedTags = 1000
+)
+
+// now returns the current time, replaced in tests.
+var now = time.Now
+
+// TagRecord is the history of a tag of a repo.
+type TagRecord struct {
+	// Tag is the tag.
+	Tag string
+	// FirstSeen is when the tag was first seen, zero if it was recorded
+	// before the history was.
+	FirstSeen time.Time
+	// LastSeen is when the tag was last seen, within an hour.
+	LastSeen time.Time
+	// Disappeared is when the tag was first seen missing, zero while the tag
+	// exists.
+	Disappeared time.Time
+	// Digest is the digest of the image of the tag when it was resolved,
+	// empty if it wasn't.
+	Digest string
+}
+
+// recordsOf returns the tag records of the tags, without times.
+func recordsOf(tags []string) []TagRecord {
+	records := make([]TagRecord, len(tags))
+	for i, tag := range tags {
+		records[i] = TagRecord{Tag: tag}
+	}
+	return records
+}
+
+// updateHistory returns the tag records of the given tags, in the same order,
+// followed by the records of the disappeared tags, updating the previous
+// records at the given time.
+func updateHistory(previous []TagRecord, tags []string, at time.Time) []TagRecord {
+	at = at.UTC().Truncate(time.Second)
+	known := make(map[string]TagRecord, len(previous))
+	for _, r := range previous {
+		known[r.Tag] = r
+	}
+
+	records := make([]TagRecord, 0, len(tags))
+	present := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		present[tag] = struct{}{}
+		r, ok := known[tag]
+		switch {
+		case !ok:
+			r = TagRecord{Tag: tag, FirstSeen: at, LastSeen: at}
+		case !r.Disappeared.IsZero():
+			// The tag reappeared, e.g. it was pushed again, possibly with
+			// another image.
+			r.Disappeared = time.Time{}
+			r.LastSeen = at
+			r.Digest = ""
+		case at.Sub(r.LastSeen) >= lastSeenResolution:
+			r.LastSeen = at
+		}
+		records = append(records, r)
+	}
+
+	var disappeared []TagRecord
+	for _, r := range previous {
+		if _, ok := present[r.Tag]; ok {
+			continue
+		}
+		if r.Disappeared.IsZero() {
+			r.Disappeared = at
+		}
+		disappeared = append(disappeared, r)
+	}
+	sort.SliceStable(disappeared, func(i, j int) bool {
+		return disappeared[i].Disappeared.Before(disappeared[j].Disappeared)
+	})
+	if len(disappeared) > maxDisappearedTags {
+		disappeared = disappeared[len(disappeared)-maxDisappearedTags:]
+	}
+	return append(records, disappeared...)
+}
+
+// digestsOf returns the digests of the existing tags of the records that have
+// one.
+func digestsOf(records []TagRecord) map[string]string {
+	digests := map[string]string{}
+	for _, r := range records {
+		if r.Disappeared.IsZero() && r.Digest != "" {
+			digests[r.Tag] = r.Digest
+		}
+	}
+	return digests
+}
+
+// withDigests returns the records with the given digests of the existing
+// tags, and whether any digest changed.
+func withDigests(records []TagRecord, digests map[string]string) ([]TagRecord, bool) {
+	updated := append([]TagRecord{}, records...)
+	changed := false
+	for i, r := range updated {
+		if d, ok := digests[r.Tag]; ok && r.Disappeared.IsZero() && r.Digest != d {
+			updated[i].Digest = d
+			changed = true
+		}
+	}
+	return updated, changed
+}
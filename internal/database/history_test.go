@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdateHistory(t *testing.T) {
+	t0 := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(10 * time.Minute)
+	t2 := t0.Add(2 * time.Hour)
+
+	records := updateHistory(nil, []string{"v0.0.2", "v0.0.1"}, t0)
+	want := []TagRecord{
+		{Tag: "v0.0.2", FirstSeen: t0, LastSeen: t0},
+		{Tag: "v0.0.1", FirstSeen: t0, LastSeen: t0},
+	}
+	if !reflect.DeepEqual(want, records) {
+		t.Fatalf("updateHistory() got %#v, want %#v", records, want)
+	}
+
+	// The last seen time is kept within its resolution.
+	records = updateHistory(records, []string{"v0.0.3", "v0.0.2"}, t1)
+	want = []TagRecord{
+		{Tag: "v0.0.3", FirstSeen: t1, LastSeen: t1},
+		{Tag: "v0.0.2", FirstSeen: t0, LastSeen: t0},
+		{Tag: "v0.0.1", FirstSeen: t0, LastSeen: t0, Disappeared: t1},
+	}
+	if !reflect.DeepEqual(want, records) {
+		t.Fatalf("updateHistory() got %#v, want %#v", records, want)
+	}
+
+	// A reappeared tag keeps its first seen time, but not its digest.
+	records[0].Digest = "sha256:0003"
+	records[2].Digest = "sha256:0001"
+	records = updateHistory(records, []string{"v0.0.1", "v0.0.3"}, t2)
+	want = []TagRecord{
+		{Tag: "v0.0.1", FirstSeen: t0, LastSeen: t2},
+		{Tag: "v0.0.3", FirstSeen: t1, LastSeen: t2, Digest: "sha256:0003"},
+		{Tag: "v0.0.2", FirstSeen: t0, LastSeen: t0, Disappeared: t2},
+	}
+	if !reflect.DeepEqual(want, records) {
+		t.Fatalf("updateHistory() got %#v, want %#v", records, want)
+	}
+}
+
+func TestUpdateHistoryMigratedTags(t *testing.T) {
+	at := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	records := updateHistory(recordsOf([]string{"v0.0.1", "v0.0.0"}), []string{"v0.0.1"}, at)
+	want := []TagRecord{
+		{Tag: "v0.0.1", LastSeen: at},
+		{Tag: "v0.0.0", Disappeared: at},
+	}
+	if !reflect.DeepEqual(want, records) {
+		t.Fatalf("updateHistory() got %#v, want %#v", records, want)
+	}
+}
+
+func TestUpdateHistoryDropsOldestDisappeared(t *testing.T) {
+	at := time.Date(2023, 7, 10, 12, 0, 0, 0, time.UTC)
+	var records []TagRecord
+	for i := 0; i <= maxDisappearedTags; i++ {
+		records = updateHistory(records, []string{fmt.Sprintf("v%d", i)}, at.Add(time.Duration(i)*time.Minute))
+	}
+	records = updateHistory(records, nil, at.Add(24*time.Hour))
+	if len(records) != maxDisappearedTags {
+		t.Fatalf("updateHistory() kept %d disappeared tags, want %d", len(records), maxDisappearedTags)
+	}
+	if records[0].Tag != "v1" {
+		t.Fatalf("updateHistory() kept %q first, want the oldest disappeared tag dropped", records[0].Tag)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scopeSeparator separates the ImageRepository object from the canonical image
+// name in the scoped keys. It can't be part of a canonical image name.
+const scopeSeparator = "@"
+
+// RepositoryKey returns the key of the tags of the ImageRepository with the
+// given namespace, name and canonical image name. Unless shared, the tags are
+// scoped to the ImageRepository object, so that the ImageRepositories of the
+// same image don't read the tags scanned with each other's credentials. When
+// shared, the tags are keyed by the canonical image name only.
+func RepositoryKey(namespace, name, canonicalName string, shared bool) string {
+	if shared {
+		return canonicalName
+	}
+	return fmt.Sprintf("%s/%s%s%s", namespace, name, scopeSeparator, canonicalName)
+}
+
+// KeyNamespace returns the namespace of the ImageRepository of the given
+// repository key, and false if the key is shared by canonical image name.
+func KeyNamespace(repo string) (string, bool) {
+	object, _, scoped := strings.Cut(repo, scopeSeparator)
+	if !scoped {
+		return "", false
+	}
+	namespace, _, _ := strings.Cut(object, "/")
+	return namespace, true
+}
+
+// isScopedKey returns whether the given repository key is scoped to an
+// ImageRepository object.
+func isScopedKey(repo string) bool {
+	return strings.Contains(repo, scopeSeparator)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package database
+
+import (
+	"sync"
+)
+
+// MemoryDatabase provides an implementation of the tags database kept in
+// memory, for ephemeral controllers and tests. The tags are lost on restart,
+// and the ImageRepositories are scanned again.
+type MemoryDatabase struct {
+	mu      sync.RWMutex
+	records map[string][]TagRecord
+}
+
+// NewMemoryDatabase creates and returns a new, empty, in-memory database.
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{
+		records: map[string][]TagRecord{},
+	}
+}
+
+// Tags implements the DatabaseReader interface, fetching the tags for the repo.
+//
+// If the repo does not exist, an empty set of tags is returned.
+func (m *MemoryDatabase) Tags(repo string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tags := []string{}
+	for _, r := range m.records[repo] {
+		if r.Disappeared.IsZero() {
+			tags = append(tags, r.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// SetTags implements the DatabaseWriter interface, recording the tags against
+// the repo.
+//
+// It overwrites existing tag sets for the provided repo, updating the history
+// of the tags.
+func (m *MemoryDatabase) SetTags(repo string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[repo] = updateHistory(m.records[repo], tags, now())
+	return nil
+}
+
+// SetHistory records the tag records against the repo as they are, e.g. when
+// importing them.
+func (m *MemoryDatabase) SetHistory(repo string, records []TagRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[repo] = append([]TagRecord{}, records...)
+	return nil
+}
+
+// History returns the history of the tags of the repo, the existing tags
+// first, in the order they were recorded, followed by the disappeared tags.
+func (m *MemoryDatabase) History(repo string) ([]TagRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]TagRecord{}, m.records[repo]...), nil
+}
+
+// Digests returns the digests recorded for the existing tags of the repo.
+func (m *MemoryDatabase) Digests(repo string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return digestsOf(m.records[repo]), nil
+}
+
+// SetDigests records the given digests of the existing tags of the repo.
+func (m *MemoryDatabase) SetDigests(repo string, digests map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if records, changed := withDigests(m.records[repo], digests); changed {
+		m.records[repo] = records
+	}
+	return nil
+}
+
+// DeleteTags implements the DatabaseWriter interface, deleting the tags
+// recorded against the repo.
+func (m *MemoryDatabase) DeleteTags(repo string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, repo)
+	return nil
+}
+
+// Repositories returns the repos for which tags are recorded.
+func (m *MemoryDatabase) Repositories() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	repos := make([]string, 0, len(m.records))
+	for repo := range m.records {
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// Close implements the Database interface. There is nothing to release.
+func (m *MemoryDatabase) Close() error {
+	return nil
+}
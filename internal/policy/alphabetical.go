@@ -53,7 +53,7 @@ func NewAlphabetical(order string) (*Alphabetical, error) {
 // Latest returns latest version from a provided list of strings
 func (p *Alphabetical) Latest(versions []string) (string, error) {
 	if len(versions) == 0 {
-		return "", fmt.Errorf("version list argument cannot be empty")
+		return "", ErrEmptyVersionList
 	}
 
 	var sorted sort.StringSlice = versions
@@ -64,3 +64,19 @@ func (p *Alphabetical) Latest(versions []string) (string, error) {
 	}
 	return sorted[0], nil
 }
+
+// Rank returns the provided list of strings ordered from the latest
+func (p *Alphabetical) Rank(versions []string) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, ErrEmptyVersionList
+	}
+
+	sorted := make(sort.StringSlice, len(versions))
+	copy(sorted, versions)
+	if p.Order == AlphabeticalOrderDesc {
+		sort.Sort(sorted)
+	} else {
+		sort.Sort(sort.Reverse(sorted))
+	}
+	return sorted, nil
+}
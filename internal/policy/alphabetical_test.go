@@ -17,6 +17,7 @@ limitations under the License.
 package policy
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -142,3 +143,35 @@ func TestAlphabetical_Latest(t *testing.T) {
 		})
 	}
 }
+
+func TestAlphabetical_Rank(t *testing.T) {
+	versions := []string{"aaa", "ccc", "bbb"}
+	cases := []struct {
+		label    string
+		order    string
+		expected []string
+	}{
+		{label: "With ascending order", order: AlphabeticalOrderAsc, expected: []string{"ccc", "bbb", "aaa"}},
+		{label: "With descending order", order: AlphabeticalOrderDesc, expected: []string{"aaa", "bbb", "ccc"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			policy, err := NewAlphabetical(tt.order)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			ranked, err := policy.Rank(versions)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(ranked, tt.expected) {
+				t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, tt.expected)
+			}
+		})
+	}
+
+	if versions[0] != "aaa" {
+		t.Errorf("the provided list was modified")
+	}
+}
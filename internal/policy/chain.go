@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Chain represents an ordered list of policies. The policies are evaluated in
+// order and the first one that determines a latest version yields the result.
+// The next policy is only evaluated when the previous one accepts none of the
+// versions, any other error is returned as is.
+type Chain struct {
+	Policies []Policer
+	// Filters are the tag filters of the policies at the same index, applied
+	// to the versions before evaluating the policy. When set, the chain is
+	// evaluated on the unfiltered tags and returns them. A nil filter keeps
+	// the tags as they are.
+	Filters []*RegexFilter
+
+	resolved int
+}
+
+// NewChain constructs a Chain object from the provided policies
+func NewChain(policies ...Policer) (*Chain, error) {
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("policies argument cannot be empty")
+	}
+	return &Chain{
+		Policies: policies,
+	}, nil
+}
+
+// Latest returns latest version from a provided list of strings
+func (p *Chain) Latest(versions []string) (string, error) {
+	latest, _, err := p.LatestWithIndex(versions)
+	return latest, err
+}
+
+// LatestWithIndex returns latest version from a provided list of strings
+// along with the index of the policy in the chain that determined it
+func (p *Chain) LatestWithIndex(versions []string) (string, int, error) {
+	var errs []string
+	for i, policer := range p.Policies {
+		values, original := p.filter(i, versions)
+		latest, err := policer.Latest(values)
+		if err == nil {
+			p.resolved = i
+			return original(latest), i, nil
+		}
+		if !noMatch(err) {
+			p.resolved = -1
+			return "", -1, err
+		}
+		errs = append(errs, err.Error())
+	}
+	p.resolved = -1
+	return "", -1, fmt.Errorf("no policy in the chain determined a latest version: %s", strings.Join(errs, "; "))
+}
+
+// Rank returns the candidates of the first policy in the chain that
+// determines a latest version, ordered from the latest
+func (p *Chain) Rank(versions []string) ([]string, error) {
+	var errs []string
+	for i, policer := range p.Policies {
+		values, original := p.filter(i, versions)
+		ranked, err := policer.Rank(values)
+		if err == nil {
+			p.resolved = i
+			for j := range ranked {
+				ranked[j] = original(ranked[j])
+			}
+			return ranked, nil
+		}
+		if !noMatch(err) {
+			p.resolved = -1
+			return nil, err
+		}
+		errs = append(errs, err.Error())
+	}
+	p.resolved = -1
+	return nil, fmt.Errorf("no policy in the chain determined a latest version: %s", strings.Join(errs, "; "))
+}
+
+// Skipped returns the number of values skipped by the policy that determined
+// the result of the last evaluation
+func (p *Chain) Skipped() int {
+	if p.resolved < 0 || p.resolved >= len(p.Policies) {
+		return 0
+	}
+	if sc, ok := p.Policies[p.resolved].(SkipCounter); ok {
+		return sc.Skipped()
+	}
+	return 0
+}
+
+// Filter returns the tag filter of the policy at the given index, nil if
+// none.
+func (p *Chain) Filter(i int) *RegexFilter {
+	if i < 0 || i >= len(p.Filters) {
+		return nil
+	}
+	return p.Filters[i]
+}
+
+// filter applies the tag filter of the policy at the given index to the
+// versions, and returns the filtered values along with the function returning
+// the original tag of a value.
+func (p *Chain) filter(i int, versions []string) ([]string, func(string) string) {
+	f := p.Filter(i)
+	if f == nil {
+		return versions, func(v string) string { return v }
+	}
+	f.Apply(versions)
+	return f.Items(), f.GetOriginalTag
+}
+
+// noMatch returns true if the given error of a policy means that none of the
+// versions was accepted, for the next policy of the chain to be evaluated.
+func noMatch(err error) bool {
+	return errors.Is(err, ErrNoLatestVersion) || errors.Is(err, ErrEmptyVersionList)
+}
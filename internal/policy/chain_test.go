@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewChain(t *testing.T) {
+	if _, err := NewChain(); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+	if _, err := NewChain(&Numerical{Order: NumericalOrderAsc}); err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+}
+
+func TestChain_LatestWithIndex(t *testing.T) {
+	semver, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		label           string
+		versions        []string
+		expectedVersion string
+		expectedIndex   int
+		expectErr       bool
+	}{
+		{
+			label:           "With result from primary policy",
+			versions:        []string{"1.0.0", "1.1.0", "0.9.0"},
+			expectedVersion: "1.1.0",
+			expectedIndex:   0,
+		},
+		{
+			label:           "With result from fallback policy",
+			versions:        []string{"100", "102", "101"},
+			expectedVersion: "102",
+			expectedIndex:   1,
+		},
+		{
+			label:         "With no policy yielding a result",
+			versions:      []string{"0.1.0", "latest"},
+			expectedIndex: -1,
+			expectErr:     true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			chain, err := NewChain(semver, numerical)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			latest, idx, err := chain.LatestWithIndex(tt.versions)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if latest != tt.expectedVersion {
+				t.Errorf("incorrect computed version returned, got '%s', expected '%s'", latest, tt.expectedVersion)
+			}
+			if idx != tt.expectedIndex {
+				t.Errorf("incorrect policy index returned, got %d, expected %d", idx, tt.expectedIndex)
+			}
+		})
+	}
+}
+
+func TestChain_Rank(t *testing.T) {
+	semver, err := NewSemVer("~1.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	chain, err := NewChain(semver, numerical)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	ranked, err := chain.Rank([]string{"100", "101", "99"})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	expected := []string{"101", "100", "99"}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, expected)
+	}
+
+	if _, err := chain.Rank([]string{"latest"}); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+}
+
+func TestChain_FallbackOnNoMatchOnly(t *testing.T) {
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	semver, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	chain, err := NewChain(numerical, semver)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	// The numerical policy fails to parse the version rather than accepting
+	// none, the fallback policy isn't evaluated.
+	if _, idx, err := chain.LatestWithIndex([]string{"1.0.0"}); err == nil || idx != -1 {
+		t.Fatalf("expecting error from the primary policy, got index %d and error %v", idx, err)
+	}
+	if _, err := chain.Rank([]string{"1.0.0"}); err == nil {
+		t.Fatalf("expecting error from the primary policy, got nil")
+	}
+}
+
+func TestChain_Filters(t *testing.T) {
+	semver, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	semverFilter, err := NewRegexFilter(`^v(?P<v>.*)$`, "$v")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numericalFilter, err := NewRegexFilter(`^main-(?P<ts>\d+)$`, "$ts")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	chain, err := NewChain(semver, numerical)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	chain.Filters = []*RegexFilter{semverFilter, numericalFilter}
+
+	latest, idx, err := chain.LatestWithIndex([]string{"main-9", "v0.9.0", "main-10"})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	if latest != "main-10" || idx != 1 {
+		t.Errorf("incorrect result returned, got '%s' at index %d, expected 'main-10' at index 1", latest, idx)
+	}
+
+	ranked, err := chain.Rank([]string{"main-9", "v1.0.0", "v1.2.0"})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	expected := []string{"v1.2.0", "v1.0.0"}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, expected)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/fluxcd/pkg/version"
+)
+
+const (
+	// SortKeyNumerical compares the values of a key numerically
+	SortKeyNumerical = "numerical"
+	// SortKeySemVer compares the values of a key as semantic versions
+	SortKeySemVer = "semver"
+	// SortKeyAlphabetical compares the values of a key alphabetically
+	SortKeyAlphabetical = "alphabetical"
+	// SortKeyTimestamp compares the values of a key as timestamps
+	SortKeyTimestamp = "timestamp"
+
+	// SortKeyOrderAsc ascending order
+	SortKeyOrderAsc = "ASC"
+	// SortKeyOrderDesc descending order
+	SortKeyOrderDesc = "DESC"
+)
+
+// SortKey represents a single key of a Composite ordering policy
+type SortKey struct {
+	// Group is the name of the capture group the key value is read from
+	Group string
+	// Type is the type used to compare the key values
+	Type string
+	// Order is the sorting order of the key values
+	Order string
+	// Layout is the time layout used to parse timestamp key values
+	Layout string
+}
+
+// Composite represents an ordering policy over multiple keys extracted from
+// the named capture groups of a regular expression. The keys are compared in
+// order, the first key that differs decides the ordering of two tags.
+type Composite struct {
+	Regexp *regexp.Regexp
+	Keys   []SortKey
+
+	groups []int
+}
+
+// NewComposite constructs a Composite object validating the provided pattern
+// and sort keys
+func NewComposite(pattern string, keys []SortKey) (*Composite, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern argument cannot be empty")
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("sort keys argument cannot be empty")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression pattern '%s': %w", pattern, err)
+	}
+
+	p := &Composite{
+		Regexp: re,
+		Keys:   make([]SortKey, len(keys)),
+		groups: make([]int, len(keys)),
+	}
+	for i, key := range keys {
+		idx := re.SubexpIndex(key.Group)
+		if key.Group == "" || idx < 0 {
+			return nil, fmt.Errorf("capture group '%s' not found in pattern '%s'", key.Group, pattern)
+		}
+
+		switch key.Type {
+		case "":
+			key.Type = SortKeyNumerical
+		case SortKeyNumerical, SortKeySemVer, SortKeyAlphabetical, SortKeyTimestamp:
+			break
+		default:
+			return nil, fmt.Errorf("invalid type provided for key '%s': '%s', must be one of: %s",
+				key.Group, key.Type, strings.Join([]string{SortKeyNumerical, SortKeySemVer, SortKeyAlphabetical, SortKeyTimestamp}, ", "))
+		}
+
+		switch key.Order {
+		case "":
+			key.Order = SortKeyOrderAsc
+		case SortKeyOrderAsc, SortKeyOrderDesc:
+			break
+		default:
+			return nil, fmt.Errorf("invalid order provided for key '%s': '%s', must be one of: %s, %s",
+				key.Group, key.Order, SortKeyOrderAsc, SortKeyOrderDesc)
+		}
+
+		if key.Type == SortKeyTimestamp && key.Layout == "" {
+			key.Layout = time.RFC3339
+		}
+
+		p.Keys[i] = key
+		p.groups[i] = idx
+	}
+	return p, nil
+}
+
+// compositeEntry holds a tag along with its parsed key values, nil for the
+// keys of which the capture group is empty, e.g. optional.
+type compositeEntry struct {
+	tag    string
+	values []interface{}
+}
+
+// Latest returns latest version from a provided list of strings
+func (p *Composite) Latest(versions []string) (string, error) {
+	if len(versions) == 0 {
+		return "", ErrEmptyVersionList
+	}
+
+	var latest *compositeEntry
+	for _, tag := range versions {
+		e, err := p.parse(tag)
+		if err != nil {
+			return "", err
+		}
+		if latest == nil || p.compare(e, latest) > 0 {
+			latest = e
+		}
+	}
+	return latest.tag, nil
+}
+
+// Rank returns the provided list of strings ordered from the latest
+func (p *Composite) Rank(versions []string) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, ErrEmptyVersionList
+	}
+
+	entries := make([]*compositeEntry, len(versions))
+	for i, tag := range versions {
+		e, err := p.parse(tag)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = e
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return p.compare(entries[i], entries[j]) > 0
+	})
+	ranked := make([]string, len(entries))
+	for i, e := range entries {
+		ranked[i] = e.tag
+	}
+	return ranked, nil
+}
+
+// parse extracts and parses the key values of the given tag.
+func (p *Composite) parse(tag string) (*compositeEntry, error) {
+	match := p.Regexp.FindStringSubmatch(tag)
+	if match == nil {
+		return nil, fmt.Errorf("tag '%s' does not match pattern '%s'", tag, p.Regexp.String())
+	}
+
+	e := &compositeEntry{
+		tag:    tag,
+		values: make([]interface{}, len(p.Keys)),
+	}
+	for i, key := range p.Keys {
+		raw := match[p.groups[i]]
+		if raw == "" {
+			continue
+		}
+		switch key.Type {
+		case SortKeyNumerical:
+			v, err := parseNumber(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse invalid numeric value '%s' of key '%s' in tag '%s'", raw, key.Group, tag)
+			}
+			e.values[i] = v
+		case SortKeySemVer:
+			v, err := version.ParseVersion(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse invalid semver value '%s' of key '%s' in tag '%s'", raw, key.Group, tag)
+			}
+			e.values[i] = v
+		case SortKeyTimestamp:
+			v, err := time.Parse(key.Layout, raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse invalid timestamp value '%s' of key '%s' in tag '%s'", raw, key.Group, tag)
+			}
+			e.values[i] = v
+		default:
+			e.values[i] = raw
+		}
+	}
+	return e, nil
+}
+
+// compare returns a positive number if a orders after b, a negative number if
+// a orders before b and zero if both are equal. Tags without a value for a key
+// order before the others in either order, and tags with equal keys are
+// ordered alphabetically to keep the result deterministic.
+func (p *Composite) compare(a, b *compositeEntry) int {
+	for i, key := range p.Keys {
+		if a.values[i] == nil || b.values[i] == nil {
+			switch {
+			case a.values[i] != nil:
+				return 1
+			case b.values[i] != nil:
+				return -1
+			}
+			continue
+		}
+		var c int
+		switch av := a.values[i].(type) {
+		case *big.Float:
+			c = av.Cmp(b.values[i].(*big.Float))
+		case *semver.Version:
+			c = av.Compare(b.values[i].(*semver.Version))
+		case time.Time:
+			c = av.Compare(b.values[i].(time.Time))
+		case string:
+			c = strings.Compare(av, b.values[i].(string))
+		}
+		if key.Order == SortKeyOrderDesc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.tag, b.tag)
+}
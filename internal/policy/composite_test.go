@@ -0,0 +1,219 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+const releaseBuildPattern = `^release-(?P<major>\d+)-build-(?P<build>\d+)$`
+
+func TestNewComposite(t *testing.T) {
+	cases := []struct {
+		label     string
+		pattern   string
+		keys      []SortKey
+		expectErr bool
+	}{
+		{
+			label:   "With valid keys",
+			pattern: releaseBuildPattern,
+			keys:    []SortKey{{Group: "major"}, {Group: "build", Type: SortKeyNumerical, Order: SortKeyOrderDesc}},
+		},
+		{
+			label:     "With empty pattern",
+			keys:      []SortKey{{Group: "major"}},
+			expectErr: true,
+		},
+		{
+			label:     "With invalid pattern",
+			pattern:   `release-(?P<major>\d+`,
+			keys:      []SortKey{{Group: "major"}},
+			expectErr: true,
+		},
+		{
+			label:     "With no keys",
+			pattern:   releaseBuildPattern,
+			expectErr: true,
+		},
+		{
+			label:     "With unknown group",
+			pattern:   releaseBuildPattern,
+			keys:      []SortKey{{Group: "minor"}},
+			expectErr: true,
+		},
+		{
+			label:     "With invalid type",
+			pattern:   releaseBuildPattern,
+			keys:      []SortKey{{Group: "major", Type: "invalid"}},
+			expectErr: true,
+		},
+		{
+			label:     "With invalid order",
+			pattern:   releaseBuildPattern,
+			keys:      []SortKey{{Group: "major", Order: "invalid"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			_, err := NewComposite(tt.pattern, tt.keys)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestComposite_Latest(t *testing.T) {
+	cases := []struct {
+		label           string
+		pattern         string
+		keys            []SortKey
+		versions        []string
+		expectedVersion string
+		expectErr       bool
+	}{
+		{
+			label:           "With numerical keys ascending",
+			pattern:         releaseBuildPattern,
+			keys:            []SortKey{{Group: "major"}, {Group: "build"}},
+			versions:        shuffle([]string{"release-1-build-99", "release-2-build-9", "release-2-build-10", "release-10-build-1", "release-9-build-200"}),
+			expectedVersion: "release-10-build-1",
+		},
+		{
+			label:           "With second key breaking ties",
+			pattern:         releaseBuildPattern,
+			keys:            []SortKey{{Group: "major"}, {Group: "build"}},
+			versions:        shuffle([]string{"release-2-build-9", "release-2-build-10", "release-1-build-99"}),
+			expectedVersion: "release-2-build-10",
+		},
+		{
+			label:           "With mixed key orders",
+			pattern:         releaseBuildPattern,
+			keys:            []SortKey{{Group: "major"}, {Group: "build", Order: SortKeyOrderDesc}},
+			versions:        shuffle([]string{"release-2-build-9", "release-2-build-10", "release-1-build-1"}),
+			expectedVersion: "release-2-build-9",
+		},
+		{
+			label:           "With semver and timestamp keys",
+			pattern:         `^(?P<version>v[0-9.]+)-(?P<ts>\d{8}T\d{6})$`,
+			keys:            []SortKey{{Group: "version", Type: SortKeySemVer}, {Group: "ts", Type: SortKeyTimestamp, Layout: "20060102T150405"}},
+			versions:        shuffle([]string{"v1.9.0-20230102T101010", "v1.10.0-20230101T000000", "v1.10.0-20230101T120000"}),
+			expectedVersion: "v1.10.0-20230101T120000",
+		},
+		{
+			label:           "With alphabetical key",
+			pattern:         `^(?P<name>[a-z]+)-(?P<build>\d+)$`,
+			keys:            []SortKey{{Group: "name", Type: SortKeyAlphabetical}, {Group: "build"}},
+			versions:        shuffle([]string{"bionic-3", "focal-1", "focal-2"}),
+			expectedVersion: "focal-2",
+		},
+		{
+			label:           "With empty optional capture",
+			pattern:         `^release-(?P<major>\d+)(-rc(?P<rc>\d+))?$`,
+			keys:            []SortKey{{Group: "major"}, {Group: "rc"}},
+			versions:        shuffle([]string{"release-1", "release-2-rc1", "release-2-rc2", "release-2"}),
+			expectedVersion: "release-2-rc2",
+		},
+		{
+			label:           "With empty optional capture in descending order",
+			pattern:         `^release-(?P<major>\d+)(-rc(?P<rc>\d+))?$`,
+			keys:            []SortKey{{Group: "major"}, {Group: "rc", Order: SortKeyOrderDesc}},
+			versions:        shuffle([]string{"release-2-rc1", "release-2", "release-2-rc2"}),
+			expectedVersion: "release-2-rc1",
+		},
+		{
+			label:     "With invalid numerical value",
+			pattern:   `^release-(?P<major>\w+)$`,
+			keys:      []SortKey{{Group: "major"}},
+			versions:  []string{"release-1", "release-a"},
+			expectErr: true,
+		},
+		{
+			label:     "With non-matching tag",
+			pattern:   releaseBuildPattern,
+			keys:      []SortKey{{Group: "major"}},
+			versions:  []string{"release-1-build-1", "latest"},
+			expectErr: true,
+		},
+		{
+			label:     "Empty version list",
+			pattern:   releaseBuildPattern,
+			keys:      []SortKey{{Group: "major"}},
+			versions:  []string{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			policy, err := NewComposite(tt.pattern, tt.keys)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			latest, err := policy.Latest(tt.versions)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if latest != tt.expectedVersion {
+				t.Errorf("incorrect computed version returned, got '%s', expected '%s'", latest, tt.expectedVersion)
+			}
+		})
+	}
+}
+
+func TestComposite_Rank(t *testing.T) {
+	policy, err := NewComposite(releaseBuildPattern, []SortKey{{Group: "major"}, {Group: "build"}})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	ranked, err := policy.Rank(shuffle([]string{"release-1-build-99", "release-2-build-9", "release-2-build-10", "release-10-build-1"}))
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	expected := []string{"release-10-build-1", "release-2-build-10", "release-2-build-9", "release-1-build-99"}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, expected)
+	}
+
+	if _, err := policy.Rank([]string{"latest"}); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+
+	// Tags with an empty optional capture rank last.
+	policy, err = NewComposite(`^release-(?P<major>\d+)(-build-(?P<build>\d+))?$`, []SortKey{{Group: "build"}})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	ranked, err = policy.Rank(shuffle([]string{"release-1", "release-1-build-2", "release-2", "release-1-build-10"}))
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	expected = []string{"release-1-build-10", "release-1-build-2", "release-2", "release-1"}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, expected)
+	}
+}
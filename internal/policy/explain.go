@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"sort"
+
+	"github.com/fluxcd/pkg/version"
+)
+
+// Verdict is the outcome of the evaluation of a tag by a policy
+type Verdict string
+
+const (
+	// VerdictSelected is the verdict of the latest tag
+	VerdictSelected Verdict = "Selected"
+	// VerdictOutranked is the verdict of the candidate tags that lost on
+	// ordering to the latest tag
+	VerdictOutranked Verdict = "Outranked"
+	// VerdictOutOfRange is the verdict of the tags that were parsed but
+	// aren't accepted by the policy, e.g. outside of the SemVer range or of
+	// the prerelease channels
+	VerdictOutOfRange Verdict = "OutOfRange"
+	// VerdictUnparsable is the verdict of the tags the policy failed to parse
+	VerdictUnparsable Verdict = "Unparsable"
+	// VerdictFiltered is the verdict of the tags removed by the tag filter
+	VerdictFiltered Verdict = "Filtered"
+)
+
+// TagExplanation is the verdict of a policy on a tag
+type TagExplanation struct {
+	// Tag is the evaluated tag
+	Tag string `json:"tag"`
+	// Value is the value extracted from the tag by the filter, if different
+	// from the tag
+	Value string `json:"value,omitempty"`
+	// Verdict is the outcome of the evaluation of the tag
+	Verdict Verdict `json:"verdict"`
+}
+
+// Explanation records why a policy selected the latest tag over the others
+type Explanation struct {
+	// Counts is the number of tags of each verdict
+	Counts map[Verdict]int `json:"counts"`
+	// Tags is a sample of the verdicts on the tags: the selected tag, the
+	// outranked tags from the highest ranked, then the rejected tags in
+	// alphabetical order
+	Tags []TagExplanation `json:"tags"`
+}
+
+// parser is implemented by the policies that reject the values they fail to
+// parse.
+type parser interface {
+	parses(version string) bool
+}
+
+func (p *SemVer) parses(v string) bool {
+	_, err := version.ParseVersion(v)
+	return err == nil
+}
+
+func (p *Numerical) parses(v string) bool {
+	_, err := parseNumber(v)
+	return err == nil
+}
+
+func (p *Composite) parses(v string) bool {
+	_, err := p.parse(v)
+	return err == nil
+}
+
+// Explain evaluates the given tags with the given policy and optional filter,
+// and records the verdict on each tag. At most sample tags are recorded, all
+// of them when sample isn't positive. For a Chain, the policy that determines
+// the latest version explains the verdicts with its own filter, or the first
+// policy if none does.
+func Explain(p Policer, filter *RegexFilter, tags []string, sample int) *Explanation {
+	if chain, ok := p.(*Chain); ok {
+		i := 0
+		if _, j, err := chain.LatestWithIndex(tags); err == nil {
+			i = j
+		}
+		p, filter = chain.Policies[i], chain.Filter(i)
+	}
+
+	var rejected []TagExplanation
+	var values []string
+	originals := map[string][]string{}
+	for _, tag := range tags {
+		value := tag
+		if filter != nil {
+			v, ok := filter.Value(tag)
+			if !ok {
+				rejected = append(rejected, TagExplanation{Tag: tag, Verdict: VerdictFiltered})
+				continue
+			}
+			value = v
+		}
+		if _, err := p.Rank([]string{value}); err != nil {
+			verdict := VerdictOutOfRange
+			if ps, ok := p.(parser); ok && !ps.parses(value) {
+				verdict = VerdictUnparsable
+			}
+			rejected = append(rejected, newTagExplanation(tag, value, verdict))
+			continue
+		}
+		if _, ok := originals[value]; !ok {
+			values = append(values, value)
+		}
+		originals[value] = append(originals[value], tag)
+	}
+	sort.SliceStable(rejected, func(i, j int) bool {
+		return rejected[i].Tag < rejected[j].Tag
+	})
+
+	// Rank the candidates, the first one being the latest. Like the tag
+	// filter, the last of the tags with the same value represents them, and
+	// the others lose to it.
+	var ranked []TagExplanation
+	if len(values) > 0 {
+		order, err := p.Rank(values)
+		if err == nil {
+			for i, v := range order {
+				verdict := VerdictOutranked
+				if i == 0 {
+					verdict = VerdictSelected
+				}
+				tags := originals[v]
+				ranked = append(ranked, newTagExplanation(tags[len(tags)-1], v, verdict))
+				for _, tag := range tags[:len(tags)-1] {
+					ranked = append(ranked, newTagExplanation(tag, v, VerdictOutranked))
+				}
+			}
+		}
+	}
+
+	explanation := &Explanation{Counts: map[Verdict]int{}}
+	for _, e := range append(ranked, rejected...) {
+		explanation.Counts[e.Verdict]++
+		if sample <= 0 || len(explanation.Tags) < sample {
+			explanation.Tags = append(explanation.Tags, e)
+		}
+	}
+	return explanation
+}
+
+// newTagExplanation constructs a TagExplanation, recording the value only if
+// it differs from the tag.
+func newTagExplanation(tag, value string, verdict Verdict) TagExplanation {
+	e := TagExplanation{Tag: tag, Verdict: verdict}
+	if value != tag {
+		e.Value = value
+	}
+	return e
+}
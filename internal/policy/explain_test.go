@@ -0,0 +1,127 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	semver, err := NewSemVer("1.x")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	chain, err := NewChain(semver, numerical)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		label          string
+		policy         Policer
+		pattern        string
+		extract        string
+		tags           []string
+		sample         int
+		expectedCounts map[Verdict]int
+		expectedTags   []TagExplanation
+	}{
+		{
+			label:  "With SemVer policy",
+			policy: semver,
+			tags:   []string{"1.0.0", "latest", "2.0.0", "1.2.0"},
+			expectedCounts: map[Verdict]int{
+				VerdictSelected:   1,
+				VerdictOutranked:  1,
+				VerdictOutOfRange: 1,
+				VerdictUnparsable: 1,
+			},
+			expectedTags: []TagExplanation{
+				{Tag: "1.2.0", Verdict: VerdictSelected},
+				{Tag: "1.0.0", Verdict: VerdictOutranked},
+				{Tag: "2.0.0", Verdict: VerdictOutOfRange},
+				{Tag: "latest", Verdict: VerdictUnparsable},
+			},
+		},
+		{
+			label:   "With tag filter and sample",
+			policy:  numerical,
+			pattern: `^main-(?P<ts>\d+)$`,
+			extract: "$ts",
+			tags:    []string{"main-1", "dev-5", "main-3", "main-2"},
+			sample:  2,
+			expectedCounts: map[Verdict]int{
+				VerdictSelected:  1,
+				VerdictOutranked: 2,
+				VerdictFiltered:  1,
+			},
+			expectedTags: []TagExplanation{
+				{Tag: "main-3", Value: "3", Verdict: VerdictSelected},
+				{Tag: "main-2", Value: "2", Verdict: VerdictOutranked},
+			},
+		},
+		{
+			label:  "With no candidates",
+			policy: numerical,
+			tags:   []string{"latest", "main"},
+			expectedCounts: map[Verdict]int{
+				VerdictUnparsable: 2,
+			},
+			expectedTags: []TagExplanation{
+				{Tag: "latest", Verdict: VerdictUnparsable},
+				{Tag: "main", Verdict: VerdictUnparsable},
+			},
+		},
+		{
+			label:  "With chain resolved by fallback",
+			policy: chain,
+			tags:   []string{"100", "99"},
+			expectedCounts: map[Verdict]int{
+				VerdictSelected:  1,
+				VerdictOutranked: 1,
+			},
+			expectedTags: []TagExplanation{
+				{Tag: "100", Verdict: VerdictSelected},
+				{Tag: "99", Verdict: VerdictOutranked},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			var filter *RegexFilter
+			if tt.pattern != "" {
+				filter, err = NewRegexFilter(tt.pattern, tt.extract)
+				if err != nil {
+					t.Fatalf("returned unexpected error: %s", err)
+				}
+			}
+			e := Explain(tt.policy, filter, tt.tags, tt.sample)
+			if !reflect.DeepEqual(e.Counts, tt.expectedCounts) {
+				t.Errorf("incorrect counts returned, got '%v', expected '%v'", e.Counts, tt.expectedCounts)
+			}
+			if !reflect.DeepEqual(e.Tags, tt.expectedTags) {
+				t.Errorf("incorrect tags returned, got '%v', expected '%v'", e.Tags, tt.expectedTags)
+			}
+		})
+	}
+}
@@ -23,17 +23,25 @@ import (
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
 )
 
-// PolicerFromSpec constructs a new policy object based on
-func PolicerFromSpec(choice imagev1.ImagePolicyChoice) (Policer, error) {
+// PolicerFromSpec constructs a new policy object based on the given policy
+// choice. The tag filter is optional, it's used by the policies that read
+// values from the capture groups of the filter pattern.
+//
+// When the policy choice has fallback policies, the returned Chain applies
+// the tag filter, or the filter of the fallback policy, itself: it's
+// evaluated on the unfiltered tags.
+func PolicerFromSpec(choice imagev1.ImagePolicyChoice, filter *imagev1.TagFilter) (Policer, error) {
 	var p Policer
 	var err error
 	switch {
 	case choice.SemVer != nil:
-		p, err = NewSemVer(choice.SemVer.Range)
+		p, err = semverFromSpec(choice.SemVer)
 	case choice.Alphabetical != nil:
 		p, err = NewAlphabetical(strings.ToUpper(choice.Alphabetical.Order))
 	case choice.Numerical != nil:
-		p, err = NewNumerical(strings.ToUpper(choice.Numerical.Order))
+		p, err = numericalFromSpec(choice.Numerical)
+	case choice.Composite != nil:
+		p, err = compositeFromSpec(choice.Composite, filter)
 	default:
 		return nil, fmt.Errorf("given ImagePolicyChoice object is invalid")
 	}
@@ -41,5 +49,189 @@ func PolicerFromSpec(choice imagev1.ImagePolicyChoice) (Policer, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if len(choice.Fallback) == 0 {
+		return p, nil
+	}
+	pf, err := filterFromSpec(filter)
+	if err != nil {
+		return nil, err
+	}
+	policies := []Policer{p}
+	filters := []*RegexFilter{pf}
+	for i, f := range choice.Fallback {
+		ff := filter
+		if f.FilterTags != nil {
+			ff = f.FilterTags
+		}
+		fp, err := PolicerFromSpec(imagev1.ImagePolicyChoice{
+			SemVer:       f.SemVer,
+			Alphabetical: f.Alphabetical,
+			Numerical:    f.Numerical,
+			Composite:    f.Composite,
+		}, ff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback policy at index %d: %w", i, err)
+		}
+		rf, err := filterFromSpec(ff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback policy at index %d: %w", i, err)
+		}
+		policies = append(policies, fp)
+		filters = append(filters, rf)
+	}
+	chain, err := NewChain(policies...)
+	if err != nil {
+		return nil, err
+	}
+	chain.Filters = filters
+	return chain, nil
+}
+
+// filterFromSpec constructs the RegexFilter of the given tag filter, nil if
+// none.
+func filterFromSpec(filter *imagev1.TagFilter) (*RegexFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	return NewRegexFilter(filter.Pattern, filter.Extract)
+}
+
+// GroupingFromSpec constructs the policy and the Grouper computing the latest
+// tag of each group of tags, as specified by the GroupBy of the given policy
+// choice. It returns a nil Grouper if the policy doesn't group the tags. The
+// fallback policies don't apply to the groups.
+func GroupingFromSpec(choice imagev1.ImagePolicyChoice, filter *imagev1.TagFilter) (Policer, Grouper, error) {
+	for i, f := range choice.Fallback {
+		if (f.SemVer != nil && f.SemVer.GroupBy != nil) || (f.Numerical != nil && f.Numerical.GroupBy != nil) {
+			return nil, nil, fmt.Errorf("invalid fallback policy at index %d: groupBy is only supported by the primary policy", i)
+		}
+	}
+
+	var groupBy *imagev1.GroupBy
+	switch {
+	case choice.SemVer != nil:
+		groupBy = choice.SemVer.GroupBy
+	case choice.Numerical != nil:
+		groupBy = choice.Numerical.GroupBy
+	}
+	if groupBy == nil {
+		return nil, nil, nil
+	}
+
+	var grouper Grouper
+	var err error
+	switch {
+	case groupBy.Version != "" && groupBy.CaptureGroup != "":
+		return nil, nil, fmt.Errorf("groupBy must specify only one of version and captureGroup")
+	case groupBy.Version != "":
+		if choice.SemVer == nil {
+			return nil, nil, fmt.Errorf("groupBy version is only supported by the semver policy")
+		}
+		grouper, err = NewVersionGrouper(groupBy.Version)
+	case groupBy.CaptureGroup != "":
+		if filter == nil || filter.Pattern == "" {
+			return nil, nil, fmt.Errorf("groupBy captureGroup requires a tag filter pattern with named capture groups")
+		}
+		grouper, err = NewCaptureGroupGrouper(filter.Pattern, groupBy.CaptureGroup)
+	default:
+		return nil, nil, fmt.Errorf("groupBy must specify one of version and captureGroup")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := PolicerFromSpec(imagev1.ImagePolicyChoice{
+		SemVer:    choice.SemVer,
+		Numerical: choice.Numerical,
+	}, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, grouper, nil
+}
+
+// PolicerFromLatestTagsOrder constructs the policy ranking the latest tags of
+// an ImageRepository in the given order. The alphabetical, semver, numerical
+// and natural orders are supported.
+func PolicerFromLatestTagsOrder(order string) (Policer, error) {
+	switch order {
+	case imagev1.LatestTagsOrderAlphabetical:
+		return NewAlphabetical(AlphabeticalOrderAsc)
+	case imagev1.LatestTagsOrderSemVer:
+		// Include the prerelease versions.
+		return NewSemVer(">=0.0.0-0")
+	case imagev1.LatestTagsOrderNumerical:
+		p, err := NewNumerical(NumericalOrderAsc)
+		if err != nil {
+			return nil, err
+		}
+		p.SkipUnparsable = true
+		return p, nil
+	case imagev1.LatestTagsOrderNatural:
+		return NewNatural(NaturalOrderAsc)
+	default:
+		return nil, fmt.Errorf("unsupported latest tags order '%s'", order)
+	}
+}
+
+// semverFromSpec constructs a SemVer policy from the given spec.
+func semverFromSpec(spec *imagev1.SemVerPolicy) (*SemVer, error) {
+	r := spec.Range
+	if r == "" && spec.Relative != nil {
+		// Without a range, the first latest image would be the latest
+		// version of any major version.
+		if spec.Relative.Baseline == "" {
+			return nil, fmt.Errorf("relative semver policy requires a range or a baseline")
+		}
+		r = "*"
+	}
+	p, err := NewSemVer(r)
+	if err != nil {
+		return nil, err
+	}
+	// Without a baseline, e.g. before the first latest image is selected,
+	// only the range applies.
+	if spec.Relative != nil && spec.Relative.Baseline != "" {
+		if err := p.SetRelative(spec.Relative.Updates, spec.Relative.Baseline); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Prerelease != nil {
+		if err := p.SetChannels(spec.Prerelease.Channels, spec.Prerelease.IncludeStable); err != nil {
+			return nil, err
+		}
+	}
 	return p, nil
 }
+
+// numericalFromSpec constructs a Numerical policy from the given spec.
+func numericalFromSpec(spec *imagev1.NumericalPolicy) (*Numerical, error) {
+	p, err := NewNumerical(strings.ToUpper(spec.Order))
+	if err != nil {
+		return nil, err
+	}
+	p.SkipUnparsable = spec.SkipUnparsable
+	return p, nil
+}
+
+// compositeFromSpec constructs a Composite policy reading the sort keys from
+// the capture groups of the given tag filter pattern.
+func compositeFromSpec(spec *imagev1.CompositePolicy, filter *imagev1.TagFilter) (*Composite, error) {
+	if filter == nil || filter.Pattern == "" {
+		return nil, fmt.Errorf("composite policy requires a tag filter pattern with named capture groups")
+	}
+	if filter.Extract != "" {
+		return nil, fmt.Errorf("composite policy can't be used with a tag filter extract")
+	}
+	keys := make([]SortKey, len(spec.Keys))
+	for i, k := range spec.Keys {
+		keys[i] = SortKey{
+			Group:  k.Group,
+			Type:   k.Type,
+			Order:  strings.ToUpper(k.Order),
+			Layout: k.Layout,
+		}
+	}
+	return NewComposite(filter.Pattern, keys)
+}
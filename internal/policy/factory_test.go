@@ -24,29 +24,212 @@ import (
 
 func TestFactory_PolicerFromSpec(t *testing.T) {
 	// With invalid ImagePolicyChoice
-	_, err := PolicerFromSpec(imagev1.ImagePolicyChoice{})
+	_, err := PolicerFromSpec(imagev1.ImagePolicyChoice{}, nil)
 	if err == nil {
 		t.Error("expected error, got nil")
 	}
 
 	// With SemVerPolicy
-	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.0.x"}})
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.0.x"}}, nil)
 	if err != nil {
 		t.Error("should not return error")
 	}
 
 	// With AlphabeticalPolicy
-	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{Alphabetical: &imagev1.AlphabeticalPolicy{}})
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{Alphabetical: &imagev1.AlphabeticalPolicy{}}, nil)
 	if err != nil {
 		t.Error("should not return error")
 	}
 
 	// A nil checkable Policer for invalid policy.
-	p, err := PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "*-*"}})
+	p, err := PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "*-*"}}, nil)
 	if err == nil {
 		t.Error("should return error")
 	}
 	if p != nil {
 		t.Error("should be nil")
 	}
+
+	// With relative SemVerPolicy without range
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Relative: &imagev1.SemVerRelative{Updates: "patch", Baseline: "1.0.0"},
+	}}, nil)
+	if err != nil {
+		t.Error("should not return error")
+	}
+
+	// With relative SemVerPolicy without range nor baseline
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Relative: &imagev1.SemVerRelative{Updates: "patch"},
+	}}, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With relative SemVerPolicy and invalid baseline
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Relative: &imagev1.SemVerRelative{Updates: "patch", Baseline: "latest"},
+	}}, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With fallback policies
+	p, err = PolicerFromSpec(imagev1.ImagePolicyChoice{
+		SemVer:   &imagev1.SemVerPolicy{Range: "1.0.x"},
+		Fallback: []imagev1.ImagePolicyFallback{{Numerical: &imagev1.NumericalPolicy{}}},
+	}, nil)
+	if err != nil {
+		t.Error("should not return error")
+	}
+	if _, ok := p.(*Chain); !ok {
+		t.Error("should be a Chain")
+	}
+
+	// With fallback policy switching the tag scheme
+	p, err = PolicerFromSpec(imagev1.ImagePolicyChoice{
+		SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+		Fallback: []imagev1.ImagePolicyFallback{{
+			Numerical:  &imagev1.NumericalPolicy{},
+			FilterTags: &imagev1.TagFilter{Pattern: `^main-(?P<ts>\d+)$`, Extract: "$ts"},
+		}},
+	}, &imagev1.TagFilter{Pattern: `^v(?P<v>.*)$`, Extract: "$v"})
+	if err != nil {
+		t.Errorf("should not return error: %s", err)
+	}
+	if latest, err := p.Latest([]string{"main-3", "v0.1.0", "main-12"}); err != nil || latest != "main-12" {
+		t.Errorf("incorrect latest version returned, got '%s' (%v), expected 'main-12'", latest, err)
+	}
+	if latest, err := p.Latest([]string{"main-3", "v1.1.0", "v1.0.0"}); err != nil || latest != "v1.1.0" {
+		t.Errorf("incorrect latest version returned, got '%s' (%v), expected 'v1.1.0'", latest, err)
+	}
+
+	// With invalid fallback tag filter
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{
+		SemVer: &imagev1.SemVerPolicy{Range: "1.0.x"},
+		Fallback: []imagev1.ImagePolicyFallback{{
+			Numerical:  &imagev1.NumericalPolicy{},
+			FilterTags: &imagev1.TagFilter{Pattern: `(`},
+		}},
+	}, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With invalid fallback policy
+	_, err = PolicerFromSpec(imagev1.ImagePolicyChoice{
+		SemVer:   &imagev1.SemVerPolicy{Range: "1.0.x"},
+		Fallback: []imagev1.ImagePolicyFallback{{}},
+	}, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With CompositePolicy
+	composite := imagev1.ImagePolicyChoice{Composite: &imagev1.CompositePolicy{
+		Keys: []imagev1.SortKey{{Group: "major"}, {Group: "build", Order: "desc"}},
+	}}
+	_, err = PolicerFromSpec(composite, &imagev1.TagFilter{Pattern: `^release-(?P<major>\d+)-build-(?P<build>\d+)$`})
+	if err != nil {
+		t.Errorf("should not return error: %s", err)
+	}
+
+	// With CompositePolicy without a tag filter pattern
+	_, err = PolicerFromSpec(composite, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With CompositePolicy and a tag filter extract
+	_, err = PolicerFromSpec(composite, &imagev1.TagFilter{Pattern: `^release-(?P<major>\d+)-build-(?P<build>\d+)$`, Extract: "$major"})
+	if err == nil {
+		t.Error("should return error")
+	}
+}
+
+func TestFactory_GroupingFromSpec(t *testing.T) {
+	filter := &imagev1.TagFilter{Pattern: `^(?P<train>[a-z]+)-(?P<ts>\d+)$`, Extract: "$ts"}
+
+	// Without grouping
+	p, g, err := GroupingFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{Range: "1.0.x"}}, nil)
+	if err != nil {
+		t.Errorf("should not return error: %s", err)
+	}
+	if p != nil || g != nil {
+		t.Error("should be nil")
+	}
+
+	// With SemVerPolicy grouped by major version
+	p, g, err = GroupingFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Range:   ">=1.0.0",
+		GroupBy: &imagev1.GroupBy{Version: "major"},
+	}}, nil)
+	if err != nil {
+		t.Errorf("should not return error: %s", err)
+	}
+	if p == nil || g == nil {
+		t.Error("should not be nil")
+	}
+
+	// With NumericalPolicy grouped by capture group
+	_, _, err = GroupingFromSpec(imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+		GroupBy: &imagev1.GroupBy{CaptureGroup: "train"},
+	}}, filter)
+	if err != nil {
+		t.Errorf("should not return error: %s", err)
+	}
+
+	// With NumericalPolicy grouped by version
+	_, _, err = GroupingFromSpec(imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+		GroupBy: &imagev1.GroupBy{Version: "major"},
+	}}, filter)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With capture group grouping without a tag filter pattern
+	_, _, err = GroupingFromSpec(imagev1.ImagePolicyChoice{Numerical: &imagev1.NumericalPolicy{
+		GroupBy: &imagev1.GroupBy{CaptureGroup: "train"},
+	}}, nil)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With both version and capture group
+	_, _, err = GroupingFromSpec(imagev1.ImagePolicyChoice{SemVer: &imagev1.SemVerPolicy{
+		Range:   ">=1.0.0",
+		GroupBy: &imagev1.GroupBy{Version: "major", CaptureGroup: "train"},
+	}}, filter)
+	if err == nil {
+		t.Error("should return error")
+	}
+
+	// With grouping in a fallback policy
+	_, _, err = GroupingFromSpec(imagev1.ImagePolicyChoice{
+		SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+		Fallback: []imagev1.ImagePolicyFallback{{Numerical: &imagev1.NumericalPolicy{
+			GroupBy: &imagev1.GroupBy{CaptureGroup: "train"},
+		}}},
+	}, filter)
+	if err == nil {
+		t.Error("should return error")
+	}
+}
+
+func TestFactory_PolicerFromLatestTagsOrder(t *testing.T) {
+	for _, order := range []string{
+		imagev1.LatestTagsOrderAlphabetical,
+		imagev1.LatestTagsOrderSemVer,
+		imagev1.LatestTagsOrderNumerical,
+		imagev1.LatestTagsOrderNatural,
+	} {
+		if _, err := PolicerFromLatestTagsOrder(order); err != nil {
+			t.Errorf("should not return error for order '%s': %s", order, err)
+		}
+	}
+
+	// The first-seen order isn't based on a policy.
+	if _, err := PolicerFromLatestTagsOrder(imagev1.LatestTagsOrderFirstSeen); err == nil {
+		t.Error("should return error")
+	}
 }
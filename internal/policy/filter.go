@@ -45,18 +45,27 @@ func NewRegexFilter(pattern string, replace string) (*RegexFilter, error) {
 func (f *RegexFilter) Apply(list []string) {
 	f.filtered = map[string]string{}
 	for _, item := range list {
-		if submatches := f.Regexp.FindStringSubmatchIndex(item); len(submatches) > 0 {
-			tag := item
-			if f.Replace != "" {
-				result := []byte{}
-				result = f.Regexp.ExpandString(result, f.Replace, item, submatches)
-				tag = string(result)
-			}
+		if tag, ok := f.Value(item); ok {
 			f.filtered[tag] = item
 		}
 	}
 }
 
+// Value returns the value of the given tag after replace extraction, and false
+// if the tag doesn't match the filter
+func (f *RegexFilter) Value(item string) (string, bool) {
+	submatches := f.Regexp.FindStringSubmatchIndex(item)
+	if len(submatches) == 0 {
+		return "", false
+	}
+	if f.Replace == "" {
+		return item, true
+	}
+	result := []byte{}
+	result = f.Regexp.ExpandString(result, f.Replace, item, submatches)
+	return string(result), true
+}
+
 // Items returns the list of filtered tags
 func (f *RegexFilter) Items() []string {
 	var filtered []string
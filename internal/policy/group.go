@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/fluxcd/pkg/version"
+)
+
+const (
+	// GroupByMajor groups the versions by their major version
+	GroupByMajor = "major"
+	// GroupByMinor groups the versions by their major and minor versions
+	GroupByMinor = "minor"
+)
+
+// Grouper returns the group of the given tag, given along with its value
+// extracted by the tag filter, and false if the tag doesn't belong to any group
+type Grouper func(tag, value string) (string, bool)
+
+// NewVersionGrouper constructs a Grouper grouping the SemVer versions by their
+// major or minor version, e.g. `1` or `1.4` for `1.4.2`. The versions are
+// parsed from the values of the tags, like the SemVer policy does
+func NewVersionGrouper(by string) (Grouper, error) {
+	if by != GroupByMajor && by != GroupByMinor {
+		return nil, fmt.Errorf("invalid version grouping '%s', must be one of '%s', '%s'",
+			by, GroupByMajor, GroupByMinor)
+	}
+	return func(_, value string) (string, bool) {
+		v, err := version.ParseVersion(value)
+		if err != nil {
+			return "", false
+		}
+		if by == GroupByMajor {
+			return fmt.Sprintf("%d", v.Major()), true
+		}
+		return fmt.Sprintf("%d.%d", v.Major(), v.Minor()), true
+	}, nil
+}
+
+// NewCaptureGroupGrouper constructs a Grouper grouping the tags by the value
+// of the named capture group of the given pattern, matched against the
+// original tags
+func NewCaptureGroupGrouper(pattern, group string) (Grouper, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression pattern '%s': %w", pattern, err)
+	}
+	i := re.SubexpIndex(group)
+	if i < 0 {
+		return nil, fmt.Errorf("capture group '%s' not found in pattern '%s'", group, pattern)
+	}
+	return func(tag, _ string) (string, bool) {
+		m := re.FindStringSubmatch(tag)
+		if m == nil || m[i] == "" {
+			return "", false
+		}
+		return m[i], true
+	}, nil
+}
+
+// LatestPerGroup returns the latest value of each group of the given values
+// extracted by the tag filter, as determined by the given policy. The original
+// function returns the original tag of a value. The groups for which the
+// policy can't determine a latest value are omitted.
+func LatestPerGroup(p Policer, values []string, original func(string) string, grouper Grouper) map[string]string {
+	groups := map[string][]string{}
+	for _, value := range values {
+		if g, ok := grouper(original(value), value); ok {
+			groups[g] = append(groups[g], value)
+		}
+	}
+	latest := make(map[string]string, len(groups))
+	for g, groupTags := range groups {
+		if l, err := p.Latest(groupTags); err == nil {
+			latest[g] = l
+		}
+	}
+	return latest
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLatestPerGroup(t *testing.T) {
+	semver, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	numerical, err := NewNumerical(NumericalOrderAsc)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		label    string
+		policy   Policer
+		grouper  func() (Grouper, error)
+		pattern  string
+		extract  string
+		tags     []string
+		expected map[string]string
+	}{
+		{
+			label:   "By major version",
+			policy:  semver,
+			grouper: func() (Grouper, error) { return NewVersionGrouper(GroupByMajor) },
+			tags:    []string{"1.0.0", "1.4.2", "2.0.0", "v2.1.0", "0.9.0", "latest"},
+			expected: map[string]string{
+				"1": "1.4.2",
+				"2": "v2.1.0",
+			},
+		},
+		{
+			label:   "By minor version",
+			policy:  semver,
+			grouper: func() (Grouper, error) { return NewVersionGrouper(GroupByMinor) },
+			tags:    []string{"1.4.0", "1.4.2", "1.5.0", "2.0.1"},
+			expected: map[string]string{
+				"1.4": "1.4.2",
+				"1.5": "1.5.0",
+				"2.0": "2.0.1",
+			},
+		},
+		{
+			label:  "By capture group",
+			policy: numerical,
+			grouper: func() (Grouper, error) {
+				return NewCaptureGroupGrouper(`^(?P<train>[a-z]+)-(?P<ts>\d+)$`, "train")
+			},
+			pattern: `^(?P<train>[a-z]+)-(?P<ts>\d+)$`,
+			extract: "$ts",
+			tags:    []string{"main-10", "main-9", "stable-3", "stable-12", "other"},
+			expected: map[string]string{
+				"main":   "main-10",
+				"stable": "stable-12",
+			},
+		},
+		{
+			label:   "By major version of extracted values",
+			policy:  semver,
+			grouper: func() (Grouper, error) { return NewVersionGrouper(GroupByMajor) },
+			pattern: `^app-(?P<v>.*)$`,
+			extract: "$v",
+			tags:    []string{"app-1.4.2", "app-1.5.0", "app-2.0.1", "other-3.0.0"},
+			expected: map[string]string{
+				"1": "app-1.5.0",
+				"2": "app-2.0.1",
+			},
+		},
+		{
+			label:    "With no groups",
+			policy:   semver,
+			grouper:  func() (Grouper, error) { return NewVersionGrouper(GroupByMajor) },
+			tags:     []string{"latest"},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			grouper, err := tt.grouper()
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			tags := tt.tags
+			original := func(tag string) string { return tag }
+			if tt.pattern != "" {
+				filter, err := NewRegexFilter(tt.pattern, tt.extract)
+				if err != nil {
+					t.Fatalf("returned unexpected error: %s", err)
+				}
+				filter.Apply(tags)
+				tags = filter.Items()
+				original = filter.GetOriginalTag
+			}
+
+			latest := LatestPerGroup(tt.policy, tags, original, grouper)
+			for g, tag := range latest {
+				latest[g] = original(tag)
+			}
+			if !reflect.DeepEqual(latest, tt.expected) {
+				t.Errorf("incorrect latest tags returned, got '%v', expected '%v'", latest, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewGrouper(t *testing.T) {
+	if _, err := NewVersionGrouper("patch"); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+	if _, err := NewCaptureGroupGrouper(`^(?P<train>[a-z]+)$`, "missing"); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+	if _, err := NewCaptureGroupGrouper(`^(?P<train>[a-z+$`, "train"); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+}
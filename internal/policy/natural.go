@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// NaturalOrderAsc ascending order
+	NaturalOrderAsc = "ASC"
+	// NaturalOrderDesc descending order
+	NaturalOrderDesc = "DESC"
+)
+
+// Natural represents a natural ordering policy, comparing the runs of digits
+// of the values numerically and the other characters alphabetically, e.g.
+// `v9` orders before `v10`
+type Natural struct {
+	Order string
+}
+
+// NewNatural constructs a Natural object validating the provided order
+// argument
+func NewNatural(order string) (*Natural, error) {
+	switch order {
+	case "":
+		order = NaturalOrderAsc
+	case NaturalOrderAsc, NaturalOrderDesc:
+		break
+	default:
+		return nil, fmt.Errorf("invalid order argument provided: '%s', must be one of: %s, %s", order, NaturalOrderAsc, NaturalOrderDesc)
+	}
+
+	return &Natural{
+		Order: order,
+	}, nil
+}
+
+// Latest returns latest version from a provided list of strings
+func (p *Natural) Latest(versions []string) (string, error) {
+	ranked, err := p.Rank(versions)
+	if err != nil {
+		return "", err
+	}
+	return ranked[0], nil
+}
+
+// Rank returns the provided list of strings ordered from the latest
+func (p *Natural) Rank(versions []string) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, ErrEmptyVersionList
+	}
+
+	sorted := make([]string, len(versions))
+	copy(sorted, versions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c := compareNatural(sorted[i], sorted[j])
+		if p.Order == NaturalOrderDesc {
+			return c < 0
+		}
+		return c > 0
+	})
+	return sorted, nil
+}
+
+// compareNatural compares the given strings in natural order, returning -1,
+// 0 or 1.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		var ca, cb string
+		ca, a = nextChunk(a)
+		cb, b = nextChunk(b)
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			// Compare the runs of digits by value, ignoring leading zeros.
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// nextChunk splits the given non-empty string after its leading run of
+// digits or non-digits.
+func nextChunk(s string) (string, string) {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewNatural(t *testing.T) {
+	for _, order := range []string{"", NaturalOrderAsc, NaturalOrderDesc} {
+		if _, err := NewNatural(order); err != nil {
+			t.Fatalf("returned unexpected error: %s", err)
+		}
+	}
+	if _, err := NewNatural("invalid"); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+}
+
+func TestNatural_Rank(t *testing.T) {
+	cases := []struct {
+		label     string
+		order     string
+		versions  []string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			label:    "With ascending order",
+			order:    NaturalOrderAsc,
+			versions: []string{"v9.0.0", "v10.0.0", "v1.2.0", "v1.10.0"},
+			expected: []string{"v10.0.0", "v9.0.0", "v1.10.0", "v1.2.0"},
+		},
+		{
+			label:    "With descending order",
+			order:    NaturalOrderDesc,
+			versions: []string{"build-10", "build-9", "build-100"},
+			expected: []string{"build-9", "build-10", "build-100"},
+		},
+		{
+			label:    "With leading zeros and prefixes",
+			order:    NaturalOrderAsc,
+			versions: []string{"rc-007", "rc-8", "rc", "main-2"},
+			expected: []string{"rc-8", "rc-007", "rc", "main-2"},
+		},
+		{
+			label:     "With empty list",
+			order:     NaturalOrderAsc,
+			versions:  []string{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			policy, err := NewNatural(tt.order)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			ranked, err := policy.Rank(tt.versions)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(ranked, tt.expected) {
+				t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, tt.expected)
+			}
+		})
+	}
+}
@@ -18,7 +18,8 @@ package policy
 
 import (
 	"fmt"
-	"strconv"
+	"math/big"
+	"sort"
 )
 
 const (
@@ -31,6 +32,11 @@ const (
 // Numerical representes a Numerical ordering policy
 type Numerical struct {
 	Order string
+	// SkipUnparsable skips the values that can't be parsed as numbers instead
+	// of failing the evaluation
+	SkipUnparsable bool
+
+	skipped int
 }
 
 // NewNumerical constructs a Numerical object validating the provided
@@ -53,27 +59,92 @@ func NewNumerical(order string) (*Numerical, error) {
 // Latest returns latest version from a provided list of strings
 func (p *Numerical) Latest(versions []string) (string, error) {
 	if len(versions) == 0 {
-		return "", fmt.Errorf("version list argument cannot be empty")
+		return "", ErrEmptyVersionList
 	}
 
+	p.skipped = 0
 	var latest string
-	var pv float64
-	for i, version := range versions {
-		cv, err := strconv.ParseFloat(version, 64)
+	var pv *big.Float
+	for _, version := range versions {
+		cv, err := parseNumber(version)
 		if err != nil {
+			if p.SkipUnparsable {
+				p.skipped++
+				continue
+			}
 			return "", fmt.Errorf("failed to parse invalid numeric value '%s'", version)
 		}
 
-		switch {
-		case i == 0:
-			// First iteration, nothing to compare
-		case p.Order == NumericalOrderAsc && cv < pv, p.Order == NumericalOrderDesc && cv > pv:
-			continue
+		if pv != nil {
+			c := cv.Cmp(pv)
+			if p.Order == NumericalOrderAsc && c < 0 || p.Order == NumericalOrderDesc && c > 0 {
+				continue
+			}
 		}
-
 		latest = version
 		pv = cv
 	}
 
+	if pv == nil {
+		return "", ErrNoLatestVersion
+	}
 	return latest, nil
 }
+
+// Rank returns the numeric values of the provided list of strings ordered
+// from the latest
+func (p *Numerical) Rank(versions []string) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, ErrEmptyVersionList
+	}
+
+	p.skipped = 0
+	type entry struct {
+		version string
+		value   *big.Float
+	}
+	var entries []entry
+	for _, version := range versions {
+		cv, err := parseNumber(version)
+		if err != nil {
+			if p.SkipUnparsable {
+				p.skipped++
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse invalid numeric value '%s'", version)
+		}
+		entries = append(entries, entry{version: version, value: cv})
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoLatestVersion
+	}
+	// Equal values rank in reverse order, consistently with Latest.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		c := entries[i].value.Cmp(entries[j].value)
+		if p.Order == NumericalOrderDesc {
+			return c < 0
+		}
+		return c > 0
+	})
+	ranked := make([]string, len(entries))
+	for i, e := range entries {
+		ranked[i] = e.version
+	}
+	return ranked, nil
+}
+
+// Skipped returns the number of values skipped by the last evaluation
+func (p *Numerical) Skipped() int {
+	return p.skipped
+}
+
+// parseNumber parses the given decimal value with enough precision to
+// represent integers of any length exactly.
+func parseNumber(s string) (*big.Float, error) {
+	f, _, err := big.ParseFloat(s, 10, uint(64+4*len(s)), big.ToNearestEven)
+	return f, err
+}
@@ -18,6 +18,7 @@ package policy
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -63,8 +64,10 @@ func TestNumerical_Latest(t *testing.T) {
 	cases := []struct {
 		label           string
 		order           string
+		skipUnparsable  bool
 		versions        []string
 		expectedVersion string
+		expectedSkipped int
 		expectErr       bool
 	}{
 		{
@@ -121,6 +124,30 @@ func TestNumerical_Latest(t *testing.T) {
 			versions:  []string{},
 			expectErr: true,
 		},
+		{
+			label:           "With big integers ascending",
+			versions:        shuffle([]string{"12345678901234567890", "12345678901234567891", "12345678901234567889"}),
+			expectedVersion: "12345678901234567891",
+		},
+		{
+			label:           "With big integers descending",
+			versions:        shuffle([]string{"12345678901234567890", "12345678901234567891", "12345678901234567889"}),
+			order:           NumericalOrderDesc,
+			expectedVersion: "12345678901234567889",
+		},
+		{
+			label:           "With unparsable values skipped",
+			versions:        shuffle([]string{"1", "latest", "3", "main", "2"}),
+			skipUnparsable:  true,
+			expectedVersion: "3",
+			expectedSkipped: 2,
+		},
+		{
+			label:          "With only unparsable values skipped",
+			versions:       []string{"latest", "main"},
+			skipUnparsable: true,
+			expectErr:      true,
+		},
 	}
 
 	for _, tt := range cases {
@@ -129,6 +156,7 @@ func TestNumerical_Latest(t *testing.T) {
 			if err != nil {
 				t.Fatalf("returned unexpected error: %s", err)
 			}
+			policy.SkipUnparsable = tt.skipUnparsable
 			latest, err := policy.Latest(tt.versions)
 			if tt.expectErr && err == nil {
 				t.Fatalf("expecting error, got nil")
@@ -140,6 +168,9 @@ func TestNumerical_Latest(t *testing.T) {
 			if latest != tt.expectedVersion {
 				t.Errorf("incorrect computed version returned, got '%s', expected '%s'", latest, tt.expectedVersion)
 			}
+			if !tt.expectErr && policy.Skipped() != tt.expectedSkipped {
+				t.Errorf("incorrect skipped count returned, got %d, expected %d", policy.Skipped(), tt.expectedSkipped)
+			}
 		})
 	}
 }
@@ -148,3 +179,69 @@ func shuffle(list []string) []string {
 	rand.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
 	return list
 }
+
+func TestNumerical_Rank(t *testing.T) {
+	cases := []struct {
+		label          string
+		order          string
+		skipUnparsable bool
+		versions       []string
+		expected       []string
+		expectErr      bool
+	}{
+		{
+			label:    "With ascending order",
+			order:    NumericalOrderAsc,
+			versions: []string{"1", "20", "3", "100000000000000000001", "100000000000000000000"},
+			expected: []string{"100000000000000000001", "100000000000000000000", "20", "3", "1"},
+		},
+		{
+			label:    "With descending order",
+			order:    NumericalOrderDesc,
+			versions: []string{"1", "20", "3"},
+			expected: []string{"1", "3", "20"},
+		},
+		{
+			label:     "With unparsable value",
+			order:     NumericalOrderAsc,
+			versions:  []string{"1", "latest"},
+			expectErr: true,
+		},
+		{
+			label:          "Skipping unparsable values",
+			order:          NumericalOrderAsc,
+			skipUnparsable: true,
+			versions:       []string{"1", "latest", "2"},
+			expected:       []string{"2", "1"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			policy, err := NewNumerical(tt.order)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			policy.SkipUnparsable = tt.skipUnparsable
+			ranked, err := policy.Rank(tt.versions)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(ranked, tt.expected) {
+				t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, tt.expected)
+			}
+			if err == nil {
+				latest, err := policy.Latest(tt.versions)
+				if err != nil {
+					t.Fatalf("returned unexpected error: %s", err)
+				}
+				if latest != ranked[0] {
+					t.Errorf("first ranked version '%s' differs from latest version '%s'", ranked[0], latest)
+				}
+			}
+		})
+	}
+}
@@ -16,7 +16,27 @@ limitations under the License.
 
 package policy
 
+import "errors"
+
+var (
+	// ErrEmptyVersionList is returned by the policies given no versions
+	ErrEmptyVersionList = errors.New("version list argument cannot be empty")
+	// ErrNoLatestVersion is returned by the policies when none of the given
+	// versions is accepted, e.g. when no version fits the SemVer range
+	ErrNoLatestVersion = errors.New("unable to determine latest version from provided list")
+)
+
 // Policer is an interface representing a policy implementation type
 type Policer interface {
 	Latest([]string) (string, error)
+	// Rank returns the candidates of the policy from the provided list of
+	// strings, ordered from the latest
+	Rank([]string) ([]string, error)
+}
+
+// SkipCounter is implemented by policies that can skip the tags they're unable
+// to parse instead of failing
+type SkipCounter interface {
+	// Skipped returns the number of tags skipped by the last evaluation
+	Skipped() int
 }
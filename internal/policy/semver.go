@@ -18,16 +18,40 @@ package policy
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/fluxcd/pkg/version"
 )
 
+const (
+	// SemVerUpdatesPatch allows patch updates relative to a baseline version
+	SemVerUpdatesPatch = "patch"
+	// SemVerUpdatesMinor allows minor and patch updates relative to a baseline
+	// version
+	SemVerUpdatesMinor = "minor"
+	// SemVerUpdatesMajor allows all updates relative to a baseline version
+	SemVerUpdatesMajor = "major"
+)
+
+// prereleaseChannelRegexp matches a valid SemVer prerelease identifier.
+var prereleaseChannelRegexp = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
 // SemVer representes a SemVer policy
 type SemVer struct {
 	Range string
+	// Channels restricts the prerelease versions to the ones whose first
+	// prerelease identifier is one of the channels. When set, the range is
+	// checked against the release version of the prereleases.
+	Channels []string
+	// IncludeStable includes the stable versions along with the prerelease
+	// versions of the channels.
+	IncludeStable bool
 
 	constraint *semver.Constraints
+	relative   *semver.Constraints
 }
 
 // NewSemVer constructs a SemVer object validating the provided semver constraint
@@ -46,13 +70,13 @@ func NewSemVer(r string) (*SemVer, error) {
 // Latest returns latest version from a provided list of strings
 func (p *SemVer) Latest(versions []string) (string, error) {
 	if len(versions) == 0 {
-		return "", fmt.Errorf("version list argument cannot be empty")
+		return "", ErrEmptyVersionList
 	}
 
 	var latestVersion *semver.Version
 	for _, tag := range versions {
 		if v, err := version.ParseVersion(tag); err == nil {
-			if p.constraint.Check(v) && (latestVersion == nil || v.GreaterThan(latestVersion)) {
+			if p.accepts(v) && (latestVersion == nil || v.GreaterThan(latestVersion)) {
 				latestVersion = v
 			}
 		}
@@ -61,5 +85,115 @@ func (p *SemVer) Latest(versions []string) (string, error) {
 	if latestVersion != nil {
 		return latestVersion.Original(), nil
 	}
-	return "", fmt.Errorf("unable to determine latest version from provided list")
+	return "", ErrNoLatestVersion
+}
+
+// Rank returns the versions of the provided list of strings accepted by the
+// policy, ordered from the latest
+func (p *SemVer) Rank(versions []string) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, ErrEmptyVersionList
+	}
+
+	var accepted []*semver.Version
+	for _, tag := range versions {
+		if v, err := version.ParseVersion(tag); err == nil && p.accepts(v) {
+			accepted = append(accepted, v)
+		}
+	}
+
+	if len(accepted) == 0 {
+		return nil, ErrNoLatestVersion
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].GreaterThan(accepted[j])
+	})
+	ranked := make([]string, len(accepted))
+	for i, v := range accepted {
+		ranked[i] = v.Original()
+	}
+	return ranked, nil
+}
+
+// SetChannels restricts the prerelease versions to the given channels,
+// validating them
+func (p *SemVer) SetChannels(channels []string, includeStable bool) error {
+	for _, c := range channels {
+		if !prereleaseChannelRegexp.MatchString(c) {
+			return fmt.Errorf("invalid prerelease channel '%s'", c)
+		}
+	}
+	p.Channels = channels
+	p.IncludeStable = includeStable
+	return nil
+}
+
+// accepts returns whether the given version is a candidate of the policy.
+func (p *SemVer) accepts(v *semver.Version) bool {
+	if len(p.Channels) == 0 {
+		return p.check(v)
+	}
+
+	if v.Prerelease() == "" {
+		return p.IncludeStable && p.check(v)
+	}
+
+	channel, _, _ := strings.Cut(v.Prerelease(), ".")
+	for _, c := range p.Channels {
+		if c == channel {
+			release, err := v.SetPrerelease("")
+			if err != nil {
+				return false
+			}
+			return p.check(&release)
+		}
+	}
+	return false
+}
+
+// check returns whether the given version satisfies the range and the
+// relative range, if any.
+func (p *SemVer) check(v *semver.Version) bool {
+	return p.constraint.Check(v) && (p.relative == nil || p.relative.Check(v))
+}
+
+// SetRelative restricts the versions to the given kind of updates relative to
+// the baseline version, in addition to the range
+func (p *SemVer) SetRelative(updates, baseline string) error {
+	r, err := RelativeRange(updates, baseline)
+	if err != nil {
+		return err
+	}
+	constraint, err := semver.NewConstraint(r)
+	if err != nil {
+		return err
+	}
+	p.relative = constraint
+	return nil
+}
+
+// RelativeRange returns the semver range allowing the given kind of updates
+// relative to the baseline version, e.g. '>=1.4.2 <1.5.0' for patch updates
+// relative to 1.4.2
+func RelativeRange(updates, baseline string) (string, error) {
+	v, err := version.ParseVersion(baseline)
+	if err != nil {
+		return "", fmt.Errorf("invalid baseline version '%s': %w", baseline, err)
+	}
+	b := fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch())
+	if v.Prerelease() != "" {
+		b += "-" + v.Prerelease()
+	}
+
+	switch updates {
+	case SemVerUpdatesPatch:
+		return fmt.Sprintf(">=%s <%d.%d.0", b, v.Major(), v.Minor()+1), nil
+	case SemVerUpdatesMinor:
+		return fmt.Sprintf(">=%s <%d.0.0", b, v.Major()+1), nil
+	case SemVerUpdatesMajor:
+		return fmt.Sprintf(">=%s", b), nil
+	default:
+		return "", fmt.Errorf("invalid updates argument provided: '%s', must be one of: %s, %s, %s",
+			updates, SemVerUpdatesPatch, SemVerUpdatesMinor, SemVerUpdatesMajor)
+	}
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package policy
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -56,6 +57,8 @@ func TestSemVer_Latest(t *testing.T) {
 	cases := []struct {
 		label           string
 		semverRange     string
+		channels        []string
+		includeStable   bool
 		versions        []string
 		expectedVersion string
 		expectErr       bool
@@ -90,6 +93,50 @@ func TestSemVer_Latest(t *testing.T) {
 			semverRange: "1.0.x",
 			expectErr:   true,
 		},
+		{
+			label:           "With prerelease channel",
+			versions:        []string{"1.0.0", "1.1.0-rc.9", "1.1.0-rc.10", "1.1.0-beta.20", "1.2.0-nightly.1"},
+			semverRange:     ">=1.0.0",
+			channels:        []string{"rc"},
+			expectedVersion: "1.1.0-rc.10",
+		},
+		{
+			label:           "With multiple prerelease channels",
+			versions:        []string{"1.0.0", "1.1.0-rc.1", "1.2.0-beta.1", "1.3.0-nightly.1"},
+			semverRange:     ">=1.0.0",
+			channels:        []string{"rc", "beta"},
+			expectedVersion: "1.2.0-beta.1",
+		},
+		{
+			label:           "With prerelease channel and range on release version",
+			versions:        []string{"1.0.0-rc.1", "1.0.1-rc.1", "1.1.0-rc.1"},
+			semverRange:     "~1.0",
+			channels:        []string{"rc"},
+			expectedVersion: "1.0.1-rc.1",
+		},
+		{
+			label:           "With prerelease channel including newer prerelease",
+			versions:        []string{"1.0.0", "1.1.0", "1.2.0-rc.1", "1.2.0-beta.1"},
+			semverRange:     ">=1.0.0",
+			channels:        []string{"rc"},
+			includeStable:   true,
+			expectedVersion: "1.2.0-rc.1",
+		},
+		{
+			label:           "With prerelease channel including newer stable",
+			versions:        []string{"1.0.0", "1.2.0", "1.2.0-rc.1", "1.3.0-beta.1"},
+			semverRange:     ">=1.0.0",
+			channels:        []string{"rc"},
+			includeStable:   true,
+			expectedVersion: "1.2.0",
+		},
+		{
+			label:       "With prerelease channel and only stable versions",
+			versions:    []string{"1.0.0", "1.2.0"},
+			semverRange: ">=1.0.0",
+			channels:    []string{"rc"},
+			expectErr:   true,
+		},
 	}
 
 	for _, tt := range cases {
@@ -98,6 +145,9 @@ func TestSemVer_Latest(t *testing.T) {
 			if err != nil {
 				t.Fatalf("returned unexpected error: %s", err)
 			}
+			if err := policy.SetChannels(tt.channels, tt.includeStable); err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
 
 			latest, err := policy.Latest(tt.versions)
 			if tt.expectErr && err == nil {
@@ -113,3 +163,123 @@ func TestSemVer_Latest(t *testing.T) {
 		})
 	}
 }
+
+func TestSemVer_SetChannels(t *testing.T) {
+	policy, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	if err := policy.SetChannels([]string{"rc", "beta-1"}, false); err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	for _, c := range []string{"", "rc.1", "rc_1"} {
+		if err := policy.SetChannels([]string{c}, false); err == nil {
+			t.Fatalf("expecting error, got nil for channel: '%s'", c)
+		}
+	}
+}
+
+func TestRelativeRange(t *testing.T) {
+	cases := []struct {
+		label         string
+		updates       string
+		baseline      string
+		expectedRange string
+		expectErr     bool
+	}{
+		{
+			label:         "With patch updates",
+			updates:       SemVerUpdatesPatch,
+			baseline:      "v1.4.2",
+			expectedRange: ">=1.4.2 <1.5.0",
+		},
+		{
+			label:         "With minor updates",
+			updates:       SemVerUpdatesMinor,
+			baseline:      "1.4.2",
+			expectedRange: ">=1.4.2 <2.0.0",
+		},
+		{
+			label:         "With major updates",
+			updates:       SemVerUpdatesMajor,
+			baseline:      "1.4.2-rc.1+build.5",
+			expectedRange: ">=1.4.2-rc.1",
+		},
+		{
+			label:     "With invalid baseline",
+			updates:   SemVerUpdatesPatch,
+			baseline:  "latest",
+			expectErr: true,
+		},
+		{
+			label:     "With invalid updates",
+			updates:   "invalid",
+			baseline:  "1.4.2",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			r, err := RelativeRange(tt.updates, tt.baseline)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if r != tt.expectedRange {
+				t.Errorf("incorrect range returned, got '%s', expected '%s'", r, tt.expectedRange)
+			}
+		})
+	}
+}
+
+func TestSemVer_SetRelative(t *testing.T) {
+	versions := []string{"1.4.2", "1.4.3", "1.5.0", "2.0.0", "1.3.9"}
+
+	policy, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	if err := policy.SetRelative(SemVerUpdatesPatch, "1.4.2"); err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	latest, err := policy.Latest(versions)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	if latest != "1.4.3" {
+		t.Errorf("incorrect computed version returned, got '%s', expected '%s'", latest, "1.4.3")
+	}
+
+	if err := policy.SetRelative(SemVerUpdatesMinor, "1.4.2"); err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	latest, err = policy.Latest(versions)
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	if latest != "1.5.0" {
+		t.Errorf("incorrect computed version returned, got '%s', expected '%s'", latest, "1.5.0")
+	}
+}
+
+func TestSemVer_Rank(t *testing.T) {
+	policy, err := NewSemVer(">=1.0.0")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	ranked, err := policy.Rank([]string{"1.0.0", "v1.10.0", "latest", "0.9.0", "1.2.0", "2.0.0-rc.1"})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+	expected := []string{"v1.10.0", "1.2.0", "1.0.0"}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("incorrect ranked versions returned, got '%v', expected '%v'", ranked, expected)
+	}
+
+	if _, err := policy.Rank([]string{"0.1.0"}); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"fmt"
+	"time"
+	// Embed the time zone database for the images that don't ship one.
+	_ "time/tzdata"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+)
+
+// clockLayout is the layout of the start and end times of a window.
+const clockLayout = "15:04"
+
+// Window represents a recurring time range, opening at the same time of the
+// day on a set of days of the week. A window whose end isn't after its start
+// spans midnight and closes on the next day.
+type Window struct {
+	// Days are the days of the week the window opens on, all the days when
+	// empty
+	Days []time.Weekday
+	// Start is the opening wall clock time of the window as a duration since
+	// midnight
+	Start time.Duration
+	// End is the closing wall clock time of the window as a duration since
+	// midnight
+	End time.Duration
+	// Location is the time zone of the start and end times
+	Location *time.Location
+}
+
+// NewWindow constructs a Window object validating the provided days, times
+// and time zone. The times are in the HH:MM format, the time zone is an IANA
+// time zone name, UTC when empty.
+func NewWindow(days []string, start, end, timeZone string) (*Window, error) {
+	w := &Window{}
+	for _, d := range days {
+		wd, err := parseWeekday(d)
+		if err != nil {
+			return nil, err
+		}
+		w.Days = append(w.Days, wd)
+	}
+
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return nil, err
+	}
+
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if w.Location, err = time.LoadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("invalid time zone '%s': %w", timeZone, err)
+	}
+	return w, nil
+}
+
+// Active returns true if the window is open at the given time.
+func (w *Window) Active(t time.Time) bool {
+	t = t.In(w.Location)
+	// A window spanning midnight may have opened the day before.
+	for _, days := range []int{0, -1} {
+		opening := w.opening(t, days)
+		if !w.opensOn(opening.Weekday()) {
+			continue
+		}
+		if !t.Before(opening) && t.Before(w.closing(opening)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpening returns the first opening time of the window after the given
+// time.
+func (w *Window) NextOpening(t time.Time) time.Time {
+	t = t.In(w.Location)
+	for days := 0; days <= 7; days++ {
+		opening := w.opening(t, days)
+		if w.opensOn(opening.Weekday()) && opening.After(t) {
+			return opening
+		}
+	}
+	// Unreachable, a window opens at least once a week.
+	return time.Time{}
+}
+
+// opening returns the opening time of the window on the day of the given time
+// shifted by the given number of days.
+func (w *Window) opening(t time.Time, days int) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+days, 0, int(w.Start.Minutes()), 0, 0, w.Location)
+}
+
+// closing returns the closing time of the window opened at the given time.
+func (w *Window) closing(opening time.Time) time.Time {
+	y, m, d := opening.Date()
+	if w.End <= w.Start {
+		d++
+	}
+	return time.Date(y, m, d, 0, int(w.End.Minutes()), 0, 0, w.Location)
+}
+
+// opensOn returns true if the window opens on the given day of the week.
+func (w *Window) opensOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns true if any of the given windows is open at the given time.
+// Otherwise, it returns the earliest next opening time of the windows.
+func Open(windows []*Window, t time.Time) (bool, time.Time) {
+	var next time.Time
+	for _, w := range windows {
+		if w.Active(t) {
+			return true, time.Time{}
+		}
+		if n := w.NextOpening(t); next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+	return false, next
+}
+
+// WindowsFromSpec constructs the windows of the given promotion windows.
+func WindowsFromSpec(specs []imagev1.PromotionWindow) ([]*Window, error) {
+	windows := make([]*Window, 0, len(specs))
+	for i, s := range specs {
+		days := make([]string, len(s.Days))
+		for j, d := range s.Days {
+			days[j] = string(d)
+		}
+		w, err := NewWindow(days, s.Start, s.End, s.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid promotion window at index %d: %w", i, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day of the week '%s'", s)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', must be in the HH:MM format", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
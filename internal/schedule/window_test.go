@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+)
+
+func TestNewWindow(t *testing.T) {
+	cases := []struct {
+		label     string
+		days      []string
+		start     string
+		end       string
+		timeZone  string
+		expectErr bool
+	}{
+		{
+			label: "With valid window",
+			days:  []string{"Monday", "Friday"},
+			start: "09:00",
+			end:   "17:30",
+		},
+		{
+			label:    "With valid time zone",
+			start:    "22:00",
+			end:      "02:00",
+			timeZone: "Europe/Berlin",
+		},
+		{
+			label:     "With invalid day",
+			days:      []string{"Mon"},
+			start:     "09:00",
+			end:       "17:00",
+			expectErr: true,
+		},
+		{
+			label:     "With invalid time",
+			start:     "9am",
+			end:       "17:00",
+			expectErr: true,
+		},
+		{
+			label:     "With invalid time zone",
+			start:     "09:00",
+			end:       "17:00",
+			timeZone:  "Mars/Olympus",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			_, err := NewWindow(tt.days, tt.start, tt.end, tt.timeZone)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expecting error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestWindow_Active(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		label           string
+		days            []string
+		start           string
+		end             string
+		timeZone        string
+		time            time.Time
+		expectedActive  bool
+		expectedOpening time.Time
+	}{
+		{
+			label:           "Within business hours",
+			days:            []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+			start:           "09:00",
+			end:             "17:00",
+			time:            time.Date(2023, 6, 7, 10, 0, 0, 0, time.UTC),
+			expectedActive:  true,
+			expectedOpening: time.Date(2023, 6, 8, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			label:           "At closing time",
+			days:            []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+			start:           "09:00",
+			end:             "17:00",
+			time:            time.Date(2023, 6, 7, 17, 0, 0, 0, time.UTC),
+			expectedOpening: time.Date(2023, 6, 8, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			label:           "On the weekend",
+			days:            []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+			start:           "09:00",
+			end:             "17:00",
+			time:            time.Date(2023, 6, 10, 10, 0, 0, 0, time.UTC),
+			expectedOpening: time.Date(2023, 6, 12, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			label:           "Spanning midnight after midnight",
+			days:            []string{"Friday"},
+			start:           "22:00",
+			end:             "02:00",
+			time:            time.Date(2023, 6, 10, 1, 0, 0, 0, time.UTC),
+			expectedActive:  true,
+			expectedOpening: time.Date(2023, 6, 16, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			label:           "Spanning midnight on the wrong day",
+			days:            []string{"Friday"},
+			start:           "22:00",
+			end:             "02:00",
+			time:            time.Date(2023, 6, 9, 1, 0, 0, 0, time.UTC),
+			expectedOpening: time.Date(2023, 6, 9, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			label:           "With time zone",
+			start:           "09:00",
+			end:             "17:00",
+			timeZone:        "Europe/Berlin",
+			time:            time.Date(2023, 6, 7, 7, 30, 0, 0, time.UTC),
+			expectedActive:  true,
+			expectedOpening: time.Date(2023, 6, 8, 9, 0, 0, 0, berlin),
+		},
+		{
+			label:           "Before opening in time zone",
+			start:           "09:00",
+			end:             "17:00",
+			timeZone:        "Europe/Berlin",
+			time:            time.Date(2023, 6, 7, 6, 30, 0, 0, time.UTC),
+			expectedOpening: time.Date(2023, 6, 7, 9, 0, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.label, func(t *testing.T) {
+			w, err := NewWindow(tt.days, tt.start, tt.end, tt.timeZone)
+			if err != nil {
+				t.Fatalf("returned unexpected error: %s", err)
+			}
+			if active := w.Active(tt.time); active != tt.expectedActive {
+				t.Errorf("incorrect active state returned, got %t, expected %t", active, tt.expectedActive)
+			}
+			if opening := w.NextOpening(tt.time); !opening.Equal(tt.expectedOpening) {
+				t.Errorf("incorrect next opening returned, got '%s', expected '%s'", opening, tt.expectedOpening)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	windows, err := WindowsFromSpec([]imagev1.PromotionWindow{
+		{Days: []imagev1.Weekday{"Monday"}, Start: "09:00", End: "12:00"},
+		{Days: []imagev1.Weekday{"Wednesday"}, Start: "14:00", End: "16:00"},
+	})
+	if err != nil {
+		t.Fatalf("returned unexpected error: %s", err)
+	}
+
+	open, _ := Open(windows, time.Date(2023, 6, 7, 15, 0, 0, 0, time.UTC))
+	if !open {
+		t.Errorf("expecting windows to be open")
+	}
+
+	open, next := Open(windows, time.Date(2023, 6, 7, 17, 0, 0, 0, time.UTC))
+	if open {
+		t.Errorf("expecting windows to be closed")
+	}
+	expected := time.Date(2023, 6, 12, 9, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) {
+		t.Errorf("incorrect next opening returned, got '%s', expected '%s'", next, expected)
+	}
+
+	if _, err := WindowsFromSpec([]imagev1.PromotionWindow{{Start: "25:00", End: "12:00"}}); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+}
@@ -17,11 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/dgraph-io/badger/v3"
 	flag "github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,6 +35,8 @@ import (
 	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/fluxcd/pkg/oci/auth/login"
 	"github.com/fluxcd/pkg/runtime/acl"
@@ -51,6 +55,7 @@ import (
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
 	"github.com/fluxcd/image-reflector-controller/internal/controller"
 	"github.com/fluxcd/image-reflector-controller/internal/database"
+	"github.com/fluxcd/image-reflector-controller/internal/debug"
 	"github.com/fluxcd/image-reflector-controller/internal/features"
 )
 
@@ -77,8 +82,20 @@ func main() {
 		logOptions              logger.Options
 		leaderElectionOptions   leaderelection.Options
 		watchOptions            helper.WatchOptions
+		storageBackend          string
 		storagePath             string
+		storageImport           string
 		storageValueLogFileSize int64
+		storageGCInterval       time.Duration
+		storageGCDiscardRatio   float64
+		storageEncryptionKey    string
+		storagePreviousKey      string
+		storageKeyRotation      time.Duration
+		storageRecoverCorrupt   bool
+		sharedTagsDatabase      bool
+		digestLookups           int
+		explainTokenFile        string
+		exportTokenFile         string
 		concurrent              int
 		awsAutoLogin            bool
 		gcpAutoLogin            bool
@@ -91,8 +108,21 @@ func main() {
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&eventsAddr, "events-addr", "", "The address of the events receiver.")
 	flag.StringVar(&healthAddr, "health-addr", ":9440", "The address the health endpoint binds to.")
+	flag.StringVar(&storageBackend, "storage-backend", database.BackendBadger,
+		fmt.Sprintf("The backend of the persistent database of image metadata, one of: %s.", strings.Join(database.Backends(), ", ")))
 	flag.StringVar(&storagePath, "storage-path", "/data", "Where to store the persistent database of image metadata")
-	flag.Int64Var(&storageValueLogFileSize, "storage-value-log-file-size", 1<<28, "Set the database's memory mapped value log file size in bytes. Effective memory usage is about two times this size.")
+	flag.StringVar(&storageImport, "storage-import", "", "Import the database archive of the given file, or OCI artifact prefixed with 'oci://', on startup if the database is empty.")
+	flag.Int64Var(&storageValueLogFileSize, "storage-value-log-file-size", 1<<28, "Set the Badger database's memory mapped value log file size in bytes. Effective memory usage is about two times this size.")
+	flag.StringVar(&storageEncryptionKey, "storage-encryption-key-file", "", "Encrypt the Badger database with the AES key of the given file, e.g. a mounted Secret, 16, 24 or 32 bytes long.")
+	flag.StringVar(&storagePreviousKey, "storage-encryption-previous-key-file", "", "The file of the key the Badger database was encrypted with, to rotate it to the key of --storage-encryption-key-file.")
+	flag.DurationVar(&storageKeyRotation, "storage-encryption-key-rotation", 10*24*time.Hour, "The interval at which the data keys of the encrypted Badger database are rotated.")
+	flag.BoolVar(&storageRecoverCorrupt, "storage-recover-corrupt", false, "Move a Badger database that can't be opened aside and start with an empty database, rather than exiting.")
+	flag.DurationVar(&storageGCInterval, "storage-gc-interval", 10*time.Minute, "The interval at which the Badger database's value log is garbage collected. Set to 0 to disable the garbage collection.")
+	flag.Float64Var(&storageGCDiscardRatio, "storage-gc-discard-ratio", 0.5, "The fraction of a Badger database value log file that must be discardable for the file to be rewritten by the garbage collection.")
+	flag.BoolVar(&sharedTagsDatabase, "shared-tags-database", false, "Share the scanned tags between the ImageRepositories of the same image, in any namespace, instead of scoping them to each ImageRepository.")
+	flag.IntVar(&digestLookups, "digest-lookups-per-scan", 0, "The maximum number of tags of which the image digest is resolved on every scan of an ImageRepository, starting with its latest tags. Disabled when 0, the default.")
+	flag.StringVar(&explainTokenFile, "explain-endpoint-token-file", "", "Serve the verdicts of the ImagePolicies on their tags, for any ImagePolicy in any namespace, on the metrics address to the requests authorized with the bearer token of the given file, e.g. a mounted Secret. The endpoint is disabled when not set.")
+	flag.StringVar(&exportTokenFile, "database-export-token-file", "", "Serve the archive of the database on the metrics address to the requests authorized with the bearer token of the given file, e.g. a mounted Secret. The endpoint is disabled when not set.")
 	flag.IntVar(&concurrent, "concurrent", 4, "The number of concurrent resource reconciles.")
 
 	// NOTE: Deprecated flags.
@@ -123,20 +153,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	badgerOpts := badger.DefaultOptions(storagePath)
-	badgerOpts.ValueLogFileSize = storageValueLogFileSize
-	badgerDB, err := badger.Open(badgerOpts)
+	restConfig := client.GetConfigOrDie(clientOptions)
+
+	if storageEncryptionKey != "" && storageBackend != database.BackendBadger {
+		setupLog.Error(errors.New("unsupported encryption"), "only the badger database backend can be encrypted", "backend", storageBackend)
+		os.Exit(1)
+	}
+	dbOpts := database.Options{
+		Path:                      storagePath,
+		ValueLogFileSize:          storageValueLogFileSize,
+		EncryptionKeyFile:         storageEncryptionKey,
+		PreviousEncryptionKeyFile: storagePreviousKey,
+		EncryptionKeyRotation:     storageKeyRotation,
+		RecoverCorrupt:            storageRecoverCorrupt,
+		Namespace:                 os.Getenv("RUNTIME_NAMESPACE"),
+	}
+	// The ConfigMap backend writes the ConfigMaps directly, and reads them
+	// from its own cache, as the database is opened before the manager and
+	// its cache.
+	if storageBackend == database.BackendConfigMap {
+		c, err := ctrlclient.New(restConfig, ctrlclient.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create the database client")
+			os.Exit(1)
+		}
+		dbOpts.Client = c
+		cacheCtx, cancelCache := context.WithCancel(context.Background())
+		defer cancelCache()
+		if dbOpts.Reader, err = database.StartConfigMapCache(cacheCtx, restConfig, dbOpts.Namespace); err != nil {
+			setupLog.Error(err, "unable to start the database cache")
+			os.Exit(1)
+		}
+	}
+	db, err := database.Open(storageBackend, dbOpts)
 	if err != nil {
-		setupLog.Error(err, "unable to open the Badger database")
+		setupLog.Error(err, "unable to open the database", "backend", storageBackend)
 		os.Exit(1)
 	}
-	defer badgerDB.Close()
-	db := database.NewBadgerDatabase(badgerDB)
-
+	defer db.Close()
+	if badgerDB, ok := db.(*database.BadgerDatabase); ok {
+		if moved := badgerDB.Recovered(); moved != "" {
+			setupLog.Error(errors.New("corrupt database"), "moved the corrupt database aside and started with an empty database",
+				"path", moved)
+		}
+		ctrlmetrics.Registry.MustRegister(badgerDB.Collectors()...)
+	}
 	watchNamespace := ""
 	if !watchOptions.AllNamespaces {
 		watchNamespace = os.Getenv("RUNTIME_NAMESPACE")
 	}
+	watchSelector, err := helper.GetWatchSelector(watchOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to configure watch label selector for manager")
+		os.Exit(1)
+	}
 
 	var disableCacheFor []ctrlclient.Object
 	shouldCache, err := features.Enabled(features.CacheSecretsAndConfigMaps)
@@ -148,14 +218,6 @@ func main() {
 		disableCacheFor = append(disableCacheFor, &corev1.Secret{}, &corev1.ConfigMap{})
 	}
 
-	restConfig := client.GetConfigOrDie(clientOptions)
-
-	watchSelector, err := helper.GetWatchSelector(watchOptions)
-	if err != nil {
-		setupLog.Error(err, "unable to configure watch label selector for manager")
-		os.Exit(1)
-	}
-
 	leaderElectionID := fmt.Sprintf("%s-leader-election", controllerName)
 	if watchOptions.LabelSelector != "" {
 		leaderElectionID = leaderelection.GenerateID(leaderElectionID, watchOptions.LabelSelector)
@@ -195,6 +257,10 @@ func main() {
 	}
 
 	probes.SetupChecks(mgr, setupLog)
+	if err := mgr.AddReadyzCheck("database", database.ReadyzCheck(db)); err != nil {
+		setupLog.Error(err, "unable to create the database ready check")
+		os.Exit(1)
+	}
 	pprof.SetupHandlers(mgr, setupLog)
 
 	var eventRecorder *events.Recorder
@@ -205,36 +271,134 @@ func main() {
 
 	metricsH := helper.NewMetrics(mgr, metrics.MustMakeRecorder(), imagev1.ImageFinalizer)
 
-	if err := (&controller.ImageRepositoryReconciler{
-		Client:         mgr.GetClient(),
-		EventRecorder:  eventRecorder,
-		Metrics:        metricsH,
-		Database:       db,
-		ControllerName: controllerName,
+	databaseReady := make(chan struct{})
+	imageRepositoryReconciler := &controller.ImageRepositoryReconciler{
+		Client:             mgr.GetClient(),
+		EventRecorder:      eventRecorder,
+		Metrics:            metricsH,
+		Database:           db,
+		SharedTagsDatabase: sharedTagsDatabase,
+		DigestLookups:      digestLookups,
+		WatchNamespace:     watchNamespace,
+		APIReader:          mgr.GetAPIReader(),
+		DatabaseReady:      databaseReady,
+		ControllerName:     controllerName,
 		DeprecatedLoginOpts: login.ProviderOptions{
 			AwsAutoLogin:   awsAutoLogin,
 			AzureAutoLogin: azureAutoLogin,
 			GcpAutoLogin:   gcpAutoLogin,
 		},
-	}).SetupWithManager(mgr, controller.ImageRepositoryReconcilerOptions{
+	}
+	if err := imageRepositoryReconciler.SetupWithManager(mgr, controller.ImageRepositoryReconcilerOptions{
 		RateLimiter: helper.GetRateLimiter(rateLimiterOptions),
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", imagev1.ImageRepositoryKind)
 		os.Exit(1)
 	}
-	if err := (&controller.ImagePolicyReconciler{
-		Client:         mgr.GetClient(),
-		EventRecorder:  eventRecorder,
-		Metrics:        metricsH,
-		Database:       db,
-		ACLOptions:     aclOptions,
-		ControllerName: controllerName,
-	}).SetupWithManager(mgr, controller.ImagePolicyReconcilerOptions{
+	if badgerDB, ok := db.(*database.BadgerDatabase); ok && storageGCInterval > 0 {
+		gc, err := database.NewBadgerGarbageCollector(badgerDB, storageGCInterval, storageGCDiscardRatio)
+		if err != nil {
+			setupLog.Error(err, "unable to create the database garbage collector")
+			os.Exit(1)
+		}
+		ctrlmetrics.Registry.MustRegister(gc.Collectors()...)
+		if err := mgr.Add(gc); err != nil {
+			setupLog.Error(err, "unable to add the database garbage collector")
+			os.Exit(1)
+		}
+	}
+	// Once elected leader, migrate the tags recorded with the other key
+	// scheme, e.g. the shared tags of the previous versions, to the keys of
+	// the ImageRepositories, then restore the database from an archive, e.g.
+	// after losing the volume, for the ImageRepositories not to be scanned
+	// again. The ImageRepositories are read from the API server regardless of
+	// the label selector, for the tags of the other controller shards sharing
+	// the database to be kept. The reconciliations wait for the database.
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		repoObjects, err := controller.RepositoryObjects(ctx, mgr.GetAPIReader(), ctrlclient.InNamespace(watchNamespace))
+		if err != nil {
+			return fmt.Errorf("unable to list the ImageRepositories to migrate the database keys: %w", err)
+		}
+		if n, err := database.MigrateKeys(db, sharedTagsDatabase, repoObjects); err != nil {
+			return fmt.Errorf("unable to migrate the database keys: %w", err)
+		} else if n > 0 {
+			setupLog.Info("migrated the tags recorded with another key scheme", "count", n, "shared", sharedTagsDatabase)
+		}
+		// On failure, the ImageRepositories are scanned. The tags archived
+		// with the other key scheme are imported under the keys they are
+		// migrated to.
+		if storageImport != "" {
+			importCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			if n, err := database.ImportIfEmpty(importCtx, db, storageImport, sharedTagsDatabase, repoObjects); err != nil {
+				setupLog.Error(err, "unable to import the database archive", "source", storageImport)
+			} else if n > 0 {
+				setupLog.Info("imported the database archive", "source", storageImport, "count", n)
+			}
+			cancel()
+		}
+		close(databaseReady)
+		return nil
+	})); err != nil {
+		setupLog.Error(err, "unable to add the database migration")
+		os.Exit(1)
+	}
+	// Sweep the tags of the ImageRepositories deleted while the controller
+	// was not running, once the cache is synced and the database migrated.
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		select {
+		case <-databaseReady:
+		case <-ctx.Done():
+			return nil
+		}
+		n, err := imageRepositoryReconciler.SweepOrphanedTags(ctx)
+		if err != nil {
+			setupLog.Error(err, "unable to sweep the orphaned tags from the database")
+		} else if n > 0 {
+			setupLog.Info("swept the orphaned tags from the database", "count", n)
+		}
+		return nil
+	})); err != nil {
+		setupLog.Error(err, "unable to add the database sweep")
+		os.Exit(1)
+	}
+	imagePolicyReconciler := &controller.ImagePolicyReconciler{
+		Client:             mgr.GetClient(),
+		EventRecorder:      eventRecorder,
+		Metrics:            metricsH,
+		Database:           db,
+		SharedTagsDatabase: sharedTagsDatabase,
+		ACLOptions:         aclOptions,
+		DatabaseReady:      databaseReady,
+		ControllerName:     controllerName,
+	}
+	if err := imagePolicyReconciler.SetupWithManager(mgr, controller.ImagePolicyReconcilerOptions{
 		RateLimiter: helper.GetRateLimiter(rateLimiterOptions),
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", imagev1.ImagePolicyKind)
 		os.Exit(1)
 	}
+	if explainTokenFile != "" {
+		token, err := debug.ReadToken(explainTokenFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read the ImagePolicy explain endpoint token")
+			os.Exit(1)
+		}
+		if err := mgr.AddMetricsExtraHandler(controller.ExplainPath, debug.RequireToken(token, imagePolicyReconciler.ExplainHandler())); err != nil {
+			setupLog.Error(err, "unable to set up the ImagePolicy explain endpoint")
+			os.Exit(1)
+		}
+	}
+	if exportTokenFile != "" {
+		token, err := debug.ReadToken(exportTokenFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read the database export token")
+			os.Exit(1)
+		}
+		if err := mgr.AddMetricsExtraHandler(database.ExportPath, debug.RequireToken(token, database.ExportHandler(db))); err != nil {
+			setupLog.Error(err, "unable to set up the database export endpoint")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")